@@ -0,0 +1,38 @@
+// Command faketwitter serves a fake Twitter API seeded from a JSON file, so the service can run locally
+// without real Twitter access.
+package main
+
+import (
+	"flag"
+	"log"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/kordape/ottct-poller-service/pkg/twitter/twittertest"
+)
+
+func main() {
+	addr := flag.String("addr", ":8080", "address to listen on")
+	seed := flag.String("seed", "", "JSON file with users, tweets and media to serve")
+	rateLimit := flag.Int("rate-limit", 1500, "requests per endpoint and token allowed in a rate limit window")
+	window := flag.Duration("rate-limit-window", 15*time.Minute, "rate limit window")
+	flag.Parse()
+
+	server := twittertest.New(twittertest.WithRateLimit(*rateLimit, *window))
+	if *seed != "" {
+		f, err := os.Open(*seed)
+		if err != nil {
+			log.Fatalf("Seed error: %s", err)
+		}
+
+		err = server.LoadSeed(f)
+		f.Close()
+		if err != nil {
+			log.Fatalf("Seed error: %s", err)
+		}
+	}
+
+	log.Printf("Serving fake Twitter API on %s", *addr)
+	log.Fatal(http.ListenAndServe(*addr, server))
+}
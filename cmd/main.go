@@ -2,10 +2,12 @@ package main
 
 import (
 	"context"
+	"fmt"
 	"log"
 	"net/http"
 	"os"
 	"os/signal"
+	"strings"
 	"syscall"
 	"time"
 
@@ -17,12 +19,16 @@ import (
 	"gorm.io/gorm"
 
 	"github.com/kordape/ottct-poller-service/config"
+	"github.com/kordape/ottct-poller-service/internal/database"
 	"github.com/kordape/ottct-poller-service/internal/database/postgres"
 	"github.com/kordape/ottct-poller-service/internal/event"
 	"github.com/kordape/ottct-poller-service/internal/processor"
 	"github.com/kordape/ottct-poller-service/internal/worker"
 	"github.com/kordape/ottct-poller-service/pkg/logger"
+	"github.com/kordape/ottct-poller-service/pkg/mastodon"
 	"github.com/kordape/ottct-poller-service/pkg/predictor"
+	"github.com/kordape/ottct-poller-service/pkg/retry"
+	"github.com/kordape/ottct-poller-service/pkg/rss"
 	"github.com/kordape/ottct-poller-service/pkg/sqs"
 	"github.com/kordape/ottct-poller-service/pkg/twitter"
 )
@@ -59,26 +65,199 @@ func main() {
 		log.Fatal(err)
 	}
 
+	hostname, err := os.Hostname()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	replicaID := fmt.Sprintf("%s-%d", hostname, os.Getpid())
+
+	retryPolicy := retry.DefaultPolicy()
+	retryPolicy.MaxAttempts = cfg.Worker.RetryMaxAttempts
+	retryPolicy.InitialBackoff = time.Millisecond * time.Duration(cfg.Worker.RetryInitialBackoffMs)
+	retryPolicy.MaxBackoff = time.Millisecond * time.Duration(cfg.Worker.RetryMaxBackoffMs)
+	retryPolicy.Jitter = cfg.Worker.RetryJitter
+	if err := retryPolicy.Validate(); err != nil {
+		log.Fatal(fmt.Errorf("invalid retry policy: %w", err))
+	}
+
+	tweetFields := twitter.DefaultTweetFields()
+	tweetFields.TweetFields = splitList(cfg.Worker.TwitterTweetFields)
+	tweetFields.Expansions = splitList(cfg.Worker.TwitterExpansions)
+
+	// Tokens of several Twitter projects can be combined to multiply the rate limit budget
+	tokens := splitList(cfg.Worker.TwitterBearerTokens)
+	if token := strings.TrimSpace(cfg.Worker.TwitterBearerToken); token != "" {
+		tokens = append([]string{token}, tokens...)
+	}
+	if cfg.Worker.TwitterBearerTokensFile != "" {
+		fileTokens, err := twitter.LoadTokens(cfg.Worker.TwitterBearerTokensFile)
+		if err != nil {
+			log.Fatal(err)
+		}
+		tokens = append(tokens, fileTokens...)
+	}
+
+	poolOpts := []twitter.CredentialPoolOption{
+		twitter.WithQuarantine(time.Second * time.Duration(cfg.Worker.TwitterQuarantineSeconds)),
+	}
+
+	// App-only bearer tokens are obtained from the consumer key and secret and refreshed when Twitter rejects them
+	if cfg.Worker.TwitterConsumerKey != "" {
+		clientCredentials, err := twitter.NewClientCredentials(
+			&http.Client{
+				Timeout: 10 * time.Second,
+			},
+			cfg.Worker.TwitterConsumerKey,
+			cfg.Worker.TwitterConsumerSecret,
+			twitter.WithTokenURL(cfg.Worker.TwitterTokenURL),
+		)
+		if err != nil {
+			log.Fatal(fmt.Errorf("invalid twitter client credentials: %w", err))
+		}
+		poolOpts = append(poolOpts, twitter.WithTokenSources(clientCredentials))
+	}
+
+	credentials, err := twitter.NewCredentialPool(tokens, poolOpts...)
+	if err != nil {
+		log.Fatal(fmt.Errorf("invalid twitter credentials: %w", err))
+	}
+	log.Info(fmt.Sprintf("Using %d Twitter credentials", credentials.Size()))
+
+	twitterOpts := []twitter.Option{
+		twitter.WithMaxRateLimitWait(time.Millisecond * time.Duration(cfg.Worker.TwitterMaxRateLimitWaitMs)),
+		twitter.WithRetryPolicy(retryPolicy),
+		twitter.WithTweetFields(tweetFields),
+		twitter.WithCredentialPool(credentials),
+		twitter.WithBaseURL(cfg.Worker.TwitterBaseURL),
+	}
+	twitterClient := twitter.New(
+		&http.Client{
+			Timeout: 10 * time.Second,
+		},
+		"",
+		twitterOpts...,
+	)
+
+	// Replicas either split entities between them or elect a single leader polling all of them.
+	// In stream mode the leader holds the stream connection, a filtered stream can't be split.
+	leaderElection := func() worker.Option {
+		leaseTTL := time.Second * time.Duration(cfg.Worker.LeaderLeaseSeconds)
+		elector, err := postgres.NewLeaseElector(db, "poller-worker", replicaID, leaseTTL)
+		if err != nil {
+			log.Fatal(err)
+		}
+		return worker.WithLeaderElector(elector, leaseTTL)
+	}
+
+	var coordination []worker.Option
+	switch {
+	case cfg.Worker.Mode == "stream":
+		if cfg.Worker.ShardingEnabled {
+			log.Fatal("sharding is not supported in stream mode")
+		}
+		// the stream connection is long lived, so it must not be bound by a client timeout
+		coordination = []worker.Option{worker.WithTweetStream(twitter.New(&http.Client{}, "", twitterOpts...)), leaderElection()}
+	case cfg.Worker.Mode != "poll":
+		log.Fatal(fmt.Sprintf("unknown worker mode %q", cfg.Worker.Mode))
+	case cfg.Worker.ShardingEnabled:
+		coordination = []worker.Option{worker.WithSharding(db, replicaID, time.Second*time.Duration(cfg.Worker.ReplicaHeartbeatTTLSeconds))}
+	default:
+		coordination = []worker.Option{leaderElection()}
+	}
+
+	overlapPolicy, err := worker.ParseOverlapPolicy(cfg.Worker.OverlapPolicy)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	opts := []worker.Option{
+		worker.WithInterval(time.Second * time.Duration(cfg.IntervalSeconds)),
+		worker.WithProcessorTimeout(int64(cfg.Worker.ProcessorTimeoutMs)),
+		worker.WithOverlapPolicy(overlapPolicy),
+		worker.WithPoolSize(cfg.Worker.PoolSize),
+		worker.WithMaxEntitiesPerTick(cfg.Worker.MaxEntitiesPerTick),
+		worker.WithMaxPagesPerEntity(cfg.Worker.MaxPagesPerEntity),
+		worker.WithMaxTweetsPerEntity(cfg.Worker.MaxTweetsPerEntity),
+		worker.WithWatermarkStorage(db),
+		worker.WithPendingTweetStorage(db),
+		worker.WithMaxClassifyAttempts(cfg.Worker.MaxClassifyAttempts),
+		worker.WithEntitySettings(db),
+	}
+	opts = append(opts, coordination...)
+
+	if cfg.Worker.AccountSyncIntervalSeconds > 0 {
+		opts = append(opts, worker.WithAccountSync(twitterClient, db, time.Second*time.Duration(cfg.Worker.AccountSyncIntervalSeconds)))
+	}
+
+	sourceClient := &http.Client{
+		Timeout: 10 * time.Second,
+	}
+
+	// cached predictions are served even while the breaker is open
+	breaker, err := predictor.NewBreaker(
+		log,
+		predictor.New(
+			&http.Client{
+				Timeout: 10 * time.Second,
+			},
+			cfg.Worker.PredictorBaseURL,
+			predictor.WithRetryPolicy(retryPolicy),
+			predictor.WithMaxBatchSize(cfg.Worker.PredictorMaxBatchSize),
+			predictor.WithMaxParallelBatches(cfg.Worker.PredictorParallelBatches),
+		),
+		predictor.WithFailureRate(cfg.Worker.BreakerFailureRate, cfg.Worker.BreakerWindow, cfg.Worker.BreakerMinRequests),
+		predictor.WithCoolDown(time.Second*time.Duration(cfg.Worker.BreakerCoolDownSeconds)),
+	)
+	if err != nil {
+		log.Fatal(err)
+	}
+	var classifier predictor.FakeNewsClassifier = breaker
+
+	predictionTTL := time.Second * time.Duration(cfg.Worker.PredictorCacheTTLSeconds)
+	var predictionStore predictor.PredictionStore
+	switch cfg.Worker.PredictorCache {
+	case "memory":
+		predictionStore = predictor.NewMemoryPredictionStore(cfg.Worker.PredictorCacheSize)
+	case "postgres":
+		// expired predictions are deleted by the cache as it goes
+		predictionStore = db
+	case "none":
+	default:
+		log.Fatal(fmt.Errorf("invalid predictor cache: %s", cfg.Worker.PredictorCache))
+	}
+
+	var predictionCache *predictor.Cache
+	if predictionStore != nil {
+		predictionCache, err = predictor.NewCache(log, classifier, predictionStore, predictor.WithTTL(predictionTTL), predictor.WithModelVersion(cfg.Worker.PredictorModelVersion))
+		if err != nil {
+			log.Fatal(err)
+		}
+		classifier = predictionCache
+	}
+
+	if cfg.Worker.PredictorBatchLingerMs > 0 {
+		// tweets of the entities processed in a tick are classified together
+		classifier, err = predictor.NewBatcher(classifier, cfg.Worker.PredictorMaxBatchSize, time.Millisecond*time.Duration(cfg.Worker.PredictorBatchLingerMs))
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+
 	w, err := worker.NewWorker(
 		log,
 		processor.GetProcessFn(
 			log,
-			twitter.New(
-				&http.Client{
-					Timeout: 10 * time.Second,
-				},
-				cfg.Worker.TwitterBearerToken,
-			),
-			predictor.New(
-				&http.Client{
-					Timeout: 10 * time.Second,
-				},
-				cfg.Worker.PredictorBaseURL,
-			),
+			twitterClient,
+			classifier,
+			processor.WithFakeThreshold(cfg.Worker.FakeThreshold),
+			// entities are moved to other sources with rows in the entity_sources table
+			processor.WithSource(database.SourceMastodon, mastodon.New(sourceClient, mastodon.WithRetryPolicy(retryPolicy))),
+			processor.WithSource(database.SourceRSS, rss.New(sourceClient, rss.WithRetryPolicy(retryPolicy))),
 		),
 		event.SendFakeNewsEventFnBuilder(sqsClient, log),
 		db,
-		worker.WithInterval(time.Second*time.Duration(cfg.IntervalSeconds)),
+		opts...,
 	)
 
 	if err != nil {
@@ -97,7 +276,29 @@ func main() {
 	<-signals
 
 	log.Info("Stopping worker")
-	w.Stop()
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*time.Duration(cfg.Worker.ShutdownTimeoutSeconds))
+	defer cancel()
+
+	if err := w.Stop(ctx); err != nil {
+		log.Error(fmt.Sprintf("Worker didn't stop gracefully: %v", err))
+	}
+
+	if predictionCache != nil {
+		stats := predictionCache.Stats()
+		log.Info(fmt.Sprintf("Prediction cache hits: %d, misses: %d, errors: %d", stats.Hits, stats.Misses, stats.Errors))
+	}
+}
+
+// splitList splits a comma separated config value.
+func splitList(value string) []string {
+	items := []string{}
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+
+	return items
 }
 
 func initAWSConfig(region, endpoint string) (aws.Config, error) {
@@ -34,9 +34,48 @@ type (
 
 	// Worker -.
 	Worker struct {
-		IntervalSeconds    int    `env-required:"true" yaml:"interval_seconds" env:"WORKER_INTERVAL_SECONDS"`
-		TwitterBearerToken string `env-required:"true" yaml:"twitter_bearer_token" env:"TWITTER_BEARER_TOKEN"`
-		PredictorBaseURL   string `env-required:"true" yaml:"predictor_base_url" env:"PREDICTOR_BASE_URL"`
+		IntervalSeconds            int     `env-required:"true" yaml:"interval_seconds" env:"WORKER_INTERVAL_SECONDS"`
+		TwitterBearerToken         string  `yaml:"twitter_bearer_token" env:"TWITTER_BEARER_TOKEN"`
+		PredictorBaseURL           string  `env-required:"true" yaml:"predictor_base_url" env:"PREDICTOR_BASE_URL"`
+		FakeThreshold              float64 `env-default:"0.5" yaml:"fake_threshold" env:"WORKER_FAKE_THRESHOLD"`
+		PredictorMaxBatchSize      int     `env-default:"100" yaml:"predictor_max_batch_size" env:"PREDICTOR_MAX_BATCH_SIZE"`
+		PredictorParallelBatches   int     `env-default:"4" yaml:"predictor_parallel_batches" env:"PREDICTOR_PARALLEL_BATCHES"`
+		PredictorBatchLingerMs     int     `env-default:"50" yaml:"predictor_batch_linger_ms" env:"PREDICTOR_BATCH_LINGER_MS"`
+		PredictorCache             string  `env-default:"memory" yaml:"predictor_cache" env:"PREDICTOR_CACHE"`
+		PredictorCacheSize         int     `env-default:"10000" yaml:"predictor_cache_size" env:"PREDICTOR_CACHE_SIZE"`
+		PredictorCacheTTLSeconds   int     `env-default:"86400" yaml:"predictor_cache_ttl_seconds" env:"PREDICTOR_CACHE_TTL_SECONDS"`
+		PredictorModelVersion      string  `yaml:"predictor_model_version" env:"PREDICTOR_MODEL_VERSION"`
+		BreakerFailureRate         float64 `env-default:"0.5" yaml:"predictor_breaker_failure_rate" env:"PREDICTOR_BREAKER_FAILURE_RATE"`
+		BreakerWindow              int     `env-default:"20" yaml:"predictor_breaker_window" env:"PREDICTOR_BREAKER_WINDOW"`
+		BreakerMinRequests         int     `env-default:"5" yaml:"predictor_breaker_min_requests" env:"PREDICTOR_BREAKER_MIN_REQUESTS"`
+		BreakerCoolDownSeconds     int     `env-default:"30" yaml:"predictor_breaker_cool_down_seconds" env:"PREDICTOR_BREAKER_COOL_DOWN_SECONDS"`
+		TwitterMaxRateLimitWaitMs  int     `env-default:"5000" yaml:"twitter_max_rate_limit_wait_ms" env:"TWITTER_MAX_RATE_LIMIT_WAIT_MS"`
+		ShutdownTimeoutSeconds     int     `env-default:"30" yaml:"shutdown_timeout_seconds" env:"WORKER_SHUTDOWN_TIMEOUT_SECONDS"`
+		LeaderLeaseSeconds         int     `env-default:"30" yaml:"leader_lease_seconds" env:"WORKER_LEADER_LEASE_SECONDS"`
+		RetryMaxAttempts           int     `env-default:"3" yaml:"retry_max_attempts" env:"WORKER_RETRY_MAX_ATTEMPTS"`
+		RetryInitialBackoffMs      int     `env-default:"200" yaml:"retry_initial_backoff_ms" env:"WORKER_RETRY_INITIAL_BACKOFF_MS"`
+		RetryMaxBackoffMs          int     `env-default:"5000" yaml:"retry_max_backoff_ms" env:"WORKER_RETRY_MAX_BACKOFF_MS"`
+		RetryJitter                float64 `env-default:"0.2" yaml:"retry_jitter" env:"WORKER_RETRY_JITTER"`
+		PoolSize                   int     `env-default:"10" yaml:"pool_size" env:"WORKER_POOL_SIZE"`
+		MaxEntitiesPerTick         int     `env-default:"0" yaml:"max_entities_per_tick" env:"WORKER_MAX_ENTITIES_PER_TICK"`
+		MaxPagesPerEntity          int     `env-default:"0" yaml:"max_pages_per_entity" env:"WORKER_MAX_PAGES_PER_ENTITY"`
+		MaxTweetsPerEntity         int     `env-default:"1000" yaml:"max_tweets_per_entity" env:"WORKER_MAX_TWEETS_PER_ENTITY"`
+		MaxClassifyAttempts        int     `env-default:"5" yaml:"max_classify_attempts" env:"WORKER_MAX_CLASSIFY_ATTEMPTS"`
+		OverlapPolicy              string  `env-default:"skip" yaml:"overlap_policy" env:"WORKER_OVERLAP_POLICY"`
+		ProcessorTimeoutMs         int     `env-default:"10000" yaml:"processor_timeout_ms" env:"WORKER_PROCESSOR_TIMEOUT_MS"`
+		ShardingEnabled            bool    `env-default:"false" yaml:"sharding_enabled" env:"WORKER_SHARDING_ENABLED"`
+		ReplicaHeartbeatTTLSeconds int     `env-default:"30" yaml:"replica_heartbeat_ttl_seconds" env:"WORKER_REPLICA_HEARTBEAT_TTL_SECONDS"`
+		Mode                       string  `env-default:"poll" yaml:"mode" env:"WORKER_MODE"`
+		AccountSyncIntervalSeconds int     `env-default:"3600" yaml:"account_sync_interval_seconds" env:"WORKER_ACCOUNT_SYNC_INTERVAL_SECONDS"`
+		TwitterTweetFields         string  `yaml:"twitter_tweet_fields" env:"TWITTER_TWEET_FIELDS"`
+		TwitterExpansions          string  `yaml:"twitter_expansions" env:"TWITTER_EXPANSIONS"`
+		TwitterBearerTokens        string  `yaml:"twitter_bearer_tokens" env:"TWITTER_BEARER_TOKENS"`
+		TwitterBearerTokensFile    string  `yaml:"twitter_bearer_tokens_file" env:"TWITTER_BEARER_TOKENS_FILE"`
+		TwitterQuarantineSeconds   int     `env-default:"3600" yaml:"twitter_token_quarantine_seconds" env:"TWITTER_TOKEN_QUARANTINE_SECONDS"`
+		TwitterConsumerKey         string  `yaml:"twitter_consumer_key" env:"TWITTER_CONSUMER_KEY"`
+		TwitterConsumerSecret      string  `yaml:"twitter_consumer_secret" env:"TWITTER_CONSUMER_SECRET"`
+		TwitterTokenURL            string  `env-default:"https://api.twitter.com/oauth2/token" yaml:"twitter_token_url" env:"TWITTER_TOKEN_URL"`
+		TwitterBaseURL             string  `env-default:"https://api.twitter.com" yaml:"twitter_base_url" env:"TWITTER_BASE_URL"`
 	}
 
 	// FakeNewsQueue holds configuration for `FakeNewsQueue` queue.
@@ -1,14 +1,177 @@
 package database
 
-import "context"
+import (
+	"context"
+	"time"
+)
 
 //go:generate mockery --inpackage --case snake --disable-version-string --name "EntityStorage"
 type EntityStorage interface {
 	GetEntities(context.Context) ([]Entity, error)
 }
 
+//go:generate mockery --inpackage --case snake --disable-version-string --name "WatermarkStorage"
+type WatermarkStorage interface {
+	// GetWatermarks returns stored watermarks keyed by entity ID.
+	GetWatermarks(context.Context) (map[string]Watermark, error)
+	SaveWatermarks(context.Context, []Watermark) error
+}
+
+//go:generate mockery --inpackage --case snake --disable-version-string --name "LeaderElector"
+type LeaderElector interface {
+	// IsLeader acquires or renews leadership and reports whether this instance currently holds it.
+	IsLeader(context.Context) (bool, error)
+	// Resign gives up leadership so another instance can take over without waiting for it to expire.
+	Resign(context.Context) error
+}
+
+//go:generate mockery --inpackage --case snake --disable-version-string --name "ReplicaRegistry"
+type ReplicaRegistry interface {
+	// Heartbeat marks the replica as alive and returns IDs of all replicas seen within ttl.
+	Heartbeat(ctx context.Context, replicaID string, ttl time.Duration) ([]string, error)
+	// Deregister removes the replica so the remaining ones rebalance right away.
+	Deregister(ctx context.Context, replicaID string) error
+}
+
+//go:generate mockery --inpackage --case snake --disable-version-string --name "AccountStorage"
+type AccountStorage interface {
+	// GetAccounts returns stored Twitter accounts keyed by entity ID.
+	GetAccounts(context.Context) (map[string]Account, error)
+	SaveAccounts(context.Context, []Account) error
+	// SetTwitterID stores the Twitter user ID the entity's username resolved to.
+	SetTwitterID(ctx context.Context, entityID, twitterID string) error
+}
+
+//go:generate mockery --inpackage --case snake --disable-version-string --name "SettingsStorage"
+type SettingsStorage interface {
+	// GetSettings returns settings of the entities that have any, keyed by entity ID.
+	GetSettings(context.Context) (map[string]EntitySettings, error)
+}
+
+//go:generate mockery --inpackage --case snake --disable-version-string --name "PendingTweetStorage"
+type PendingTweetStorage interface {
+	// GetPendingTweets returns pending tweets of the entities, oldest first.
+	GetPendingTweets(ctx context.Context, entityIDs []string) ([]PendingTweet, error)
+	// SavePendingTweets adds the tweets, or updates the attempts and next attempt of the ones already pending.
+	SavePendingTweets(context.Context, []PendingTweet) error
+	DeletePendingTweets(context.Context, []PendingTweet) error
+	// DeletePendingTweetsExcept drops pending tweets of all entities but the given ones, e.g. of deleted entities.
+	DeletePendingTweetsExcept(ctx context.Context, entityIDs []string) error
+}
+
 type Entity struct {
 	ID          string
 	TwitterId   string
 	DisplayName string
+	// Source is where posts of the entity are fetched from, empty means Twitter
+	Source SourceType
+	// SourceAccount identifies the entity on sources other than Twitter, e.g. a Mastodon handle or a feed URL
+	SourceAccount string
+}
+
+// AccountID identifies the entity on its source, jobs and their results refer to entities by it.
+func (e Entity) AccountID() string {
+	if e.IsTwitter() {
+		return e.TwitterId
+	}
+
+	return e.SourceAccount
+}
+
+func (e Entity) IsTwitter() bool {
+	return e.Source == "" || e.Source == SourceTwitter
+}
+
+type SourceType string
+
+const (
+	SourceTwitter  SourceType = "twitter"
+	SourceMastodon SourceType = "mastodon"
+	SourceRSS      SourceType = "rss"
+)
+
+// Watermark records how far the tweets of an entity have been successfully processed.
+type Watermark struct {
+	EntityID string
+	// Source is the source the watermark was recorded on, IDs and times of one source mean nothing on another
+	Source         SourceType
+	LastTweetID    string
+	LastTweetTime  time.Time
+	ProcessedUntil time.Time
+	// CatchUpSinceID, CatchUpUntilID and CatchUpStartTime describe the tweets left out by a truncated job,
+	// those newer than CatchUpSinceID, or posted since CatchUpStartTime, and older than CatchUpUntilID.
+	// The gap is empty when CatchUpUntilID is.
+	CatchUpSinceID   string
+	CatchUpUntilID   string
+	CatchUpStartTime time.Time
+}
+
+type AccountStatus string
+
+const (
+	AccountActive AccountStatus = "active"
+	// AccountRenamed accounts are still processed, the status only flags the changed username.
+	AccountRenamed   AccountStatus = "renamed"
+	AccountSuspended AccountStatus = "suspended"
+	AccountDeleted   AccountStatus = "deleted"
+	// AccountUnresolved means no Twitter user has the username of the entity.
+	AccountUnresolved AccountStatus = "unresolved"
+)
+
+// Available reports whether tweets of the account can be fetched.
+func (s AccountStatus) Available() bool {
+	return s != AccountSuspended && s != AccountDeleted && s != AccountUnresolved
+}
+
+// Account is the Twitter account of an entity. Operators register it by Username,
+// TwitterID and Status are kept in sync with Twitter by the worker.
+type Account struct {
+	EntityID  string
+	Username  string
+	TwitterID string
+	Status    AccountStatus
+	CheckedAt time.Time
+}
+
+// TweetTypeMode decides how tweets of a type, e.g. retweets, are analyzed.
+type TweetTypeMode string
+
+const (
+	// TweetsIncluded tweets are classified as they are, the default.
+	TweetsIncluded TweetTypeMode = "include"
+	// TweetsExcluded tweets aren't classified.
+	TweetsExcluded TweetTypeMode = "exclude"
+	// TweetsOriginal tweets are replaced with the tweet they reference, e.g. the retweeted one.
+	TweetsOriginal TweetTypeMode = "original"
+)
+
+func (m TweetTypeMode) Valid() bool {
+	return m == "" || m == TweetsIncluded || m == TweetsExcluded || m == TweetsOriginal
+}
+
+// EntitySettings control which tweets of an entity are analyzed. Entities without settings
+// have all their tweets classified.
+type EntitySettings struct {
+	EntityID string
+	Retweets TweetTypeMode
+	Replies  TweetTypeMode
+	// FakeThreshold is the predictor score from which tweets of the entity count as fake news, 0 means the global one
+	FakeThreshold float64
+}
+
+// PendingTweet is a fetched tweet the predictor failed to classify, kept to be classified on a later tick.
+// Tweets are identified by the entity and TweetID.
+type PendingTweet struct {
+	// EntityID identifies the entity on its source, like the job requests do
+	EntityID string
+	Source   SourceType
+	TweetID  string
+	// Payload is the serialized tweet, or post of the other sources, as the worker classifies it
+	Payload []byte
+	// Attempts counts the failed classifications of the tweet, not counting the ones failed while
+	// the predictor was unavailable
+	Attempts int
+	// NextAttemptAt is when the tweet is classified again, zero means on the next tick
+	NextAttemptAt time.Time
+	CreatedAt     time.Time
 }
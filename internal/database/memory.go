@@ -0,0 +1,121 @@
+package database
+
+import (
+	"context"
+	"sort"
+	"sync"
+)
+
+var _ WatermarkStorage = &MemoryWatermarkStorage{}
+var _ PendingTweetStorage = &MemoryPendingTweetStorage{}
+
+// MemoryWatermarkStorage keeps watermarks in memory, they are lost when the process exits.
+type MemoryWatermarkStorage struct {
+	mu         sync.Mutex
+	watermarks map[string]Watermark
+}
+
+func NewMemoryWatermarkStorage() *MemoryWatermarkStorage {
+	return &MemoryWatermarkStorage{
+		watermarks: map[string]Watermark{},
+	}
+}
+
+func (s *MemoryWatermarkStorage) GetWatermarks(context.Context) (map[string]Watermark, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	watermarks := make(map[string]Watermark, len(s.watermarks))
+	for id, w := range s.watermarks {
+		watermarks[id] = w
+	}
+
+	return watermarks, nil
+}
+
+func (s *MemoryWatermarkStorage) SaveWatermarks(_ context.Context, watermarks []Watermark) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, w := range watermarks {
+		s.watermarks[w.EntityID] = w
+	}
+
+	return nil
+}
+
+// MemoryPendingTweetStorage keeps pending tweets in memory, they are lost when the process exits.
+type MemoryPendingTweetStorage struct {
+	mu     sync.Mutex
+	tweets map[string]map[string]PendingTweet
+}
+
+func NewMemoryPendingTweetStorage() *MemoryPendingTweetStorage {
+	return &MemoryPendingTweetStorage{
+		tweets: map[string]map[string]PendingTweet{},
+	}
+}
+
+func (s *MemoryPendingTweetStorage) GetPendingTweets(_ context.Context, entityIDs []string) ([]PendingTweet, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	pending := []PendingTweet{}
+	for _, id := range entityIDs {
+		for _, t := range s.tweets[id] {
+			pending = append(pending, t)
+		}
+	}
+
+	sort.SliceStable(pending, func(i, j int) bool {
+		return pending[i].CreatedAt.Before(pending[j].CreatedAt)
+	})
+
+	return pending, nil
+}
+
+func (s *MemoryPendingTweetStorage) SavePendingTweets(_ context.Context, tweets []PendingTweet) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, t := range tweets {
+		if s.tweets[t.EntityID] == nil {
+			s.tweets[t.EntityID] = map[string]PendingTweet{}
+		}
+		s.tweets[t.EntityID][t.TweetID] = t
+	}
+
+	return nil
+}
+
+func (s *MemoryPendingTweetStorage) DeletePendingTweets(_ context.Context, tweets []PendingTweet) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, t := range tweets {
+		delete(s.tweets[t.EntityID], t.TweetID)
+		if len(s.tweets[t.EntityID]) == 0 {
+			delete(s.tweets, t.EntityID)
+		}
+	}
+
+	return nil
+}
+
+func (s *MemoryPendingTweetStorage) DeletePendingTweetsExcept(_ context.Context, entityIDs []string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	keep := make(map[string]bool, len(entityIDs))
+	for _, id := range entityIDs {
+		keep[id] = true
+	}
+
+	for id := range s.tweets {
+		if !keep[id] {
+			delete(s.tweets, id)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,76 @@
+package postgres
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	model "github.com/kordape/ottct-main-service/pkg/db"
+	"github.com/kordape/ottct-poller-service/internal/database"
+	"gorm.io/gorm/clause"
+)
+
+var _ database.AccountStorage = &DB{}
+
+type account struct {
+	EntityID  string `gorm:"primaryKey"`
+	Username  string
+	TwitterID string
+	Status    string
+	CheckedAt time.Time
+	UpdatedAt time.Time
+}
+
+func (db *DB) GetAccounts(ctx context.Context) (map[string]database.Account, error) {
+	var persistentAccounts []account
+	err := db.db.WithContext(ctx).Find(&persistentAccounts).Error
+	if err != nil {
+		return nil, fmt.Errorf("Error getting accounts from db: %w", err)
+	}
+
+	accounts := make(map[string]database.Account, len(persistentAccounts))
+	for _, a := range persistentAccounts {
+		accounts[a.EntityID] = database.Account{
+			EntityID:  a.EntityID,
+			Username:  a.Username,
+			TwitterID: a.TwitterID,
+			Status:    database.AccountStatus(a.Status),
+			CheckedAt: a.CheckedAt,
+		}
+	}
+
+	return accounts, nil
+}
+
+func (db *DB) SaveAccounts(ctx context.Context, accounts []database.Account) error {
+	if len(accounts) == 0 {
+		return nil
+	}
+
+	persistentAccounts := make([]account, len(accounts))
+	for i, a := range accounts {
+		persistentAccounts[i] = account{
+			EntityID:  a.EntityID,
+			Username:  a.Username,
+			TwitterID: a.TwitterID,
+			Status:    string(a.Status),
+			CheckedAt: a.CheckedAt,
+		}
+	}
+
+	err := db.db.WithContext(ctx).Clauses(clause.OnConflict{UpdateAll: true}).Create(&persistentAccounts).Error
+	if err != nil {
+		return fmt.Errorf("Error saving accounts to db: %w", err)
+	}
+
+	return nil
+}
+
+func (db *DB) SetTwitterID(ctx context.Context, entityID, twitterID string) error {
+	err := db.db.WithContext(ctx).Model(&model.Entity{}).Where("id = ?", entityID).Update("twitter_id", twitterID).Error
+	if err != nil {
+		return fmt.Errorf("Error setting twitter ID of entity %s: %w", entityID, err)
+	}
+
+	return nil
+}
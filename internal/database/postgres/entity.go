@@ -8,6 +8,18 @@ import (
 	"github.com/kordape/ottct-poller-service/internal/database"
 )
 
+// entitySource rows are managed by operators and move entities from Twitter to another source.
+type entitySource struct {
+	EntityID string `gorm:"primaryKey"`
+	Source   string `gorm:"not null"`
+	// Account is a Mastodon handle or profile URL, or a feed URL
+	Account string `gorm:"not null"`
+}
+
+func (entitySource) TableName() string {
+	return "entity_sources"
+}
+
 func (db *DB) GetEntities(ctx context.Context) ([]database.Entity, error) {
 	var persistentEntities []model.Entity
 	err := db.db.WithContext(ctx).Find(&persistentEntities).Error
@@ -15,12 +27,29 @@ func (db *DB) GetEntities(ctx context.Context) ([]database.Entity, error) {
 		return nil, fmt.Errorf("Error getting entities from db: %w", err)
 	}
 
+	var persistentSources []entitySource
+	err = db.db.WithContext(ctx).Find(&persistentSources).Error
+	if err != nil {
+		return nil, fmt.Errorf("Error getting entity sources from db: %w", err)
+	}
+
+	sources := make(map[string]entitySource, len(persistentSources))
+	for _, s := range persistentSources {
+		sources[s.EntityID] = s
+	}
+
 	entities := make([]database.Entity, len(persistentEntities))
 	for i, e := range persistentEntities {
 		entities[i] = database.Entity{
 			ID:          e.ID,
 			TwitterId:   e.TwitterId,
 			DisplayName: e.DisplayName,
+			Source:      database.SourceTwitter,
+		}
+
+		if s, ok := sources[e.ID]; ok {
+			entities[i].Source = database.SourceType(s.Source)
+			entities[i].SourceAccount = s.Account
 		}
 	}
 
@@ -0,0 +1,102 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/kordape/ottct-poller-service/internal/database"
+)
+
+const (
+	acquireLeaseQuery = `
+INSERT INTO leases (name, holder, expires_at)
+VALUES (?, ?, now() + ? * interval '1 millisecond')
+ON CONFLICT (name) DO UPDATE
+SET holder = EXCLUDED.holder, expires_at = EXCLUDED.expires_at
+WHERE leases.holder = EXCLUDED.holder OR leases.expires_at < now()`
+
+	releaseLeaseQuery = `DELETE FROM leases WHERE name = ? AND holder = ?`
+)
+
+var _ database.LeaderElector = &LeaseElector{}
+
+type lease struct {
+	Name      string `gorm:"primaryKey"`
+	Holder    string
+	ExpiresAt time.Time
+}
+
+// AcquireLease takes or renews the named lease for holder and reports whether holder owns it.
+// Expiration is computed with the database clock so replicas don't depend on their own clocks.
+func (db *DB) AcquireLease(ctx context.Context, name, holder string, ttl time.Duration) (bool, error) {
+	result := db.db.WithContext(ctx).Exec(acquireLeaseQuery, name, holder, ttl.Milliseconds())
+	if result.Error != nil {
+		return false, fmt.Errorf("Error acquiring lease %s: %w", name, result.Error)
+	}
+
+	return result.RowsAffected == 1, nil
+}
+
+// ReleaseLease drops the named lease if it is held by holder.
+func (db *DB) ReleaseLease(ctx context.Context, name, holder string) error {
+	err := db.db.WithContext(ctx).Exec(releaseLeaseQuery, name, holder).Error
+	if err != nil {
+		return fmt.Errorf("Error releasing lease %s: %w", name, err)
+	}
+
+	return nil
+}
+
+// LeaseElector elects a leader among replicas sharing the same lease name. The leader has to
+// renew the lease before ttl runs out, otherwise any other replica takes over.
+type LeaseElector struct {
+	db     *DB
+	name   string
+	holder string
+	ttl    time.Duration
+}
+
+func NewLeaseElector(db *DB, name, holder string, ttl time.Duration) (*LeaseElector, error) {
+	e := &LeaseElector{
+		db:     db,
+		name:   name,
+		holder: holder,
+		ttl:    ttl,
+	}
+
+	if err := e.validate(); err != nil {
+		return nil, fmt.Errorf("Failed to initialize lease elector: %v", err)
+	}
+
+	return e, nil
+}
+
+func (e *LeaseElector) validate() error {
+	if e.db == nil {
+		return errors.New("validation error: db is nil")
+	}
+
+	if e.name == "" {
+		return errors.New("validation error: lease name is empty")
+	}
+
+	if e.holder == "" {
+		return errors.New("validation error: holder is empty")
+	}
+
+	if e.ttl <= 0 {
+		return errors.New("validation error: ttl must be positive")
+	}
+
+	return nil
+}
+
+func (e *LeaseElector) IsLeader(ctx context.Context) (bool, error) {
+	return e.db.AcquireLease(ctx, e.name, e.holder, e.ttl)
+}
+
+func (e *LeaseElector) Resign(ctx context.Context) error {
+	return e.db.ReleaseLease(ctx, e.name, e.holder)
+}
@@ -31,6 +31,119 @@ func (db *DB) Migrate() error {
 				return tx.Exec(seed202303301900).Error
 			},
 		},
+		{
+			ID: "watermark-schema-202610181000",
+			Migrate: func(tx *gorm.DB) error {
+				return tx.AutoMigrate(&watermark{})
+			},
+			Rollback: func(tx *gorm.DB) error {
+				return tx.Migrator().DropTable("watermarks")
+			},
+		},
+		{
+			ID: "lease-schema-202610181100",
+			Migrate: func(tx *gorm.DB) error {
+				return tx.AutoMigrate(&lease{})
+			},
+			Rollback: func(tx *gorm.DB) error {
+				return tx.Migrator().DropTable("leases")
+			},
+		},
+		{
+			ID: "replica-schema-202610181200",
+			Migrate: func(tx *gorm.DB) error {
+				return tx.AutoMigrate(&replica{})
+			},
+			Rollback: func(tx *gorm.DB) error {
+				return tx.Migrator().DropTable("replicas")
+			},
+		},
+		{
+			ID: "account-schema-202610181300",
+			Migrate: func(tx *gorm.DB) error {
+				return tx.AutoMigrate(&account{})
+			},
+			Rollback: func(tx *gorm.DB) error {
+				return tx.Migrator().DropTable("accounts")
+			},
+		},
+		{
+			ID: "entity-settings-schema-202610181400",
+			Migrate: func(tx *gorm.DB) error {
+				return tx.AutoMigrate(&entitySettings{})
+			},
+			Rollback: func(tx *gorm.DB) error {
+				return tx.Migrator().DropTable("entity_settings")
+			},
+		},
+		{
+			ID: "entity-source-schema-202610181500",
+			Migrate: func(tx *gorm.DB) error {
+				return tx.AutoMigrate(&entitySource{})
+			},
+			Rollback: func(tx *gorm.DB) error {
+				return tx.Migrator().DropTable("entity_sources")
+			},
+		},
+		{
+			ID: "watermark-catch-up-schema-202610181600",
+			Migrate: func(tx *gorm.DB) error {
+				return tx.AutoMigrate(&watermark{})
+			},
+			Rollback: func(tx *gorm.DB) error {
+				for _, column := range []string{"catch_up_since_id", "catch_up_until_id", "catch_up_start_time"} {
+					if err := tx.Migrator().DropColumn(&watermark{}, column); err != nil {
+						return err
+					}
+				}
+				return nil
+			},
+		},
+		{
+			ID: "entity-settings-threshold-schema-202610181700",
+			Migrate: func(tx *gorm.DB) error {
+				return tx.AutoMigrate(&entitySettings{})
+			},
+			Rollback: func(tx *gorm.DB) error {
+				return tx.Migrator().DropColumn(&entitySettings{}, "fake_threshold")
+			},
+		},
+		{
+			ID: "prediction-schema-202610181800",
+			Migrate: func(tx *gorm.DB) error {
+				return tx.AutoMigrate(&prediction{})
+			},
+			Rollback: func(tx *gorm.DB) error {
+				return tx.Migrator().DropTable("predictions")
+			},
+		},
+		{
+			ID: "pending-tweet-schema-202610181900",
+			Migrate: func(tx *gorm.DB) error {
+				return tx.AutoMigrate(&pendingTweet{})
+			},
+			Rollback: func(tx *gorm.DB) error {
+				return tx.Migrator().DropTable("pending_tweets")
+			},
+		},
+		{
+			ID: "pending-tweet-next-attempt-schema-202610182000",
+			Migrate: func(tx *gorm.DB) error {
+				return tx.AutoMigrate(&pendingTweet{})
+			},
+			Rollback: func(tx *gorm.DB) error {
+				return tx.Migrator().DropColumn(&pendingTweet{}, "next_attempt_at")
+			},
+		},
+		{
+			ID: "watermark-source-schema-202610182100",
+			Migrate: func(tx *gorm.DB) error {
+				return tx.AutoMigrate(&watermark{})
+			},
+			Rollback: func(tx *gorm.DB) error {
+				return tx.Migrator().DropColumn(&watermark{}, "source")
+			},
+		},
 	})
 
 	if err := m.Migrate(); err != nil {
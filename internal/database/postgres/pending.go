@@ -0,0 +1,100 @@
+package postgres
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/kordape/ottct-poller-service/internal/database"
+	"gorm.io/gorm/clause"
+)
+
+var _ database.PendingTweetStorage = &DB{}
+
+type pendingTweet struct {
+	EntityID      string `gorm:"primaryKey"`
+	TweetID       string `gorm:"primaryKey"`
+	Source        string
+	Payload       string
+	Attempts      int
+	NextAttemptAt time.Time
+	CreatedAt     time.Time
+}
+
+func (db *DB) GetPendingTweets(ctx context.Context, entityIDs []string) ([]database.PendingTweet, error) {
+	var persistentTweets []pendingTweet
+	err := db.db.WithContext(ctx).Where("entity_id IN ?", entityIDs).Order("created_at").Find(&persistentTweets).Error
+	if err != nil {
+		return nil, fmt.Errorf("Error getting pending tweets from db: %w", err)
+	}
+
+	tweets := make([]database.PendingTweet, len(persistentTweets))
+	for i, t := range persistentTweets {
+		tweets[i] = database.PendingTweet{
+			EntityID:      t.EntityID,
+			Source:        database.SourceType(t.Source),
+			TweetID:       t.TweetID,
+			Attempts:      t.Attempts,
+			Payload:       []byte(t.Payload),
+			NextAttemptAt: t.NextAttemptAt,
+			CreatedAt:     t.CreatedAt,
+		}
+	}
+
+	return tweets, nil
+}
+
+func (db *DB) SavePendingTweets(ctx context.Context, tweets []database.PendingTweet) error {
+	if len(tweets) == 0 {
+		return nil
+	}
+
+	persistentTweets := make([]pendingTweet, len(tweets))
+	for i, t := range tweets {
+		persistentTweets[i] = pendingTweet{
+			EntityID:      t.EntityID,
+			TweetID:       t.TweetID,
+			Source:        string(t.Source),
+			Payload:       string(t.Payload),
+			Attempts:      t.Attempts,
+			NextAttemptAt: t.NextAttemptAt,
+			CreatedAt:     t.CreatedAt,
+		}
+	}
+
+	err := db.db.WithContext(ctx).Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "entity_id"}, {Name: "tweet_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"attempts", "next_attempt_at"}),
+	}).Create(&persistentTweets).Error
+	if err != nil {
+		return fmt.Errorf("Error saving pending tweets to db: %w", err)
+	}
+
+	return nil
+}
+
+func (db *DB) DeletePendingTweets(ctx context.Context, tweets []database.PendingTweet) error {
+	for _, t := range tweets {
+		err := db.db.WithContext(ctx).Where("entity_id = ? AND tweet_id = ?", t.EntityID, t.TweetID).Delete(&pendingTweet{}).Error
+		if err != nil {
+			return fmt.Errorf("Error deleting pending tweets from db: %w", err)
+		}
+	}
+
+	return nil
+}
+
+func (db *DB) DeletePendingTweetsExcept(ctx context.Context, entityIDs []string) error {
+	query := db.db.WithContext(ctx)
+	if len(entityIDs) > 0 {
+		query = query.Where("entity_id NOT IN ?", entityIDs)
+	} else {
+		query = query.Where("1 = 1")
+	}
+
+	if err := query.Delete(&pendingTweet{}).Error; err != nil {
+		return fmt.Errorf("Error deleting pending tweets from db: %w", err)
+	}
+
+	return nil
+}
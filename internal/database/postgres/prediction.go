@@ -0,0 +1,75 @@
+package postgres
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/kordape/ottct-poller-service/pkg/predictor"
+	"gorm.io/gorm/clause"
+)
+
+var _ predictor.ExpiringPredictionStore = &DB{}
+
+// prediction rows are keyed by the hash of the normalized text and the model version, see predictor.CacheKey.
+type prediction struct {
+	Key            string `gorm:"primaryKey"`
+	Classification int
+	Score          float64
+	CreatedAt      time.Time
+}
+
+func (db *DB) GetPredictions(ctx context.Context, keys []string) (map[string]predictor.CachedPrediction, error) {
+	var persistentPredictions []prediction
+	err := db.db.WithContext(ctx).Where("key IN ?", keys).Find(&persistentPredictions).Error
+	if err != nil {
+		return nil, fmt.Errorf("Error getting predictions from db: %w", err)
+	}
+
+	predictions := make(map[string]predictor.CachedPrediction, len(persistentPredictions))
+	for _, p := range persistentPredictions {
+		predictions[p.Key] = predictor.CachedPrediction{
+			Key: p.Key,
+			Prediction: predictor.Prediction{
+				Classification: predictor.Classification(p.Classification),
+				Score:          p.Score,
+			},
+			CreatedAt: p.CreatedAt,
+		}
+	}
+
+	return predictions, nil
+}
+
+func (db *DB) SavePredictions(ctx context.Context, predictions []predictor.CachedPrediction) error {
+	if len(predictions) == 0 {
+		return nil
+	}
+
+	persistentPredictions := make([]prediction, len(predictions))
+	for i, p := range predictions {
+		persistentPredictions[i] = prediction{
+			Key:            p.Key,
+			Classification: int(p.Prediction.Classification),
+			Score:          p.Prediction.Score,
+			CreatedAt:      p.CreatedAt,
+		}
+	}
+
+	err := db.db.WithContext(ctx).Clauses(clause.OnConflict{UpdateAll: true}).Create(&persistentPredictions).Error
+	if err != nil {
+		return fmt.Errorf("Error saving predictions to db: %w", err)
+	}
+
+	return nil
+}
+
+// DeletePredictionsBefore drops predictions created before the given time, e.g. the expired ones.
+func (db *DB) DeletePredictionsBefore(ctx context.Context, before time.Time) error {
+	err := db.db.WithContext(ctx).Where("created_at < ?", before).Delete(&prediction{}).Error
+	if err != nil {
+		return fmt.Errorf("Error deleting predictions from db: %w", err)
+	}
+
+	return nil
+}
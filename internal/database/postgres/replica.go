@@ -0,0 +1,52 @@
+package postgres
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/kordape/ottct-poller-service/internal/database"
+)
+
+const (
+	heartbeatQuery = `
+INSERT INTO replicas (id, last_seen_at)
+VALUES (?, now())
+ON CONFLICT (id) DO UPDATE
+SET last_seen_at = EXCLUDED.last_seen_at`
+)
+
+var _ database.ReplicaRegistry = &DB{}
+
+type replica struct {
+	ID         string `gorm:"primaryKey"`
+	LastSeenAt time.Time
+}
+
+func (db *DB) Heartbeat(ctx context.Context, replicaID string, ttl time.Duration) ([]string, error) {
+	err := db.db.WithContext(ctx).Exec(heartbeatQuery, replicaID).Error
+	if err != nil {
+		return nil, fmt.Errorf("Error recording heartbeat: %w", err)
+	}
+
+	var replicas []string
+	err = db.db.WithContext(ctx).
+		Model(&replica{}).
+		Where("last_seen_at > now() - ? * interval '1 millisecond'", ttl.Milliseconds()).
+		Order("id").
+		Pluck("id", &replicas).Error
+	if err != nil {
+		return nil, fmt.Errorf("Error getting live replicas from db: %w", err)
+	}
+
+	return replicas, nil
+}
+
+func (db *DB) Deregister(ctx context.Context, replicaID string) error {
+	err := db.db.WithContext(ctx).Delete(&replica{ID: replicaID}).Error
+	if err != nil {
+		return fmt.Errorf("Error deregistering replica: %w", err)
+	}
+
+	return nil
+}
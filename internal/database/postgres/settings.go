@@ -0,0 +1,42 @@
+package postgres
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/kordape/ottct-poller-service/internal/database"
+)
+
+var _ database.SettingsStorage = &DB{}
+
+// entitySettings rows are managed by operators, the poller only reads them.
+type entitySettings struct {
+	EntityID      string `gorm:"primaryKey"`
+	Retweets      string `gorm:"default:include"`
+	Replies       string `gorm:"default:include"`
+	FakeThreshold float64
+}
+
+func (entitySettings) TableName() string {
+	return "entity_settings"
+}
+
+func (db *DB) GetSettings(ctx context.Context) (map[string]database.EntitySettings, error) {
+	var persistentSettings []entitySettings
+	err := db.db.WithContext(ctx).Find(&persistentSettings).Error
+	if err != nil {
+		return nil, fmt.Errorf("Error getting entity settings from db: %w", err)
+	}
+
+	settings := make(map[string]database.EntitySettings, len(persistentSettings))
+	for _, s := range persistentSettings {
+		settings[s.EntityID] = database.EntitySettings{
+			EntityID:      s.EntityID,
+			Retweets:      database.TweetTypeMode(s.Retweets),
+			Replies:       database.TweetTypeMode(s.Replies),
+			FakeThreshold: s.FakeThreshold,
+		}
+	}
+
+	return settings, nil
+}
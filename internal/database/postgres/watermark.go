@@ -0,0 +1,75 @@
+package postgres
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/kordape/ottct-poller-service/internal/database"
+	"gorm.io/gorm/clause"
+)
+
+var _ database.WatermarkStorage = &DB{}
+
+type watermark struct {
+	EntityID         string `gorm:"primaryKey"`
+	Source           string
+	LastTweetID      string
+	LastTweetTime    time.Time
+	ProcessedUntil   time.Time
+	CatchUpSinceID   string
+	CatchUpUntilID   string
+	CatchUpStartTime time.Time
+	UpdatedAt        time.Time
+}
+
+func (db *DB) GetWatermarks(ctx context.Context) (map[string]database.Watermark, error) {
+	var persistentWatermarks []watermark
+	err := db.db.WithContext(ctx).Find(&persistentWatermarks).Error
+	if err != nil {
+		return nil, fmt.Errorf("Error getting watermarks from db: %w", err)
+	}
+
+	watermarks := make(map[string]database.Watermark, len(persistentWatermarks))
+	for _, w := range persistentWatermarks {
+		watermarks[w.EntityID] = database.Watermark{
+			EntityID:         w.EntityID,
+			Source:           database.SourceType(w.Source),
+			LastTweetID:      w.LastTweetID,
+			LastTweetTime:    w.LastTweetTime,
+			ProcessedUntil:   w.ProcessedUntil,
+			CatchUpSinceID:   w.CatchUpSinceID,
+			CatchUpUntilID:   w.CatchUpUntilID,
+			CatchUpStartTime: w.CatchUpStartTime,
+		}
+	}
+
+	return watermarks, nil
+}
+
+func (db *DB) SaveWatermarks(ctx context.Context, watermarks []database.Watermark) error {
+	if len(watermarks) == 0 {
+		return nil
+	}
+
+	persistentWatermarks := make([]watermark, len(watermarks))
+	for i, w := range watermarks {
+		persistentWatermarks[i] = watermark{
+			EntityID:         w.EntityID,
+			Source:           string(w.Source),
+			LastTweetID:      w.LastTweetID,
+			LastTweetTime:    w.LastTweetTime,
+			ProcessedUntil:   w.ProcessedUntil,
+			CatchUpSinceID:   w.CatchUpSinceID,
+			CatchUpUntilID:   w.CatchUpUntilID,
+			CatchUpStartTime: w.CatchUpStartTime,
+		}
+	}
+
+	err := db.db.WithContext(ctx).Clauses(clause.OnConflict{UpdateAll: true}).Create(&persistentWatermarks).Error
+	if err != nil {
+		return fmt.Errorf("Error saving watermarks to db: %w", err)
+	}
+
+	return nil
+}
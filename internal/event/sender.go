@@ -6,8 +6,11 @@ import (
 	"fmt"
 	"time"
 
+	"github.com/kordape/ottct-poller-service/internal/database"
 	"github.com/kordape/ottct-poller-service/pkg/logger"
+	"github.com/kordape/ottct-poller-service/pkg/source"
 	"github.com/kordape/ottct-poller-service/pkg/sqs"
+	"github.com/kordape/ottct-poller-service/pkg/twitter"
 
 	msg "github.com/kordape/ottct-main-service/pkg/sqs"
 )
@@ -16,6 +19,50 @@ type FakeNews struct {
 	EntityId  string
 	Timestamp time.Time
 	Content   string
+	TweetID   string
+	URL       string
+	Tweet     twitter.Tweet
+	// Source is where the post comes from, Post is set instead of Tweet for sources other than Twitter
+	Source database.SourceType
+	Post   source.Post
+	// Score is the confidence of the predictor that the post is fake news
+	Score float64
+}
+
+// fakeNewsEvent extends the event consumed by the main service with metadata of the tweet.
+// The original fields stay at the top level, so existing consumers keep working.
+type fakeNewsEvent struct {
+	msg.FakeNewsEvent
+	TweetID          string            `json:"tweetId"`
+	TweetURL         string            `json:"tweetUrl"`
+	Source           string            `json:"source,omitempty"`
+	Score            float64           `json:"score"`
+	AuthorID         string            `json:"authorId,omitempty"`
+	AuthorUsername   string            `json:"authorUsername,omitempty"`
+	Lang             string            `json:"lang,omitempty"`
+	ConversationID   string            `json:"conversationId,omitempty"`
+	Metrics          *tweetMetrics     `json:"metrics,omitempty"`
+	ReferencedTweets []referencedTweet `json:"referencedTweets,omitempty"`
+	URLs             []string          `json:"urls,omitempty"`
+	Media            []media           `json:"media,omitempty"`
+}
+
+type tweetMetrics struct {
+	Retweets    int `json:"retweets"`
+	Replies     int `json:"replies"`
+	Likes       int `json:"likes"`
+	Quotes      int `json:"quotes"`
+	Impressions int `json:"impressions"`
+}
+
+type referencedTweet struct {
+	Type string `json:"type"`
+	ID   string `json:"id"`
+}
+
+type media struct {
+	Type string `json:"type"`
+	URL  string `json:"url,omitempty"`
 }
 
 type SendFakeNewsEventFn func(ctx context.Context, events []FakeNews) error
@@ -26,24 +73,24 @@ func SendFakeNewsEventFnBuilder(client sqs.Client, log logger.Interface) SendFak
 		for _, e := range events {
 			raw, err := encodeEvent(toSQSEvent(e))
 			if err != nil {
-				log.Error(fmt.Printf("error encoding event: %v", e))
+				log.Error(fmt.Sprintf("Error encoding event of tweet %s: %v", e.TweetID, err))
 				return fmt.Errorf("error encoding event: %s", err)
 			}
 
 			_, err = client.Send(ctx, raw)
 			if err != nil {
-				log.Error(fmt.Printf("error sending event: %s", e))
+				log.Error(fmt.Sprintf("Error sending event of tweet %s: %v", e.TweetID, err))
 				return fmt.Errorf("error sending event to sqs: %s", err)
 			}
 
-			log.Error(fmt.Printf("successfully sent event: %s", e))
+			log.Debug(fmt.Sprintf("Sent event of tweet %s", e.TweetID))
 		}
 
 		return nil
 	}
 }
 
-func encodeEvent(e msg.FakeNewsEvent) (string, error) {
+func encodeEvent(e fakeNewsEvent) (string, error) {
 	b, err := json.Marshal(&e)
 	if err != nil {
 		return "", err
@@ -52,10 +99,75 @@ func encodeEvent(e msg.FakeNewsEvent) (string, error) {
 	return string(b), nil
 }
 
-func toSQSEvent(e FakeNews) msg.FakeNewsEvent {
-	return msg.FakeNewsEvent{
-		TweetContent:   e.Content,
-		EntityID:       e.EntityId,
-		TweetTimestamp: e.Timestamp,
+func toSQSEvent(e FakeNews) fakeNewsEvent {
+	if e.Source != "" && e.Source != database.SourceTwitter {
+		return fakeNewsEvent{
+			FakeNewsEvent: msg.FakeNewsEvent{
+				TweetContent:   e.Content,
+				EntityID:       e.EntityId,
+				TweetTimestamp: e.Timestamp,
+			},
+			TweetID:        e.TweetID,
+			TweetURL:       e.URL,
+			Source:         string(e.Source),
+			Score:          e.Score,
+			AuthorID:       e.Post.AuthorID,
+			AuthorUsername: e.Post.Author,
+			Lang:           e.Post.Lang,
+		}
+	}
+
+	event := fakeNewsEvent{
+		FakeNewsEvent: msg.FakeNewsEvent{
+			TweetContent:   e.Content,
+			EntityID:       e.EntityId,
+			TweetTimestamp: e.Timestamp,
+		},
+		TweetID:        e.TweetID,
+		TweetURL:       e.URL,
+		Source:         string(database.SourceTwitter),
+		Score:          e.Score,
+		AuthorID:       e.Tweet.AuthorID,
+		Lang:           e.Tweet.Lang,
+		ConversationID: e.Tweet.ConversationID,
+	}
+
+	if e.Tweet.Author != nil {
+		event.AuthorUsername = e.Tweet.Author.Username
+	}
+
+	if m := e.Tweet.PublicMetrics; m != nil {
+		event.Metrics = &tweetMetrics{
+			Retweets:    m.RetweetCount,
+			Replies:     m.ReplyCount,
+			Likes:       m.LikeCount,
+			Quotes:      m.QuoteCount,
+			Impressions: m.ImpressionCount,
+		}
+	}
+
+	for _, r := range e.Tweet.ReferencedTweets {
+		event.ReferencedTweets = append(event.ReferencedTweets, referencedTweet{
+			Type: r.Type,
+			ID:   r.ID,
+		})
 	}
+
+	for _, u := range e.Tweet.URLs {
+		event.URLs = append(event.URLs, u.ExpandedURL)
+	}
+
+	for _, m := range e.Tweet.Media {
+		url := m.URL
+		if url == "" {
+			// videos only come with a preview
+			url = m.PreviewImageURL
+		}
+		event.Media = append(event.Media, media{
+			Type: m.Type,
+			URL:  url,
+		})
+	}
+
+	return event
 }
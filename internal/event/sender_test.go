@@ -0,0 +1,118 @@
+package event
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/kordape/ottct-poller-service/internal/database"
+	"github.com/kordape/ottct-poller-service/pkg/logger"
+	"github.com/kordape/ottct-poller-service/pkg/source"
+	"github.com/kordape/ottct-poller-service/pkg/sqs"
+	"github.com/kordape/ottct-poller-service/pkg/twitter"
+	"github.com/stretchr/testify/assert"
+)
+
+type sqsClientFunc func(ctx context.Context, msg string) (string, error)
+
+func (f sqsClientFunc) Send(ctx context.Context, msg string, _ ...sqs.SendOption) (string, error) {
+	return f(ctx, msg)
+}
+
+func TestToSQSEvent(t *testing.T) {
+	now := time.Now()
+
+	t.Run("tweet", func(t *testing.T) {
+		event := toSQSEvent(FakeNews{
+			EntityId:  "id1",
+			Timestamp: now,
+			Content:   "Fake",
+			TweetID:   "42",
+			URL:       "https://twitter.com/foo/status/42",
+			Score:     0.87,
+			Tweet: twitter.Tweet{
+				ID:               "42",
+				AuthorID:         "1",
+				Author:           &twitter.User{ID: "1", Username: "foo"},
+				Lang:             "en",
+				ConversationID:   "40",
+				PublicMetrics:    &twitter.PublicMetrics{RetweetCount: 3, LikeCount: 5},
+				ReferencedTweets: []twitter.ReferencedTweet{{Type: twitter.ReferenceQuoted, ID: "41"}},
+				URLs:             []twitter.TweetURL{{URL: "https://t.co/x", ExpandedURL: "https://example.com"}},
+				Media:            []twitter.Media{{Type: "video", PreviewImageURL: "https://pbs.twimg.com/preview.jpg"}},
+			},
+		})
+
+		assert.Equal(t, "id1", event.EntityID)
+		assert.Equal(t, "Fake", event.TweetContent)
+		assert.Equal(t, now, event.TweetTimestamp)
+		assert.Equal(t, "42", event.TweetID)
+		assert.Equal(t, "https://twitter.com/foo/status/42", event.TweetURL)
+		assert.Equal(t, "twitter", event.Source)
+		assert.Equal(t, 0.87, event.Score)
+		assert.Equal(t, "foo", event.AuthorUsername)
+		assert.Equal(t, &tweetMetrics{Retweets: 3, Likes: 5}, event.Metrics)
+		assert.Equal(t, []referencedTweet{{Type: twitter.ReferenceQuoted, ID: "41"}}, event.ReferencedTweets)
+		assert.Equal(t, []string{"https://example.com"}, event.URLs)
+		assert.Equal(t, []media{{Type: "video", URL: "https://pbs.twimg.com/preview.jpg"}}, event.Media)
+	})
+
+	t.Run("post of another source", func(t *testing.T) {
+		event := toSQSEvent(FakeNews{
+			EntityId: "id2",
+			TweetID:  "7",
+			URL:      "https://mastodon.social/@bar/7",
+			Score:    0.6,
+			Source:   database.SourceMastodon,
+			Post:     source.Post{ID: "7", AuthorID: "2", Author: "bar", Lang: "de"},
+		})
+
+		assert.Equal(t, "7", event.TweetID)
+		assert.Equal(t, "https://mastodon.social/@bar/7", event.TweetURL)
+		assert.Equal(t, string(database.SourceMastodon), event.Source)
+		assert.Equal(t, 0.6, event.Score)
+		assert.Equal(t, "bar", event.AuthorUsername)
+		assert.Nil(t, event.Metrics)
+	})
+}
+
+func TestSendFakeNewsEvent(t *testing.T) {
+	log := logger.New("DEBUG")
+
+	t.Run("sends encoded events", func(t *testing.T) {
+		sent := []map[string]interface{}{}
+		send := SendFakeNewsEventFnBuilder(sqsClientFunc(func(ctx context.Context, msg string) (string, error) {
+			var decoded map[string]interface{}
+			assert.NoError(t, json.Unmarshal([]byte(msg), &decoded))
+			sent = append(sent, decoded)
+			return "message-id", nil
+		}), log)
+
+		err := send(context.Background(), []FakeNews{
+			{EntityId: "id1", TweetID: "42", URL: "https://twitter.com/i/web/status/42", Score: 0.9},
+			{EntityId: "id1", TweetID: "43", URL: "https://twitter.com/i/web/status/43", Score: 0.5},
+		})
+		assert.NoError(t, err)
+
+		assert.Len(t, sent, 2)
+		assert.Equal(t, "42", sent[0]["tweetId"])
+		assert.Equal(t, "https://twitter.com/i/web/status/42", sent[0]["tweetUrl"])
+		assert.Equal(t, 0.9, sent[0]["score"])
+		assert.Equal(t, "twitter", sent[0]["source"])
+		assert.NotContains(t, sent[0], "metrics")
+	})
+
+	t.Run("fails on the first failed event", func(t *testing.T) {
+		attempts := 0
+		send := SendFakeNewsEventFnBuilder(sqsClientFunc(func(ctx context.Context, msg string) (string, error) {
+			attempts++
+			return "", errors.New("queue unavailable")
+		}), log)
+
+		err := send(context.Background(), []FakeNews{{TweetID: "42"}, {TweetID: "43"}})
+		assert.Error(t, err)
+		assert.Equal(t, 1, attempts)
+	})
+}
@@ -6,101 +6,514 @@ import (
 	"fmt"
 	"time"
 
+	"github.com/kordape/ottct-poller-service/internal/database"
 	"github.com/kordape/ottct-poller-service/pkg/logger"
 	"github.com/kordape/ottct-poller-service/pkg/predictor"
+	"github.com/kordape/ottct-poller-service/pkg/source"
 	"github.com/kordape/ottct-poller-service/pkg/twitter"
 )
 
 const (
-	defaultFetchCount = 5
+	// defaultFakeThreshold is the score from which texts count as fake news, the one models answering
+	// with bare labels use
+	defaultFakeThreshold = 0.5
 )
 
 type JobRequest struct {
+	// EntityID identifies the entity on its source, e.g. the Twitter user ID or the feed URL
 	EntityID  string
 	StartTime time.Time
 	EndTime   time.Time
+	// SinceID is the newest tweet already processed for the entity. When set, only newer tweets
+	// are fetched and the time window is ignored.
+	SinceID string
+	// SinceTime is the time of the newest post already processed, used by sources without ordered post IDs
+	SinceTime time.Time
+	// Source is where posts of the entity are fetched from, empty means Twitter
+	Source database.SourceType
+	// MaxPages limits how many pages of tweets are fetched, 0 means no limit
+	MaxPages int
+	// MaxTweets limits how many tweets are fetched, 0 means no limit
+	MaxTweets int
+	// UntilID fetches only tweets older than the given tweet, used to catch up on a truncated job
+	UntilID string
+	// Tweets are classified as they are instead of being fetched, e.g. when received from a stream,
+	// Posts are the same for sources other than Twitter
+	Tweets []twitter.Tweet
+	Posts  []source.Post
+	// Retweets and Replies decide how tweets of those types are analyzed, empty means they are included
+	Retweets database.TweetTypeMode
+	Replies  database.TweetTypeMode
+	// FakeThreshold is the score from which tweets of the entity count as fake news, 0 means the default
+	FakeThreshold float64
 }
 
 type JobResult struct {
 	EntityID       string
 	Error          error
 	FakeNewsTweets []FakeNewsTweet
+	// NewestTweetID and NewestTweetTime describe the newest fetched tweet, empty if none were fetched
+	NewestTweetID   string
+	NewestTweetTime time.Time
+	// Truncated is set when not all tweets were fetched because of the limits of the request. The missing
+	// tweets are older than OldestTweetID, the oldest fetched tweet, and should be caught up on.
+	Truncated     bool
+	OldestTweetID string
+	// RetryAfter is set when the entity can't be processed before the given time, e.g. when rate limited
+	RetryAfter time.Time
+	// Unavailable is set when the account of the entity is gone, e.g. suspended, and polling it is pointless
+	Unavailable database.AccountStatus
+	// Unclassified are the fetched tweets the predictor failed to classify, UnclassifiedPosts are the same
+	// for sources other than Twitter. The rest of the result describes the fetch as if it succeeded.
+	Unclassified      []twitter.Tweet
+	UnclassifiedPosts []source.Post
+	// ClassifiedIDs are the IDs of the analyzed tweets the predictor scored, fake news or not
+	ClassifiedIDs []string
 }
 
 type FakeNewsTweet struct {
 	Content   string
 	Timestamp time.Time
+	TweetID   string
+	URL       string
+	// Tweet carries the rest of the tweet metadata
+	Tweet twitter.Tweet
+	// Source is where the post comes from, Post is set instead of Tweet for sources other than Twitter
+	Source database.SourceType
+	Post   source.Post
+	// Score is the confidence of the predictor that the tweet is fake news
+	Score float64
 }
 
 type JobResults []JobResult
 
+// TimeoutError is reported in JobResult when a job didn't finish within its timeout.
+type TimeoutError struct {
+	EntityID string
+	Timeout  time.Duration
+}
+
+func (e *TimeoutError) Error() string {
+	return fmt.Sprintf("processing entity %s timed out after %s", e.EntityID, e.Timeout)
+}
+
+func (e *TimeoutError) Unwrap() error {
+	return context.DeadlineExceeded
+}
+
 type ProcessFn func(ctx context.Context, request JobRequest) JobResult
 
-func GetProcessFn(log logger.Interface, fetcher twitter.TweetsFetcher, classifier predictor.FakeNewsClassifier) ProcessFn {
+type options struct {
+	sources       map[database.SourceType]source.PostsFetcher
+	fakeThreshold float64
+}
+
+type Option func(o *options)
+
+// WithSource fetches posts of entities on the source with fetcher, e.g. a Mastodon client.
+func WithSource(sourceType database.SourceType, fetcher source.PostsFetcher) Option {
+	return func(o *options) {
+		o.sources[sourceType] = fetcher
+	}
+}
+
+// WithFakeThreshold sets the score from which tweets count as fake news, unless the job request sets its own.
+// Thresholds outside (0, 1] are ignored.
+func WithFakeThreshold(threshold float64) Option {
+	return func(o *options) {
+		o.fakeThreshold = threshold
+	}
+}
+
+// ValidFakeThreshold tells whether threshold can tell fake news apart, 0 would flag every text.
+func ValidFakeThreshold(threshold float64) bool {
+	return threshold > 0 && threshold <= 1
+}
+
+func GetProcessFn(log logger.Interface, fetcher twitter.TweetsFetcher, classifier predictor.FakeNewsClassifier, opts ...Option) ProcessFn {
+	o := &options{
+		sources:       map[database.SourceType]source.PostsFetcher{},
+		fakeThreshold: defaultFakeThreshold,
+	}
+
+	for _, opt := range opts {
+		opt(o)
+	}
+
+	if !ValidFakeThreshold(o.fakeThreshold) {
+		log.Warn(fmt.Sprintf("Invalid fake news threshold %v, using %v", o.fakeThreshold, defaultFakeThreshold))
+		o.fakeThreshold = defaultFakeThreshold
+	}
+
 	return func(ctx context.Context, request JobRequest) JobResult {
-		// Fetch tweets in given time window
-		fetchRequest := twitter.FetchTweetsRequest{
-			EntityID:   request.EntityID,
-			StartTime:  request.StartTime,
-			EndTime:    request.EndTime,
-			MaxResults: defaultFetchCount,
-		}
-
-		if err := fetchRequest.Validate(); err != nil {
-			return JobResult{
-				EntityID: request.EntityID,
-				Error:    err,
+		threshold := o.fakeThreshold
+		if request.FakeThreshold != 0 {
+			threshold = request.FakeThreshold
+		}
+
+		if request.Source != "" && request.Source != database.SourceTwitter {
+			return processPosts(ctx, log, o.sources[request.Source], classifier, request, threshold)
+		}
+
+		tweets := request.Tweets
+		truncated := false
+		if request.Tweets == nil {
+			fetched, err := fetch(ctx, log, fetcher, request)
+			var partialErr *twitter.PartialError
+			if errors.As(err, &partialErr) {
+				log.Warn(fmt.Sprintf("Fetched tweets of entity %s partially: %v", request.EntityID, err))
+			} else if err != nil {
+				return fetchFailedResult(log, request.EntityID, err)
 			}
+			tweets = fetched.Tweets
+			truncated = fetched.Truncated
 		}
+		log.Info(fmt.Sprintf("Fetched tweets: %v", tweets))
 
-		tweets, err := fetcher.FetchTweets(ctx, log, fetchRequest)
+		analyzed, err := analyzedTweets(ctx, log, fetcher, request, tweets)
 		if err != nil {
-			log.Error(fmt.Sprintf("Error while fetching tweets: %s", err))
-			return JobResult{
-				EntityID: request.EntityID,
-				Error:    err,
+			return fetchFailedResult(log, request.EntityID, err)
+		}
+
+		texts := make([]string, len(analyzed))
+		for i, t := range analyzed {
+			texts[i] = t.Text
+		}
+
+		result := JobResult{
+			EntityID: request.EntityID,
+		}
+
+		// the watermark follows the fetched tweets, not the originals analyzed in their place
+		if newest, ok := newestTweet(tweets); ok {
+			result.NewestTweetID = newest.ID
+			result.NewestTweetTime = newest.CreatedAt
+		}
+
+		if truncated {
+			if oldest, ok := oldestTweet(tweets); ok {
+				log.Warn(fmt.Sprintf("Fetched tweets of entity %s only down to %s, leaving older ones for a catch-up", request.EntityID, oldest.ID))
+				result.Truncated = true
+				result.OldestTweetID = oldest.ID
 			}
 		}
-		log.Info(fmt.Sprintf("Fetched tweets: %v", tweets))
 
-		classifyRequest := make(predictor.ClassifyRequest, len(tweets))
-		for i, t := range tweets {
-			classifyRequest[i] = t.Text
+		fake, err := classifyFake(ctx, log, classifier, texts, threshold)
+		if err != nil {
+			result = classifyFailedResult(log, result, err)
+			result.Unclassified = analyzed
+			return result
+		}
+
+		result.ClassifiedIDs = make([]string, len(analyzed))
+		for i, t := range analyzed {
+			result.ClassifiedIDs[i] = t.ID
+		}
+
+		result.FakeNewsTweets = []FakeNewsTweet{}
+		for _, f := range fake {
+			result.FakeNewsTweets = append(result.FakeNewsTweets, FakeNewsTweet{
+				Content:   analyzed[f.index].Text,
+				Timestamp: analyzed[f.index].CreatedAt,
+				TweetID:   analyzed[f.index].ID,
+				URL:       analyzed[f.index].URL(),
+				Tweet:     analyzed[f.index],
+				Source:    database.SourceTwitter,
+				Score:     f.score,
+			})
 		}
 
-		// Classify tweets as fake or not
-		classifyResponse, err := classifier.Classify(ctx, classifyRequest)
+		return result
+	}
+}
+
+// processPosts classifies posts of an entity on a source other than Twitter.
+func processPosts(ctx context.Context, log logger.Interface, fetcher source.PostsFetcher, classifier predictor.FakeNewsClassifier, request JobRequest, threshold float64) JobResult {
+	if fetcher == nil {
+		return JobResult{
+			EntityID: request.EntityID,
+			Error:    fmt.Errorf("source %s isn't supported", request.Source),
+		}
+	}
+
+	posts := request.Posts
+	truncated := false
+	if request.Posts == nil {
+		fetched, err := fetcher.FetchPosts(ctx, log, source.FetchPostsRequest{
+			Account:   request.EntityID,
+			StartTime: request.StartTime,
+			EndTime:   request.EndTime,
+			SinceID:   request.SinceID,
+			SinceTime: request.SinceTime,
+			UntilID:   request.UntilID,
+			MaxPages:  request.MaxPages,
+		})
 		if err != nil {
-			log.Error(fmt.Sprintf("Error while classifying tweets: %s", err))
-			return JobResult{
-				EntityID: request.EntityID,
-				Error:    err,
-			}
+			return fetchFailedResult(log, request.EntityID, err)
 		}
+		posts = fetched.Posts
+		truncated = fetched.Truncated
+		log.Info(fmt.Sprintf("Fetched %d %s posts of entity %s", len(posts), request.Source, request.EntityID))
+	}
 
-		log.Info(fmt.Sprintf("Classified tweets: %v", classifyResponse))
+	texts := make([]string, len(posts))
+	for i, p := range posts {
+		texts[i] = p.Text
+	}
 
-		if len(classifyResponse.Classification) != len(tweets) {
-			return JobResult{
-				EntityID: request.EntityID,
-				Error:    errors.New("different number of predictions and tweets"),
-			}
+	result := JobResult{
+		EntityID: request.EntityID,
+	}
+
+	// posts come newest first
+	if len(posts) > 0 {
+		result.NewestTweetID = posts[0].ID
+		result.NewestTweetTime = posts[0].CreatedAt
+	}
+
+	if truncated && len(posts) > 0 {
+		oldest := posts[len(posts)-1]
+		log.Warn(fmt.Sprintf("Fetched posts of entity %s only down to %s, leaving older ones for a catch-up", request.EntityID, oldest.ID))
+		result.Truncated = true
+		result.OldestTweetID = oldest.ID
+	}
+
+	fake, err := classifyFake(ctx, log, classifier, texts, threshold)
+	if err != nil {
+		result = classifyFailedResult(log, result, err)
+		result.UnclassifiedPosts = posts
+		return result
+	}
+
+	result.ClassifiedIDs = make([]string, len(posts))
+	for i, p := range posts {
+		result.ClassifiedIDs[i] = p.ID
+	}
+
+	result.FakeNewsTweets = []FakeNewsTweet{}
+	for _, f := range fake {
+		result.FakeNewsTweets = append(result.FakeNewsTweets, FakeNewsTweet{
+			Content:   posts[f.index].Text,
+			Timestamp: posts[f.index].CreatedAt,
+			TweetID:   posts[f.index].ID,
+			URL:       posts[f.index].URL,
+			Source:    request.Source,
+			Post:      posts[f.index],
+			Score:     f.score,
+		})
+	}
+
+	return result
+}
+
+// fakeText is a text classified as fake news, identified by its index.
+type fakeText struct {
+	index int
+	score float64
+}
+
+// classifyFake returns the texts whose score reaches the threshold.
+func classifyFake(ctx context.Context, log logger.Interface, classifier predictor.FakeNewsClassifier, texts []string, threshold float64) ([]fakeText, error) {
+	// Classify tweets as fake or not
+	classifyResponse, err := classifier.Classify(ctx, predictor.ClassifyRequest(texts))
+	if err != nil {
+		return nil, err
+	}
+
+	log.Info(fmt.Sprintf("Classified tweets: %v", classifyResponse))
+
+	if len(classifyResponse.Classification) != len(texts) {
+		return nil, errors.New("different number of predictions and tweets")
+	}
+
+	fake := []fakeText{}
+	for i, p := range classifyResponse.Predictions() {
+		if p.Fake(threshold) {
+			fake = append(fake, fakeText{index: i, score: p.Score})
 		}
+	}
 
-		fakeTweets := []FakeNewsTweet{}
-		// Filter out only fake tweets
-		for i, c := range classifyResponse.Classification {
-			if c == predictor.Fake {
-				fakeTweets = append(fakeTweets, FakeNewsTweet{
-					Content:   tweets[i].Text,
-					Timestamp: tweets[i].CreatedAt,
-				})
+	return fake, nil
+}
+
+// fetch fetches tweets of the entity in the requested time window or since the requested tweet.
+func fetch(ctx context.Context, log logger.Interface, fetcher twitter.TweetsFetcher, request JobRequest) (twitter.FetchTweetsResponse, error) {
+	fetchRequest := twitter.FetchTweetsRequest{
+		EntityID:   request.EntityID,
+		StartTime:  request.StartTime,
+		EndTime:    request.EndTime,
+		MaxResults: pageSize(request.MaxTweets),
+		MaxPages:   request.MaxPages,
+		MaxTweets:  request.MaxTweets,
+		SinceID:    request.SinceID,
+		UntilID:    request.UntilID,
+	}
+
+	// originals are looked up from the referencing tweets, so only excluded types can be left out right away
+	if request.Retweets == database.TweetsExcluded {
+		fetchRequest.Exclude = append(fetchRequest.Exclude, twitter.ExcludeRetweets)
+	}
+	if request.Replies == database.TweetsExcluded {
+		fetchRequest.Exclude = append(fetchRequest.Exclude, twitter.ExcludeReplies)
+	}
+
+	if err := fetchRequest.Validate(); err != nil {
+		return twitter.FetchTweetsResponse{}, err
+	}
+
+	return fetcher.FetchTweets(ctx, log, fetchRequest)
+}
+
+// pageSize fetches the largest pages, as every page costs a request of the rate limit, unless fewer tweets are wanted.
+func pageSize(maxTweets int) int {
+	switch {
+	case maxTweets <= 0 || maxTweets >= twitter.FetchTweetsMaxResults:
+		return twitter.FetchTweetsMaxResults
+	case maxTweets < twitter.FetchTweetsMinResults:
+		return twitter.FetchTweetsMinResults
+	default:
+		return maxTweets
+	}
+}
+
+// analyzedTweets applies the tweet type modes of the request. Excluded tweets are dropped, e.g. when
+// they were received from a stream, and tweets in the original mode are replaced with the tweets they reference.
+func analyzedTweets(ctx context.Context, log logger.Interface, fetcher twitter.TweetsFetcher, request JobRequest, tweets []twitter.Tweet) ([]twitter.Tweet, error) {
+	analyzed := []twitter.Tweet{}
+	analyzedIDs := map[string]bool{}
+	originalIDs := []string{}
+	requested := map[string]bool{}
+	for _, t := range tweets {
+		mode := database.TweetsIncluded
+		referencedID, retweet := t.Referenced(twitter.ReferenceRetweeted)
+		if retweet && request.Retweets != "" {
+			mode = request.Retweets
+		} else if repliedToID, reply := t.Referenced(twitter.ReferenceRepliedTo); reply && !retweet && request.Replies != "" {
+			mode = request.Replies
+			referencedID = repliedToID
+		}
+
+		switch mode {
+		case database.TweetsExcluded:
+			continue
+		case database.TweetsOriginal:
+			if !requested[referencedID] {
+				requested[referencedID] = true
+				originalIDs = append(originalIDs, referencedID)
 			}
+		default:
+			analyzedIDs[t.ID] = true
+			analyzed = append(analyzed, t)
 		}
+	}
+
+	if len(originalIDs) == 0 {
+		return analyzed, nil
+	}
+
+	originals, err := fetcher.LookupTweets(ctx, log, originalIDs)
+	if err != nil {
+		return nil, fmt.Errorf("error looking up referenced tweets: %w", err)
+	}
+
+	log.Info(fmt.Sprintf("Found %d of %d referenced tweets to analyze", len(originals), len(originalIDs)))
 
+	for _, o := range originals {
+		// e.g. a reply to the entity's own tweet
+		if !analyzedIDs[o.ID] {
+			analyzed = append(analyzed, o)
+		}
+	}
+
+	return analyzed, nil
+}
+
+// classifyFailedResult fails the result and defers the entity while the predictor is considered down.
+func classifyFailedResult(log logger.Interface, result JobResult, err error) JobResult {
+	result.Error = err
+
+	var circuitOpenErr *predictor.CircuitOpenError
+	if errors.As(err, &circuitOpenErr) {
+		log.Warn(fmt.Sprintf("Predictor is unavailable, deferring entity %s until %s", result.EntityID, circuitOpenErr.Until.Format(time.RFC3339)))
+		result.RetryAfter = circuitOpenErr.Until
+		return result
+	}
+
+	log.Error(fmt.Sprintf("Error while classifying tweets: %s", err))
+
+	return result
+}
+
+func fetchFailedResult(log logger.Interface, entityID string, err error) JobResult {
+	var rateLimitedErr *twitter.RateLimitedError
+	if errors.As(err, &rateLimitedErr) {
+		log.Warn(fmt.Sprintf("Rate limited while fetching tweets until %s", rateLimitedErr.Reset.Format(time.RFC3339)))
+		return JobResult{
+			EntityID:   entityID,
+			Error:      err,
+			RetryAfter: rateLimitedErr.Reset,
+		}
+	}
+
+	var sourceRateLimitedErr *source.RateLimitedError
+	if errors.As(err, &sourceRateLimitedErr) {
+		log.Warn(fmt.Sprintf("Rate limited by %s while fetching posts until %s", sourceRateLimitedErr.Source, sourceRateLimitedErr.Reset.Format(time.RFC3339)))
 		return JobResult{
-			EntityID:       request.EntityID,
-			FakeNewsTweets: fakeTweets,
+			EntityID:   entityID,
+			Error:      err,
+			RetryAfter: sourceRateLimitedErr.Reset,
+		}
+	}
+
+	result := JobResult{
+		EntityID: entityID,
+		Error:    err,
+	}
+
+	switch {
+	case errors.Is(err, twitter.ErrSuspended):
+		result.Unavailable = database.AccountSuspended
+		log.Warn(fmt.Sprintf("Account of entity %s is suspended: %s", entityID, err))
+	case errors.Is(err, twitter.ErrNotFound), errors.Is(err, source.ErrNotFound):
+		result.Unavailable = database.AccountDeleted
+		log.Warn(fmt.Sprintf("Account of entity %s doesn't exist: %s", entityID, err))
+	case errors.Is(err, twitter.ErrUnauthorized):
+		log.Error(fmt.Sprintf("Twitter rejected the credentials while fetching tweets: %s", err))
+	case errors.Is(err, twitter.ErrForbidden):
+		log.Warn(fmt.Sprintf("Access to tweets of entity %s is forbidden: %s", entityID, err))
+	default:
+		log.Error(fmt.Sprintf("Error while fetching tweets: %s", err))
+	}
+
+	return result
+}
+
+func newestTweet(tweets []twitter.Tweet) (twitter.Tweet, bool) {
+	if len(tweets) == 0 {
+		return twitter.Tweet{}, false
+	}
+
+	newest := tweets[0]
+	for _, t := range tweets[1:] {
+		if twitter.NewerID(t.ID, newest.ID) {
+			newest = t
 		}
 	}
+
+	return newest, true
+}
+
+func oldestTweet(tweets []twitter.Tweet) (twitter.Tweet, bool) {
+	if len(tweets) == 0 {
+		return twitter.Tweet{}, false
+	}
+
+	oldest := tweets[0]
+	for _, t := range tweets[1:] {
+		if twitter.NewerID(oldest.ID, t.ID) {
+			oldest = t
+		}
+	}
+
+	return oldest, true
 }
@@ -3,12 +3,17 @@ package processor
 import (
 	"context"
 	"errors"
+	"fmt"
+	"net/http/httptest"
 	"testing"
 	"time"
 
+	"github.com/kordape/ottct-poller-service/internal/database"
 	"github.com/kordape/ottct-poller-service/pkg/logger"
 	"github.com/kordape/ottct-poller-service/pkg/predictor"
+	"github.com/kordape/ottct-poller-service/pkg/source"
 	"github.com/kordape/ottct-poller-service/pkg/twitter"
+	"github.com/kordape/ottct-poller-service/pkg/twitter/twittertest"
 	"github.com/stretchr/testify/assert"
 	mock "github.com/stretchr/testify/mock"
 )
@@ -24,7 +29,7 @@ func TestProcess(t *testing.T) {
 			EntityID:   "entity",
 			StartTime:  now,
 			EndTime:    now,
-			MaxResults: defaultFetchCount,
+			MaxResults: twitter.FetchTweetsMaxResults,
 		}
 		fetcher.On("FetchTweets", mock.Anything, mock.Anything, expectedFetchRequest).Return(
 			twitter.FetchTweetsResponse{},
@@ -44,6 +49,90 @@ func TestProcess(t *testing.T) {
 
 	})
 
+	t.Run("rate limited fetching", func(t *testing.T) {
+		fetcher := twitter.NewMockTweetsFetcher(t)
+		classifier := predictor.NewMockFakeNewsClassifier(t)
+
+		now := time.Now()
+		reset := now.Add(time.Hour)
+		expectedFetchRequest := twitter.FetchTweetsRequest{
+			EntityID:   "entity",
+			StartTime:  now,
+			EndTime:    now,
+			MaxResults: twitter.FetchTweetsMaxResults,
+		}
+		fetcher.On("FetchTweets", mock.Anything, mock.Anything, expectedFetchRequest).Return(
+			twitter.FetchTweetsResponse{},
+			fmt.Errorf("error invoking twitter api: %w", &twitter.RateLimitedError{Reset: reset}),
+		)
+
+		process := GetProcessFn(logger.New("DEBUG"), fetcher, classifier)
+
+		response := process(context.Background(), JobRequest{
+			EntityID:  "entity",
+			StartTime: now,
+			EndTime:   now,
+		})
+
+		assert.Equal(t, "entity", response.EntityID)
+		assert.Error(t, response.Error)
+		assert.Equal(t, reset, response.RetryAfter)
+	})
+
+	t.Run("unavailable account", func(t *testing.T) {
+		fetcher := twitter.NewMockTweetsFetcher(t)
+		classifier := predictor.NewMockFakeNewsClassifier(t)
+
+		now := time.Now()
+		fetcher.On("FetchTweets", mock.Anything, mock.Anything, mock.Anything).Return(
+			twitter.FetchTweetsResponse{},
+			fmt.Errorf("error invoking twitter api: %w", &twitter.APIError{
+				StatusCode: 200,
+				Type:       "https://api.twitter.com/2/problems/resource-not-found",
+				Title:      "Forbidden",
+				Detail:     "User has been suspended: [entity].",
+			}),
+		)
+
+		process := GetProcessFn(logger.New("DEBUG"), fetcher, classifier)
+
+		response := process(context.Background(), JobRequest{
+			EntityID:  "entity",
+			StartTime: now,
+			EndTime:   now,
+		})
+
+		assert.Error(t, response.Error)
+		assert.Equal(t, database.AccountSuspended, response.Unavailable)
+	})
+
+	t.Run("forbidden", func(t *testing.T) {
+		fetcher := twitter.NewMockTweetsFetcher(t)
+		classifier := predictor.NewMockFakeNewsClassifier(t)
+
+		now := time.Now()
+		fetcher.On("FetchTweets", mock.Anything, mock.Anything, mock.Anything).Return(
+			twitter.FetchTweetsResponse{},
+			fmt.Errorf("error invoking twitter api: %w", &twitter.APIError{
+				StatusCode: 403,
+				Type:       "about:blank",
+				Title:      "Forbidden",
+			}),
+		)
+
+		process := GetProcessFn(logger.New("DEBUG"), fetcher, classifier)
+
+		response := process(context.Background(), JobRequest{
+			EntityID:  "entity",
+			StartTime: now,
+			EndTime:   now,
+		})
+
+		assert.ErrorIs(t, response.Error, twitter.ErrForbidden)
+		assert.Empty(t, response.Unavailable)
+		assert.True(t, response.RetryAfter.IsZero())
+	})
+
 	t.Run("failed classifying", func(t *testing.T) {
 		fetcher := twitter.NewMockTweetsFetcher(t)
 		classifier := predictor.NewMockFakeNewsClassifier(t)
@@ -53,10 +142,10 @@ func TestProcess(t *testing.T) {
 			EntityID:   "entity",
 			StartTime:  now,
 			EndTime:    now,
-			MaxResults: defaultFetchCount,
+			MaxResults: twitter.FetchTweetsMaxResults,
 		}
 		fetcher.On("FetchTweets", mock.Anything, mock.Anything, expectedFetchRequest).Return(
-			twitter.FetchTweetsResponse([]twitter.Tweet{
+			twitter.FetchTweetsResponse{Tweets: []twitter.Tweet{
 				{
 					ID:        "1",
 					Text:      "Dummy 1",
@@ -72,8 +161,7 @@ func TestProcess(t *testing.T) {
 					Text:      "Dummy 3",
 					CreatedAt: now,
 				},
-			},
-			),
+			}},
 			nil,
 		)
 
@@ -105,10 +193,10 @@ func TestProcess(t *testing.T) {
 			EntityID:   "entity",
 			StartTime:  now,
 			EndTime:    now,
-			MaxResults: defaultFetchCount,
+			MaxResults: twitter.FetchTweetsMaxResults,
 		}
 		fetcher.On("FetchTweets", mock.Anything, mock.Anything, expectedFetchRequest).Return(
-			twitter.FetchTweetsResponse([]twitter.Tweet{
+			twitter.FetchTweetsResponse{Tweets: []twitter.Tweet{
 				{
 					ID:        "1",
 					Text:      "Dummy 1",
@@ -124,8 +212,7 @@ func TestProcess(t *testing.T) {
 					Text:      "Dummy 3",
 					CreatedAt: now,
 				},
-			},
-			),
+			}},
 			nil,
 		)
 
@@ -155,5 +242,383 @@ func TestProcess(t *testing.T) {
 		assert.Equal(t, 2, len(response.FakeNewsTweets))
 		assert.Equal(t, "Dummy 1", response.FakeNewsTweets[0].Content)
 		assert.Equal(t, "Dummy 3", response.FakeNewsTweets[1].Content)
+		assert.Equal(t, "3", response.FakeNewsTweets[1].TweetID)
+		assert.Equal(t, "https://twitter.com/i/web/status/3", response.FakeNewsTweets[1].URL)
+		assert.Equal(t, "3", response.NewestTweetID)
+		assert.Equal(t, now, response.NewestTweetTime)
+	})
+
+	t.Run("prefetched tweets", func(t *testing.T) {
+		fetcher := twitter.NewMockTweetsFetcher(t)
+		classifier := predictor.NewMockFakeNewsClassifier(t)
+
+		now := time.Now()
+		classifier.On("Classify", mock.Anything, predictor.ClassifyRequest([]string{
+			"Dummy 1", "Dummy 2",
+		})).Return(
+			predictor.ClassifyResponse{
+				Classification: []predictor.Classification{
+					predictor.Real,
+					predictor.Fake,
+				},
+			},
+			nil,
+		)
+
+		process := GetProcessFn(logger.New("DEBUG"), fetcher, classifier)
+
+		response := process(context.Background(), JobRequest{
+			EntityID:  "entity",
+			StartTime: now,
+			EndTime:   now,
+			Tweets: []twitter.Tweet{
+				{
+					ID:        "1",
+					Text:      "Dummy 1",
+					CreatedAt: now,
+				},
+				{
+					ID:        "2",
+					Text:      "Dummy 2",
+					CreatedAt: now,
+				},
+			},
+		})
+
+		fetcher.AssertNotCalled(t, "FetchTweets", mock.Anything, mock.Anything, mock.Anything)
+		assert.NoError(t, response.Error)
+		assert.Equal(t, 1, len(response.FakeNewsTweets))
+		assert.Equal(t, "Dummy 2", response.FakeNewsTweets[0].Content)
+		assert.Equal(t, "2", response.NewestTweetID)
+	})
+
+	t.Run("fake threshold", func(t *testing.T) {
+		fetcher := twitter.NewMockTweetsFetcher(t)
+		classifier := predictor.NewMockFakeNewsClassifier(t)
+
+		tweets := []twitter.Tweet{
+			{ID: "3", Text: "Dummy 3"},
+			{ID: "2", Text: "Dummy 2"},
+			{ID: "1", Text: "Dummy 1"},
+		}
+		classifier.On("Classify", mock.Anything, predictor.ClassifyRequest([]string{
+			"Dummy 3", "Dummy 2", "Dummy 1",
+		})).Return(
+			predictor.ClassifyResponse{
+				Classification: []predictor.Classification{predictor.Fake, predictor.Fake, predictor.Real},
+				Scores:         []float64{0.95, 0.7, 0.2},
+			},
+			nil,
+		)
+
+		process := GetProcessFn(logger.New("DEBUG"), fetcher, classifier, WithFakeThreshold(0.8))
+
+		response := process(context.Background(), JobRequest{EntityID: "entity", Tweets: tweets})
+		assert.NoError(t, response.Error)
+		assert.Equal(t, 1, len(response.FakeNewsTweets))
+		assert.Equal(t, "3", response.FakeNewsTweets[0].TweetID)
+		assert.Equal(t, 0.95, response.FakeNewsTweets[0].Score)
+
+		// the threshold of the entity wins over the global one
+		response = process(context.Background(), JobRequest{EntityID: "entity", Tweets: tweets, FakeThreshold: 0.1})
+		assert.NoError(t, response.Error)
+		assert.Equal(t, 3, len(response.FakeNewsTweets))
+		assert.Equal(t, 0.2, response.FakeNewsTweets[2].Score)
+	})
+
+	t.Run("predictor unavailable", func(t *testing.T) {
+		fetcher := twitter.NewMockTweetsFetcher(t)
+		classifier := predictor.NewMockFakeNewsClassifier(t)
+
+		until := time.Now().Add(time.Minute)
+		classifier.On("Classify", mock.Anything, mock.Anything).Return(predictor.ClassifyResponse{}, &predictor.CircuitOpenError{Until: until})
+
+		process := GetProcessFn(logger.New("DEBUG"), fetcher, classifier)
+
+		response := process(context.Background(), JobRequest{EntityID: "entity", Tweets: []twitter.Tweet{{ID: "1", Text: "Dummy 1"}}})
+		assert.Error(t, response.Error)
+		assert.Equal(t, until, response.RetryAfter)
+		// the tweets are kept for a later classification
+		assert.Equal(t, []twitter.Tweet{{ID: "1", Text: "Dummy 1"}}, response.Unclassified)
+		assert.Equal(t, "1", response.NewestTweetID)
+	})
+
+	t.Run("truncated fetch", func(t *testing.T) {
+		fetcher := twitter.NewMockTweetsFetcher(t)
+		classifier := predictor.NewMockFakeNewsClassifier(t)
+
+		now := time.Now()
+		fetcher.On("FetchTweets", mock.Anything, mock.Anything, twitter.FetchTweetsRequest{
+			EntityID:   "entity",
+			MaxResults: twitter.FetchTweetsMinResults,
+			MaxTweets:  2,
+			SinceID:    "1",
+			UntilID:    "9",
+		}).Return(
+			twitter.FetchTweetsResponse{
+				Tweets: []twitter.Tweet{
+					{ID: "8", Text: "Dummy 8", CreatedAt: now},
+					{ID: "7", Text: "Dummy 7", CreatedAt: now},
+				},
+				Truncated: true,
+			},
+			nil,
+		)
+
+		classifier.On("Classify", mock.Anything, predictor.ClassifyRequest([]string{
+			"Dummy 8", "Dummy 7",
+		})).Return(
+			predictor.ClassifyResponse{
+				Classification: []predictor.Classification{
+					predictor.Real,
+					predictor.Real,
+				},
+			},
+			nil,
+		)
+
+		process := GetProcessFn(logger.New("DEBUG"), fetcher, classifier)
+
+		response := process(context.Background(), JobRequest{
+			EntityID:  "entity",
+			SinceID:   "1",
+			UntilID:   "9",
+			MaxTweets: 2,
+		})
+
+		assert.NoError(t, response.Error)
+		assert.True(t, response.Truncated)
+		assert.Equal(t, "7", response.OldestTweetID)
+		assert.Equal(t, "8", response.NewestTweetID)
+	})
+
+	t.Run("backlog larger than a page", func(t *testing.T) {
+		fake := twittertest.New()
+		fake.AddUsers(twitter.User{ID: "1", Username: "foo"})
+		for i := 1; i <= 250; i++ {
+			fake.AddTweets(twitter.Tweet{
+				ID:        fmt.Sprintf("%d", 1000+i),
+				Text:      fmt.Sprintf("tweet %d", i),
+				CreatedAt: time.Now(),
+				AuthorID:  "1",
+			})
+		}
+		server := httptest.NewServer(fake)
+		defer server.Close()
+
+		classifier := predictor.NewMockFakeNewsClassifier(t)
+		classifier.On("Classify", mock.Anything, mock.Anything).Return(func(_ context.Context, texts predictor.ClassifyRequest) predictor.ClassifyResponse {
+			return predictor.ClassifyResponse{Classification: make([]predictor.Classification, len(texts))}
+		}, nil)
+
+		client := twitter.New(server.Client(), "token", twitter.WithBaseURL(server.URL))
+		process := GetProcessFn(logger.New("DEBUG"), client, classifier)
+
+		response := process(context.Background(), JobRequest{
+			EntityID:  "1",
+			SinceID:   "1000",
+			MaxTweets: 1000,
+		})
+
+		assert.NoError(t, response.Error)
+		assert.False(t, response.Truncated)
+		assert.Equal(t, "1250", response.NewestTweetID)
+		// full pages keep the requests, and the rate limit they cost, down
+		assert.Equal(t, 3, fake.Requests(twittertest.EndpointUserTweets))
+	})
+
+	t.Run("tweet type modes", func(t *testing.T) {
+		fetcher := twitter.NewMockTweetsFetcher(t)
+		classifier := predictor.NewMockFakeNewsClassifier(t)
+
+		now := time.Now()
+		expectedFetchRequest := twitter.FetchTweetsRequest{
+			EntityID:   "entity",
+			StartTime:  now,
+			EndTime:    now,
+			MaxResults: twitter.FetchTweetsMaxResults,
+			Exclude:    []string{twitter.ExcludeReplies},
+		}
+		fetcher.On("FetchTweets", mock.Anything, mock.Anything, expectedFetchRequest).Return(
+			twitter.FetchTweetsResponse{Tweets: []twitter.Tweet{
+				{
+					ID:               "4",
+					Text:             "RT Original 1",
+					ReferencedTweets: []twitter.ReferencedTweet{{Type: twitter.ReferenceRetweeted, ID: "1"}},
+				},
+				{
+					ID:               "3",
+					Text:             "RT Original 1 again",
+					ReferencedTweets: []twitter.ReferencedTweet{{Type: twitter.ReferenceRetweeted, ID: "1"}},
+				},
+				{
+					ID:   "2",
+					Text: "Own tweet",
+				},
+			}},
+			nil,
+		)
+		fetcher.On("LookupTweets", mock.Anything, mock.Anything, []string{"1"}).Return(
+			[]twitter.Tweet{{ID: "1", Text: "Original 1"}},
+			nil,
+		)
+
+		classifier.On("Classify", mock.Anything, predictor.ClassifyRequest([]string{
+			"Own tweet", "Original 1",
+		})).Return(
+			predictor.ClassifyResponse{
+				Classification: []predictor.Classification{
+					predictor.Real,
+					predictor.Fake,
+				},
+			},
+			nil,
+		)
+
+		process := GetProcessFn(logger.New("DEBUG"), fetcher, classifier)
+
+		response := process(context.Background(), JobRequest{
+			EntityID:  "entity",
+			StartTime: now,
+			EndTime:   now,
+			Retweets:  database.TweetsOriginal,
+			Replies:   database.TweetsExcluded,
+		})
+
+		assert.NoError(t, response.Error)
+		assert.Equal(t, 1, len(response.FakeNewsTweets))
+		assert.Equal(t, "1", response.FakeNewsTweets[0].TweetID)
+		assert.Equal(t, "4", response.NewestTweetID)
+	})
+
+	t.Run("excluded streamed tweets", func(t *testing.T) {
+		fetcher := twitter.NewMockTweetsFetcher(t)
+		classifier := predictor.NewMockFakeNewsClassifier(t)
+
+		classifier.On("Classify", mock.Anything, predictor.ClassifyRequest([]string{"Own tweet"})).Return(
+			predictor.ClassifyResponse{
+				Classification: []predictor.Classification{predictor.Real},
+			},
+			nil,
+		)
+
+		process := GetProcessFn(logger.New("DEBUG"), fetcher, classifier)
+
+		response := process(context.Background(), JobRequest{
+			EntityID: "entity",
+			Tweets: []twitter.Tweet{
+				{
+					ID:               "3",
+					Text:             "Reply",
+					ReferencedTweets: []twitter.ReferencedTweet{{Type: twitter.ReferenceRepliedTo, ID: "1"}},
+				},
+				{
+					ID:   "2",
+					Text: "Own tweet",
+				},
+			},
+			Replies: database.TweetsExcluded,
+		})
+
+		assert.NoError(t, response.Error)
+		assert.Equal(t, "3", response.NewestTweetID)
+	})
+}
+
+func TestProcessPosts(t *testing.T) {
+	now := time.Now()
+	request := JobRequest{
+		EntityID:  "https://news.example/feed.xml",
+		Source:    database.SourceRSS,
+		StartTime: now,
+		EndTime:   now,
+		SinceTime: now.Add(-time.Hour),
+	}
+	expectedFetchRequest := source.FetchPostsRequest{
+		Account:   "https://news.example/feed.xml",
+		StartTime: now,
+		EndTime:   now,
+		SinceTime: now.Add(-time.Hour),
+	}
+
+	t.Run("success", func(t *testing.T) {
+		posts := source.NewMockPostsFetcher(t)
+		classifier := predictor.NewMockFakeNewsClassifier(t)
+
+		posts.On("FetchPosts", mock.Anything, mock.Anything, expectedFetchRequest).Return(source.FetchPostsResponse{Posts: []source.Post{
+			{ID: "b", Text: "Moon made of cheese", CreatedAt: now, URL: "https://news.example/b"},
+			{ID: "a", Text: "Weather is nice", CreatedAt: now.Add(-time.Minute), URL: "https://news.example/a"},
+		}}, nil)
+		classifier.On("Classify", mock.Anything, predictor.ClassifyRequest([]string{"Moon made of cheese", "Weather is nice"})).Return(
+			predictor.ClassifyResponse{Classification: []predictor.Classification{predictor.Fake, predictor.Real}},
+			nil,
+		)
+
+		process := GetProcessFn(logger.New("DEBUG"), twitter.NewMockTweetsFetcher(t), classifier, WithSource(database.SourceRSS, posts))
+		response := process(context.Background(), request)
+
+		assert.NoError(t, response.Error)
+		assert.Equal(t, request.EntityID, response.EntityID)
+		assert.Len(t, response.FakeNewsTweets, 1)
+		assert.Equal(t, "https://news.example/b", response.FakeNewsTweets[0].URL)
+		assert.Equal(t, database.SourceRSS, response.FakeNewsTweets[0].Source)
+		assert.Equal(t, "b", response.NewestTweetID)
+		assert.Equal(t, now, response.NewestTweetTime)
+		assert.False(t, response.Truncated)
+	})
+
+	t.Run("truncated", func(t *testing.T) {
+		posts := source.NewMockPostsFetcher(t)
+		classifier := predictor.NewMockFakeNewsClassifier(t)
+
+		request := JobRequest{
+			EntityID: "foo@mastodon.social",
+			Source:   database.SourceMastodon,
+			SinceID:  "100",
+			UntilID:  "200",
+			MaxPages: 1,
+		}
+		posts.On("FetchPosts", mock.Anything, mock.Anything, source.FetchPostsRequest{
+			Account:  "foo@mastodon.social",
+			SinceID:  "100",
+			UntilID:  "200",
+			MaxPages: 1,
+		}).Return(source.FetchPostsResponse{
+			Posts: []source.Post{
+				{ID: "199", Text: "Newer"},
+				{ID: "150", Text: "Older"},
+			},
+			Truncated: true,
+		}, nil)
+		classifier.On("Classify", mock.Anything, mock.Anything).Return(
+			predictor.ClassifyResponse{Classification: []predictor.Classification{predictor.Real, predictor.Real}},
+			nil,
+		)
+
+		process := GetProcessFn(logger.New("DEBUG"), twitter.NewMockTweetsFetcher(t), classifier, WithSource(database.SourceMastodon, posts))
+		response := process(context.Background(), request)
+
+		assert.NoError(t, response.Error)
+		assert.True(t, response.Truncated)
+		assert.Equal(t, "150", response.OldestTweetID)
+		assert.Equal(t, "199", response.NewestTweetID)
+	})
+
+	t.Run("missing feed", func(t *testing.T) {
+		posts := source.NewMockPostsFetcher(t)
+		posts.On("FetchPosts", mock.Anything, mock.Anything, expectedFetchRequest).Return(source.FetchPostsResponse{}, fmt.Errorf("error fetching feed: %w", source.ErrNotFound))
+
+		process := GetProcessFn(logger.New("DEBUG"), twitter.NewMockTweetsFetcher(t), predictor.NewMockFakeNewsClassifier(t), WithSource(database.SourceRSS, posts))
+		response := process(context.Background(), request)
+
+		assert.Error(t, response.Error)
+		assert.Equal(t, database.AccountDeleted, response.Unavailable)
+	})
+
+	t.Run("unsupported source", func(t *testing.T) {
+		process := GetProcessFn(logger.New("DEBUG"), twitter.NewMockTweetsFetcher(t), predictor.NewMockFakeNewsClassifier(t))
+		response := process(context.Background(), request)
+
+		assert.Error(t, response.Error)
 	})
 }
@@ -0,0 +1,66 @@
+package shard
+
+import (
+	"hash/fnv"
+	"sort"
+	"strconv"
+)
+
+const DefaultVirtualNodes = 100
+
+// Ring is a consistent hash ring distributing keys across members. When a member joins or
+// leaves only the keys owned by that member move, the rest keep their owner.
+type Ring struct {
+	hashes []uint32
+	owners map[uint32]string
+}
+
+func NewRing(members []string, virtualNodes int) *Ring {
+	if virtualNodes <= 0 {
+		virtualNodes = DefaultVirtualNodes
+	}
+
+	sorted := make([]string, len(members))
+	copy(sorted, members)
+	sort.Strings(sorted)
+
+	r := &Ring{
+		owners: make(map[uint32]string, len(sorted)*virtualNodes),
+	}
+
+	for _, m := range sorted {
+		for v := 0; v < virtualNodes; v++ {
+			h := hash(m + "#" + strconv.Itoa(v))
+			if _, taken := r.owners[h]; taken {
+				continue
+			}
+			r.owners[h] = m
+			r.hashes = append(r.hashes, h)
+		}
+	}
+
+	sort.Slice(r.hashes, func(i, j int) bool { return r.hashes[i] < r.hashes[j] })
+
+	return r
+}
+
+// Owner returns the member owning key, or an empty string if the ring has no members.
+func (r *Ring) Owner(key string) string {
+	if len(r.hashes) == 0 {
+		return ""
+	}
+
+	h := hash(key)
+	i := sort.Search(len(r.hashes), func(i int) bool { return r.hashes[i] >= h })
+	if i == len(r.hashes) {
+		i = 0
+	}
+
+	return r.owners[r.hashes[i]]
+}
+
+func hash(s string) uint32 {
+	h := fnv.New32a()
+	h.Write([]byte(s))
+	return h.Sum32()
+}
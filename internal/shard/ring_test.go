@@ -0,0 +1,52 @@
+package shard
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRing(t *testing.T) {
+
+	t.Run("empty ring", func(t *testing.T) {
+		r := NewRing(nil, 0)
+		assert.Equal(t, "", r.Owner("foo"))
+	})
+
+	t.Run("owner is stable regardless of member order", func(t *testing.T) {
+		r1 := NewRing([]string{"a", "b", "c"}, 0)
+		r2 := NewRing([]string{"c", "a", "b"}, 0)
+
+		for i := 0; i < 100; i++ {
+			key := fmt.Sprintf("entity%d", i)
+			assert.Equal(t, r1.Owner(key), r2.Owner(key))
+		}
+	})
+
+	t.Run("every member gets a share", func(t *testing.T) {
+		r := NewRing([]string{"a", "b", "c"}, 0)
+
+		counts := map[string]int{}
+		for i := 0; i < 1000; i++ {
+			counts[r.Owner(fmt.Sprintf("entity%d", i))]++
+		}
+
+		assert.Equal(t, 3, len(counts))
+		for _, c := range counts {
+			assert.Greater(t, c, 150)
+		}
+	})
+
+	t.Run("member leaving moves only its keys", func(t *testing.T) {
+		before := NewRing([]string{"a", "b", "c"}, 0)
+		after := NewRing([]string{"a", "b"}, 0)
+
+		for i := 0; i < 1000; i++ {
+			key := fmt.Sprintf("entity%d", i)
+			if owner := before.Owner(key); owner != "c" {
+				assert.Equal(t, owner, after.Owner(key))
+			}
+		}
+	})
+}
@@ -0,0 +1,237 @@
+package worker
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/kordape/ottct-poller-service/internal/database"
+	"github.com/kordape/ottct-poller-service/internal/processor"
+	"github.com/kordape/ottct-poller-service/pkg/twitter"
+)
+
+// syncAccountsLoop keeps the Twitter accounts of the entities in sync until ctx is done.
+func (w *Worker) syncAccountsLoop(ctx context.Context) {
+	ticker := time.NewTicker(w.accountSyncInterval)
+	defer ticker.Stop()
+
+	for {
+		if w.leading() {
+			if err := w.syncAccounts(ctx); err != nil {
+				w.log.Error(fmt.Sprintf("Failed to sync accounts: %v", err))
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// syncAccounts resolves usernames of entities without a Twitter ID and checks the accounts of
+// the rest by ID, which survives renames. Accounts that disappeared get flagged instead of failing on every tick.
+// With sharding, each replica only syncs the accounts of the entities it processes.
+func (w *Worker) syncAccounts(ctx context.Context) error {
+	entities, err := w.entityStorage.GetEntities(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get entities: %w", err)
+	}
+
+	entities, err = w.ownEntities(entities)
+	if err != nil {
+		return fmt.Errorf("failed to shard entities: %w", err)
+	}
+
+	accounts, err := w.accountStorage.GetAccounts(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get accounts: %w", err)
+	}
+
+	byTwitterID := map[string]database.Entity{}
+	byUsername := map[string]database.Entity{}
+	ids := []string{}
+	usernames := []string{}
+	for _, e := range entities {
+		if !e.IsTwitter() {
+			continue
+		}
+
+		if e.TwitterId != "" {
+			byTwitterID[e.TwitterId] = e
+			ids = append(ids, e.TwitterId)
+			continue
+		}
+
+		if username := accounts[e.ID].Username; username != "" {
+			byUsername[strings.ToLower(username)] = e
+			usernames = append(usernames, username)
+		}
+	}
+
+	now := time.Now()
+	updated := []database.Account{}
+	update := func(e database.Entity, user twitter.User, status database.AccountStatus) {
+		a := accounts[e.ID]
+		if a.Status != status {
+			w.log.Warn(fmt.Sprintf("Account of entity %s changed from %q to %q", e.ID, a.Status, status))
+		}
+
+		a.EntityID = e.ID
+		a.Status = status
+		a.CheckedAt = now
+		if user.ID != "" {
+			a.TwitterID = user.ID
+			a.Username = user.Username
+		}
+		updated = append(updated, a)
+	}
+
+	if len(ids) > 0 {
+		response, err := w.userResolver.LookupUserIDs(ctx, w.log, ids)
+		if err != nil {
+			return fmt.Errorf("failed to look up users: %w", err)
+		}
+
+		for _, u := range response.Users {
+			e, ok := byTwitterID[u.ID]
+			if !ok {
+				continue
+			}
+
+			a := accounts[e.ID]
+			status := database.AccountActive
+			if a.Status == database.AccountRenamed || (a.Username != "" && !strings.EqualFold(a.Username, u.Username)) {
+				status = database.AccountRenamed
+			}
+			update(e, u, status)
+		}
+
+		for id, state := range response.Unavailable {
+			if e, ok := byTwitterID[id]; ok {
+				status := database.AccountDeleted
+				if state == twitter.AccountSuspended {
+					status = database.AccountSuspended
+				}
+				update(e, twitter.User{}, status)
+			}
+		}
+	}
+
+	if len(usernames) > 0 {
+		response, err := w.userResolver.LookupUsernames(ctx, w.log, usernames)
+		if err != nil {
+			return fmt.Errorf("failed to look up usernames: %w", err)
+		}
+
+		for _, u := range response.Users {
+			e, ok := byUsername[strings.ToLower(u.Username)]
+			if !ok {
+				continue
+			}
+
+			if err := w.accountStorage.SetTwitterID(ctx, e.ID, u.ID); err != nil {
+				w.log.Error(fmt.Sprintf("Failed to set twitter ID of entity %s: %v", e.ID, err))
+				continue
+			}
+			update(e, u, database.AccountActive)
+		}
+
+		for username, state := range response.Unavailable {
+			if e, ok := byUsername[strings.ToLower(username)]; ok {
+				status := database.AccountUnresolved
+				if state == twitter.AccountSuspended {
+					status = database.AccountSuspended
+				}
+				update(e, twitter.User{}, status)
+			}
+		}
+	}
+
+	if err := w.accountStorage.SaveAccounts(ctx, updated); err != nil {
+		return fmt.Errorf("failed to save accounts: %w", err)
+	}
+
+	w.log.Info(fmt.Sprintf("Synced %d accounts", len(updated)))
+
+	return nil
+}
+
+// flagUnavailableAccounts records accounts that turned out to be unavailable while fetching their tweets,
+// so they are skipped until the next account sync finds them available again.
+func (w *Worker) flagUnavailableAccounts(ctx context.Context, results processor.JobResults, entitiesByAccountID map[string]database.Entity) {
+	if w.accountStorage == nil {
+		return
+	}
+
+	unavailable := []processor.JobResult{}
+	for _, result := range results {
+		// accounts of other sources aren't synced, so they are only deferred
+		if result.Unavailable != "" && entitiesByAccountID[result.EntityID].IsTwitter() {
+			unavailable = append(unavailable, result)
+		}
+	}
+
+	if len(unavailable) == 0 {
+		return
+	}
+
+	accounts, err := w.accountStorage.GetAccounts(ctx)
+	if err != nil {
+		w.log.Error(fmt.Sprintf("Failed to flag unavailable accounts: %v", err))
+		return
+	}
+
+	now := time.Now()
+	flagged := make([]database.Account, 0, len(unavailable))
+	for _, result := range unavailable {
+		e := entitiesByAccountID[result.EntityID]
+		a := accounts[e.ID]
+		a.EntityID = e.ID
+		a.TwitterID = e.TwitterId
+		a.Status = result.Unavailable
+		a.CheckedAt = now
+		flagged = append(flagged, a)
+	}
+
+	if err := w.accountStorage.SaveAccounts(ctx, flagged); err != nil {
+		w.log.Error(fmt.Sprintf("Failed to flag unavailable accounts: %v", err))
+	}
+}
+
+// availableEntities drops entities whose tweets can't be fetched, because their username wasn't
+// resolved yet or their account is flagged as unavailable.
+func (w *Worker) availableEntities(ctx context.Context, entities []database.Entity) ([]database.Entity, error) {
+	if w.accountStorage == nil {
+		return entities, nil
+	}
+
+	accounts, err := w.accountStorage.GetAccounts(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	available := []database.Entity{}
+	for _, e := range entities {
+		if !e.IsTwitter() {
+			available = append(available, e)
+			continue
+		}
+
+		if e.TwitterId == "" {
+			w.log.Debug(fmt.Sprintf("Entity %s has no twitter ID yet, skipping", e.ID))
+			continue
+		}
+
+		if a, ok := accounts[e.ID]; ok && !a.Status.Available() {
+			w.log.Debug(fmt.Sprintf("Account of entity %s is %s, skipping", e.ID, a.Status))
+			continue
+		}
+
+		available = append(available, e)
+	}
+
+	return available, nil
+}
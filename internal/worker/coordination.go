@@ -0,0 +1,147 @@
+package worker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"github.com/kordape/ottct-poller-service/internal/database"
+	"github.com/kordape/ottct-poller-service/internal/shard"
+)
+
+// coordinationLoop renews the leader lease and sends the replica heartbeat a few times per ttl until ctx
+// is done, so they don't lapse while a long tick is running or ticks are skipped.
+func (w *Worker) coordinationLoop(ctx context.Context) {
+	ticker := time.NewTicker(w.coordinationInterval())
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			w.coordinate(ctx)
+		}
+	}
+}
+
+// coordinationInterval is a third of the shortest ttl, leaving two renewals to fail before it runs out.
+func (w *Worker) coordinationInterval() time.Duration {
+	ttl := w.leaseTTL
+	if w.replicaRegistry != nil && (ttl == 0 || w.replicaTTL < ttl) {
+		ttl = w.replicaTTL
+	}
+
+	return ttl / 3
+}
+
+func (w *Worker) coordinate(ctx context.Context) {
+	if w.leaderElector != nil {
+		w.renewLease(ctx)
+	}
+
+	if w.replicaRegistry != nil {
+		w.heartbeat(ctx)
+	}
+}
+
+// renewLease acquires or renews the leader lease. A failed renewal keeps the leadership until the
+// lease taken last runs out, as no other replica can take it over before then.
+func (w *Worker) renewLease(ctx context.Context) {
+	start := time.Now()
+	leader, err := w.leaderElector.IsLeader(ctx)
+	if err != nil {
+		w.log.Error(fmt.Sprintf("Leader election failed: %v", err))
+		return
+	}
+
+	var until int64
+	if leader {
+		// the lease expires by the database clock, leave some margin for the clocks drifting apart
+		until = start.Add(w.leaseTTL - w.leaseTTL/10).UnixNano()
+	}
+
+	previous := atomic.SwapInt64(&w.leaderUntil, until)
+	switch wasLeader := previous > start.UnixNano(); {
+	case leader && !wasLeader:
+		w.log.Info("Became the leader")
+	case !leader && wasLeader:
+		w.log.Warn("Lost leadership")
+	}
+}
+
+// stepDown gives up the leadership and the share of the entities until the worker is started again,
+// so ticks still running drop their results.
+func (w *Worker) stepDown() {
+	atomic.StoreInt64(&w.leaderUntil, 0)
+
+	if w.replicaRegistry != nil {
+		w.replicasMu.Lock()
+		w.replicasUntil = time.Time{}
+		w.replicasMu.Unlock()
+	}
+}
+
+// leading reports whether this worker should process ticks, i.e. it holds the leader lease, if any,
+// and its replica heartbeat is recent enough for the other replicas to account for it.
+func (w *Worker) leading() bool {
+	now := time.Now().UnixNano()
+	if w.leaderElector != nil && now >= atomic.LoadInt64(&w.leaderUntil) {
+		return false
+	}
+
+	if w.replicaRegistry != nil {
+		w.replicasMu.Lock()
+		defer w.replicasMu.Unlock()
+
+		return now < w.replicasUntil.UnixNano()
+	}
+
+	return true
+}
+
+func (w *Worker) heartbeat(ctx context.Context) {
+	start := time.Now()
+	replicas, err := w.replicaRegistry.Heartbeat(ctx, w.replicaID, w.replicaTTL)
+	if err != nil {
+		w.log.Error(fmt.Sprintf("Replica heartbeat failed: %v", err))
+		return
+	}
+
+	w.replicasMu.Lock()
+	defer w.replicasMu.Unlock()
+
+	w.replicas = replicas
+	w.replicasUntil = start.Add(w.replicaTTL)
+}
+
+// ownEntities filters entities down to the shard owned by this replica, according to the replicas
+// seen by the last heartbeat.
+func (w *Worker) ownEntities(entities []database.Entity) ([]database.Entity, error) {
+	if w.replicaRegistry == nil {
+		return entities, nil
+	}
+
+	w.replicasMu.Lock()
+	replicas := w.replicas
+	fresh := time.Now().Before(w.replicasUntil)
+	w.replicasMu.Unlock()
+
+	if !fresh {
+		return nil, errors.New("no recent replica heartbeat")
+	}
+
+	ring := shard.NewRing(replicas, shard.DefaultVirtualNodes)
+	owned := []database.Entity{}
+	for _, e := range entities {
+		if ring.Owner(e.ID) == w.replicaID {
+			owned = append(owned, e)
+		}
+	}
+
+	w.log.Info(fmt.Sprintf("Replica %s owns %d of %d entities across %d replicas", w.replicaID, len(owned), len(entities), len(replicas)))
+
+	return owned, nil
+}
@@ -0,0 +1,324 @@
+package worker
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"github.com/kordape/ottct-poller-service/internal/database"
+	"github.com/kordape/ottct-poller-service/internal/processor"
+	"github.com/kordape/ottct-poller-service/pkg/predictor"
+	"github.com/kordape/ottct-poller-service/pkg/source"
+	"github.com/kordape/ottct-poller-service/pkg/twitter"
+)
+
+const (
+	// maxPendingBackoff caps the wait between classifications of a pending tweet.
+	maxPendingBackoff = time.Hour
+	// pendingPurgeInterval is how often pending tweets of entities which are no longer polled are dropped.
+	pendingPurgeInterval = time.Hour
+)
+
+// keepUnclassified stores the tweets the predictor failed to classify, so they are classified on a later tick
+// instead of being lost. It returns the account IDs of the entities whose tweets were stored.
+func (w *Worker) keepUnclassified(ctx context.Context, results processor.JobResults, entitiesByAccountID map[string]database.Entity) map[string]bool {
+	now := time.Now()
+	kept := map[string]bool{}
+	pending := []database.PendingTweet{}
+	for _, result := range results {
+		if result.Error == nil || (len(result.Unclassified) == 0 && len(result.UnclassifiedPosts) == 0) {
+			continue
+		}
+
+		entity, ok := entitiesByAccountID[result.EntityID]
+		if !ok {
+			continue
+		}
+
+		attempts := 1
+		if predictor.Unavailable(result.Error) {
+			attempts = 0
+		}
+
+		entityPending := []database.PendingTweet{}
+		for _, t := range result.Unclassified {
+			entityPending = append(entityPending, database.PendingTweet{
+				EntityID: result.EntityID,
+				Source:   database.SourceTwitter,
+				TweetID:  t.ID,
+			})
+		}
+		for _, p := range result.UnclassifiedPosts {
+			entityPending = append(entityPending, database.PendingTweet{
+				EntityID: result.EntityID,
+				Source:   entity.Source,
+				TweetID:  p.ID,
+			})
+		}
+
+		payloads, err := encodePending(result.Unclassified, result.UnclassifiedPosts)
+		if err != nil {
+			// the watermark stays, so the tweets are fetched again
+			w.log.Error(fmt.Sprintf("Failed to encode unclassified tweets of entity %s: %v", result.EntityID, err))
+			continue
+		}
+
+		for i := range entityPending {
+			entityPending[i].Payload = payloads[i]
+			entityPending[i].Attempts = attempts
+			entityPending[i].NextAttemptAt = result.RetryAfter
+			entityPending[i].CreatedAt = now
+		}
+
+		kept[result.EntityID] = true
+		pending = append(pending, entityPending...)
+	}
+
+	if len(pending) == 0 {
+		return kept
+	}
+
+	if err := w.pendingStorage.SavePendingTweets(ctx, pending); err != nil {
+		// the watermarks stay, so the tweets are fetched again
+		w.log.Error(fmt.Sprintf("Failed to save %d unclassified tweets: %v", len(pending), err))
+		return map[string]bool{}
+	}
+
+	w.log.Warn(fmt.Sprintf("Kept %d unclassified tweets of %d entities for a later tick", len(pending), len(kept)))
+
+	return kept
+}
+
+// retryPending classifies the due pending tweets of the entities processed successfully in this tick. It returns
+// the results of the classified tweets together with the pending tweets to delete once their events are delivered.
+// Tweets which failed again are backed off and kept until they run out of attempts. Failures while the predictor
+// is unavailable don't use up attempts, an outage only delays the tweets.
+// Pending tweets were already analyzed according to the tweet type modes, so they are classified as they are.
+func (w *Worker) retryPending(ctx context.Context, results processor.JobResults, entitiesByAccountID map[string]database.Entity, settings map[string]database.EntitySettings) (processor.JobResults, []database.PendingTweet) {
+	failed := map[string]bool{}
+	for _, result := range results {
+		if result.Error != nil {
+			failed[result.EntityID] = true
+		}
+	}
+
+	accountIDs := []string{}
+	for id := range entitiesByAccountID {
+		if !failed[id] {
+			accountIDs = append(accountIDs, id)
+		}
+	}
+
+	if len(accountIDs) == 0 {
+		return nil, nil
+	}
+
+	stored, err := w.pendingStorage.GetPendingTweets(ctx, accountIDs)
+	if err != nil {
+		w.log.Error(fmt.Sprintf("Failed to get pending tweets: %v", err))
+		return nil, nil
+	}
+
+	now := time.Now()
+	pending := []database.PendingTweet{}
+	for _, p := range stored {
+		if !now.Before(p.NextAttemptAt) {
+			pending = append(pending, p)
+		}
+	}
+
+	if len(pending) == 0 {
+		return nil, nil
+	}
+
+	pendingByAccountID := map[string][]database.PendingTweet{}
+	decoded := map[string]*processor.JobRequest{}
+	order := []string{}
+	malformed := []database.PendingTweet{}
+	for _, p := range pending {
+		request, ok := decoded[p.EntityID]
+		if !ok {
+			e := entitiesByAccountID[p.EntityID]
+			request = &processor.JobRequest{
+				EntityID:      p.EntityID,
+				Source:        e.Source,
+				FakeThreshold: settings[e.ID].FakeThreshold,
+			}
+			decoded[p.EntityID] = request
+			order = append(order, p.EntityID)
+		}
+
+		if err := decodePending(p, request); err != nil {
+			w.log.Error(fmt.Sprintf("Failed to decode pending tweet %s of entity %s: %v", p.TweetID, p.EntityID, err))
+			malformed = append(malformed, p)
+			continue
+		}
+		pendingByAccountID[p.EntityID] = append(pendingByAccountID[p.EntityID], p)
+	}
+
+	w.deletePending(ctx, malformed)
+
+	requests := []processor.JobRequest{}
+	for _, id := range order {
+		if len(pendingByAccountID[id]) > 0 {
+			requests = append(requests, *decoded[id])
+		}
+	}
+
+	if len(requests) == 0 {
+		return nil, nil
+	}
+
+	w.log.Info(fmt.Sprintf("Retrying classification of %d pending tweets of %d entities", len(pending), len(requests)))
+
+	classifiedResults := processor.JobResults{}
+	classified := []database.PendingTweet{}
+	retry := []database.PendingTweet{}
+	dropped := []database.PendingTweet{}
+	deferred := processor.JobResults{}
+	backOff := func(p database.PendingTweet, unavailable bool, retryAfter time.Time) {
+		if !unavailable {
+			p.Attempts++
+		}
+		if p.Attempts >= w.maxClassifyAttempts {
+			dropped = append(dropped, p)
+			return
+		}
+
+		p.NextAttemptAt = now.Add(w.pendingBackoff(p.Attempts))
+		if retryAfter.After(p.NextAttemptAt) {
+			p.NextAttemptAt = retryAfter
+		}
+		retry = append(retry, p)
+	}
+
+	for _, result := range w.pooledTasks(ctx, requests) {
+		if result.Error == nil {
+			classifiedResults = append(classifiedResults, result)
+
+			scored := map[string]bool{}
+			for _, id := range result.ClassifiedIDs {
+				scored[id] = true
+			}
+			for _, p := range pendingByAccountID[result.EntityID] {
+				if scored[p.TweetID] {
+					classified = append(classified, p)
+				} else {
+					// not expected as the tweets are classified as they are, but they are kept rather than lost
+					backOff(p, false, time.Time{})
+				}
+			}
+			continue
+		}
+
+		if !result.RetryAfter.IsZero() {
+			deferred = append(deferred, result)
+		}
+
+		unavailable := predictor.Unavailable(result.Error)
+		for _, p := range pendingByAccountID[result.EntityID] {
+			backOff(p, unavailable, result.RetryAfter)
+		}
+	}
+
+	w.deferEntities(deferred)
+
+	if err := w.pendingStorage.SavePendingTweets(ctx, retry); err != nil {
+		w.log.Error(fmt.Sprintf("Failed to save attempts of pending tweets: %v", err))
+	}
+
+	if len(dropped) > 0 {
+		w.log.Error(fmt.Sprintf("Giving up on %d pending tweets after %d failed classifications", len(dropped), w.maxClassifyAttempts))
+		w.deletePending(ctx, dropped)
+	}
+
+	return classifiedResults, classified
+}
+
+// pendingBackoff doubles the wait between classifications of a pending tweet with every failed attempt,
+// starting from the next tick.
+func (w *Worker) pendingBackoff(attempts int) time.Duration {
+	backoff := w.tickInterval
+	for i := 1; i < attempts && backoff < maxPendingBackoff; i++ {
+		backoff *= 2
+	}
+
+	if backoff > maxPendingBackoff {
+		return maxPendingBackoff
+	}
+
+	return backoff
+}
+
+// encodePending serializes the tweets, or posts of other sources, in the order they are given.
+func encodePending(tweets []twitter.Tweet, posts []source.Post) ([][]byte, error) {
+	payloads := [][]byte{}
+	for _, t := range tweets {
+		payload, err := json.Marshal(t)
+		if err != nil {
+			return nil, err
+		}
+		payloads = append(payloads, payload)
+	}
+
+	for _, p := range posts {
+		payload, err := json.Marshal(p)
+		if err != nil {
+			return nil, err
+		}
+		payloads = append(payloads, payload)
+	}
+
+	return payloads, nil
+}
+
+// decodePending adds the pending tweet, or post of other sources, to the request classifying it.
+func decodePending(pending database.PendingTweet, request *processor.JobRequest) error {
+	if pending.Source == "" || pending.Source == database.SourceTwitter {
+		var t twitter.Tweet
+		if err := json.Unmarshal(pending.Payload, &t); err != nil {
+			return err
+		}
+		request.Tweets = append(request.Tweets, t)
+		return nil
+	}
+
+	var p source.Post
+	if err := json.Unmarshal(pending.Payload, &p); err != nil {
+		return err
+	}
+	request.Posts = append(request.Posts, p)
+
+	return nil
+}
+
+// purgePending drops pending tweets of entities which are no longer polled, e.g. deleted or unavailable ones,
+// at most once per purge interval. entities are all the polled entities, not just the ones of this replica.
+func (w *Worker) purgePending(ctx context.Context, entities []database.Entity) {
+	now := time.Now()
+	purgedAt := atomic.LoadInt64(&w.pendingPurgedAt)
+	if now.Sub(time.Unix(0, purgedAt)) < pendingPurgeInterval || !atomic.CompareAndSwapInt64(&w.pendingPurgedAt, purgedAt, now.UnixNano()) {
+		return
+	}
+
+	accountIDs := make([]string, 0, len(entities))
+	for _, e := range entities {
+		accountIDs = append(accountIDs, e.AccountID())
+	}
+
+	if err := w.pendingStorage.DeletePendingTweetsExcept(ctx, accountIDs); err != nil {
+		w.log.Error(fmt.Sprintf("Failed to purge pending tweets: %v", err))
+	}
+}
+
+func (w *Worker) deletePending(ctx context.Context, pending []database.PendingTweet) {
+	if len(pending) == 0 {
+		return
+	}
+
+	if err := w.pendingStorage.DeletePendingTweets(ctx, pending); err != nil {
+		w.log.Error(fmt.Sprintf("Failed to delete pending tweets: %v", err))
+	}
+}
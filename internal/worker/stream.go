@@ -0,0 +1,194 @@
+package worker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/kordape/ottct-poller-service/internal/database"
+	"github.com/kordape/ottct-poller-service/pkg/twitter"
+)
+
+const (
+	streamRuleTag = "ottct-poller"
+	// streamBufferSize caps how many streamed tweets are kept per entity between ticks
+	streamBufferSize = 1000
+)
+
+// tweetBuffer holds streamed tweets per twitter user until they are processed.
+type tweetBuffer struct {
+	mu     sync.Mutex
+	tweets map[string][]twitter.Tweet
+	max    int
+}
+
+func newTweetBuffer(max int) *tweetBuffer {
+	return &tweetBuffer{
+		tweets: map[string][]twitter.Tweet{},
+		max:    max,
+	}
+}
+
+// add buffers a tweet and reports whether the oldest buffered tweet had to be dropped to make room.
+func (b *tweetBuffer) add(userID string, tweet twitter.Tweet) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	tweets := append(b.tweets[userID], tweet)
+	dropped := len(tweets) > b.max
+	if dropped {
+		tweets = tweets[len(tweets)-b.max:]
+	}
+	b.tweets[userID] = tweets
+
+	return dropped
+}
+
+// take returns buffered tweets of the user newer than sinceID. Tweets up to sinceID were already
+// processed, so they are dropped. The rest stay buffered until a later call confirms them the same way.
+func (b *tweetBuffer) take(userID, sinceID string) []twitter.Tweet {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	pending := []twitter.Tweet{}
+	for _, t := range b.tweets[userID] {
+		if sinceID == "" || twitter.NewerID(t.ID, sinceID) {
+			pending = append(pending, t)
+		}
+	}
+
+	if len(pending) == 0 {
+		delete(b.tweets, userID)
+		return pending
+	}
+
+	b.tweets[userID] = pending
+	result := make([]twitter.Tweet, len(pending))
+	copy(result, pending)
+
+	return result
+}
+
+// retain drops tweets of users not in userIDs, e.g. of entities removed since the tweets arrived.
+func (b *tweetBuffer) retain(userIDs map[string]bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for userID := range b.tweets {
+		if !userIDs[userID] {
+			delete(b.tweets, userID)
+		}
+	}
+}
+
+func (w *Worker) validateStream() error {
+	if w.streamer == nil {
+		return nil
+	}
+
+	// a filtered stream connection delivers every tweet once, it can't be split across replicas
+	if w.replicaRegistry != nil {
+		return errors.New("stream mode can't be combined with sharding")
+	}
+
+	return nil
+}
+
+// streamWhileLeading holds the stream connection only while this worker is the leader, as every
+// connection receives all the tweets and Twitter allows only one of them. It reconnects whenever
+// leadership comes back, until ctx is done.
+func (w *Worker) streamWhileLeading(ctx context.Context) {
+	if w.leaderElector == nil {
+		w.stream(ctx)
+		return
+	}
+
+	ticker := time.NewTicker(w.coordinationInterval())
+	defer ticker.Stop()
+
+	for {
+		if w.leading() {
+			w.log.Info("Connecting to the stream as the leader")
+			streamCtx, cancel := context.WithCancel(ctx)
+			done := make(chan struct{})
+			go func() {
+				defer close(done)
+				w.stream(streamCtx)
+			}()
+
+			for ctx.Err() == nil && w.leading() {
+				select {
+				case <-ctx.Done():
+				case <-ticker.C:
+				}
+			}
+
+			cancel()
+			<-done
+			if ctx.Err() == nil {
+				w.log.Warn("Lost leadership, disconnected from the stream")
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// stream consumes the filtered stream into the tweet buffer until ctx is done.
+func (w *Worker) stream(ctx context.Context) {
+	err := w.streamer.Stream(ctx, w.log, func(tweet twitter.StreamedTweet) {
+		if w.streamBuffer.add(tweet.AuthorID, tweet.Tweet) {
+			w.log.Warn(fmt.Sprintf("Stream buffer for user %s is full, dropped oldest tweet", tweet.AuthorID))
+		}
+	})
+
+	if err != nil && !errors.Is(err, context.Canceled) {
+		w.log.Error(fmt.Sprintf("Stream stopped with error: %v", err))
+	}
+}
+
+// syncStreamRules updates the stream rules to match entities, if they changed since the last sync.
+func (w *Worker) syncStreamRules(ctx context.Context, entities []database.Entity) {
+	userIDs := make([]string, 0, len(entities))
+	retained := make(map[string]bool, len(entities))
+	for _, e := range entities {
+		// entities of other sources are polled in stream mode too
+		if !e.IsTwitter() {
+			continue
+		}
+		userIDs = append(userIDs, e.TwitterId)
+		retained[e.TwitterId] = true
+	}
+	sort.Strings(userIDs)
+	w.streamBuffer.retain(retained)
+
+	rules := twitter.FromUsersRules(streamRuleTag, userIDs)
+	values := make([]string, len(rules))
+	for i, r := range rules {
+		values[i] = r.Value
+	}
+	signature := strings.Join(values, "\n")
+
+	w.streamRulesMu.Lock()
+	defer w.streamRulesMu.Unlock()
+
+	if w.streamRulesSynced && signature == w.streamRulesSignature {
+		return
+	}
+
+	if err := w.streamer.SyncStreamRules(ctx, w.log, streamRuleTag, rules); err != nil {
+		w.log.Error(fmt.Sprintf("Failed to sync stream rules: %v", err))
+		return
+	}
+
+	w.streamRulesSynced = true
+	w.streamRulesSignature = signature
+}
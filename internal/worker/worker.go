@@ -4,6 +4,9 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"sort"
+	"strings"
+	"sync"
 	"sync/atomic"
 	"time"
 
@@ -11,14 +14,64 @@ import (
 	"github.com/kordape/ottct-poller-service/internal/event"
 	"github.com/kordape/ottct-poller-service/internal/processor"
 	"github.com/kordape/ottct-poller-service/pkg/logger"
+	"github.com/kordape/ottct-poller-service/pkg/twitter"
 )
 
 const (
 	defaultTickInterval         = 10 * time.Second
-	defaultProcessorTimeoutInMs = 2 * int64(time.Millisecond)
-	taskPoolSize                = 2
+	defaultProcessorTimeoutInMs = int64(10000)
+	defaultPoolSize             = 2
+	defaultMaxClassifyAttempts  = 5
+
+	// unavailableEntityDelay is how long entities with suspended or deleted accounts are skipped
+	unavailableEntityDelay = time.Hour
+
+	// pageFetchTime is how long fetching a page of tweets is expected to take. Jobs fetch as many pages as
+	// fit into half of the processor timeout, the other half is left for classifying the tweets.
+	pageFetchTime = 500 * time.Millisecond
+
+	// abandonedTickWait is how long Stop waits for the in-flight ticks it cancelled before resigning
+	abandonedTickWait = 5 * time.Second
+)
+
+// OverlapPolicy decides what happens when a tick fires while the previous one is still running.
+type OverlapPolicy int
+
+const (
+	// OverlapSkip drops the tick.
+	OverlapSkip OverlapPolicy = iota
+	// OverlapQueueOne runs the tick as soon as the running one finishes, further ticks are dropped.
+	OverlapQueueOne
+	// OverlapAllow runs ticks concurrently.
+	OverlapAllow
 )
 
+func ParseOverlapPolicy(policy string) (OverlapPolicy, error) {
+	switch strings.ToLower(policy) {
+	case "skip":
+		return OverlapSkip, nil
+	case "queue-one":
+		return OverlapQueueOne, nil
+	case "allow":
+		return OverlapAllow, nil
+	default:
+		return OverlapSkip, fmt.Errorf("unknown overlap policy: %s", policy)
+	}
+}
+
+func (p OverlapPolicy) String() string {
+	switch p {
+	case OverlapSkip:
+		return "skip"
+	case OverlapQueueOne:
+		return "queue-one"
+	case OverlapAllow:
+		return "allow"
+	default:
+		return fmt.Sprintf("OverlapPolicy(%d)", int(p))
+	}
+}
+
 type Worker struct {
 	tickInterval time.Duration
 	log          logger.Interface
@@ -26,10 +79,65 @@ type Worker struct {
 	running     int32
 	stopChannel chan bool
 
+	// ctx is cancelled when in-flight ticks have to be abandoned on shutdown
+	ctx           context.Context
+	cancel        context.CancelFunc
+	inFlight      sync.WaitGroup
+	inFlightTicks int32
+
+	overlapPolicy OverlapPolicy
+	skippedTicks  int64
+
+	// poolSize is read at the start of every tick so it can be changed while running
+	poolSize           int32
+	maxEntitiesPerTick int
+	maxPagesPerEntity  int
+	maxTweetsPerEntity int
+
+	// deferred holds entities that can't be processed until the given time, keyed by twitter ID
+	deferredMu sync.Mutex
+	deferred   map[string]time.Time
+
+	// stream mode receives tweets from a filtered stream instead of polling for them
+	streamer             twitter.TweetsStreamer
+	streamBuffer         *tweetBuffer
+	streamCancel         context.CancelFunc
+	streamDone           chan struct{}
+	streamRulesMu        sync.Mutex
+	streamRulesSynced    bool
+	streamRulesSignature string
+
+	// accounts of the entities are synced with Twitter in the background
+	userResolver        twitter.UserResolver
+	accountStorage      database.AccountStorage
+	accountSyncInterval time.Duration
+	accountSyncDone     chan struct{}
+
+	settingsStorage database.SettingsStorage
+
+	// tweets the predictor failed to classify are retried on later ticks
+	pendingStorage      database.PendingTweetStorage
+	maxClassifyAttempts int
+	// pendingPurgedAt is when pending tweets of entities no longer polled were last dropped, in unix nanoseconds
+	pendingPurgedAt int64
+
 	processorTimeoutInMs int64
 	processor            processor.ProcessFn
 	fakeNewsEventSender  event.SendFakeNewsEventFn
 	entityStorage        database.EntityStorage
+	watermarkStorage     database.WatermarkStorage
+	leaderElector        database.LeaderElector
+	replicaRegistry      database.ReplicaRegistry
+	replicaID            string
+	replicaTTL           time.Duration
+
+	// the leader lease and the replica heartbeat are renewed in the background
+	leaseTTL         time.Duration
+	leaderUntil      int64
+	replicasMu       sync.Mutex
+	replicas         []string
+	replicasUntil    time.Time
+	coordinationDone chan struct{}
 }
 
 type Option func(w *Worker)
@@ -40,12 +148,117 @@ func WithInterval(interval time.Duration) Option {
 	}
 }
 
+// WithOverlapPolicy sets what happens with ticks firing while the previous tick is still running.
+func WithOverlapPolicy(policy OverlapPolicy) Option {
+	return func(w *Worker) {
+		w.overlapPolicy = policy
+	}
+}
+
+func WithPoolSize(size int) Option {
+	return func(w *Worker) {
+		w.poolSize = int32(size)
+	}
+}
+
+// WithMaxEntitiesPerTick limits how many entities are processed in a single tick, 0 means no limit.
+// Entities which were processed least recently go first, the rest catch up on following ticks.
+func WithMaxEntitiesPerTick(max int) Option {
+	return func(w *Worker) {
+		w.maxEntitiesPerTick = max
+	}
+}
+
+// WithMaxPagesPerEntity limits how many pages of tweets are fetched for an entity in a single job, 0 means as many
+// as fit into the processor timeout. Lower limits than the timeout allows take precedence.
+func WithMaxPagesPerEntity(max int) Option {
+	return func(w *Worker) {
+		w.maxPagesPerEntity = max
+	}
+}
+
+// WithMaxTweetsPerEntity limits how many tweets are fetched for an entity in a single job, 0 means no limit.
+// Tweets left out by a truncated job are caught up on by the following jobs of the entity.
+func WithMaxTweetsPerEntity(max int) Option {
+	return func(w *Worker) {
+		w.maxTweetsPerEntity = max
+	}
+}
+
+// WithProcessorTimeout bounds how long a single entity job may run before it is cancelled.
 func WithProcessorTimeout(timeoutInMs int64) Option {
 	return func(w *Worker) {
 		w.processorTimeoutInMs = timeoutInMs
 	}
 }
 
+// WithWatermarkStorage makes the worker resume each entity from its persisted watermark.
+// By default watermarks are kept in memory and each entity starts from the last tick interval after a restart.
+func WithWatermarkStorage(storage database.WatermarkStorage) Option {
+	return func(w *Worker) {
+		w.watermarkStorage = storage
+	}
+}
+
+// WithLeaderElector makes the worker process ticks only while it is the elected leader,
+// so multiple replicas don't poll the same entities. The lease lasts ttl and is renewed in the background.
+func WithLeaderElector(elector database.LeaderElector, ttl time.Duration) Option {
+	return func(w *Worker) {
+		w.leaderElector = elector
+		w.leaseTTL = ttl
+	}
+}
+
+// WithSharding makes the worker process only its share of the entities. Entities are
+// spread with consistent hashing across all replicas that sent a heartbeat within ttl.
+func WithSharding(registry database.ReplicaRegistry, replicaID string, ttl time.Duration) Option {
+	return func(w *Worker) {
+		w.replicaRegistry = registry
+		w.replicaID = replicaID
+		w.replicaTTL = ttl
+	}
+}
+
+// WithTweetStream switches the worker to stream mode. Tweets of the entities are received from
+// the filtered stream and classified on every tick, instead of being fetched by the processor.
+func WithTweetStream(streamer twitter.TweetsStreamer) Option {
+	return func(w *Worker) {
+		w.streamer = streamer
+	}
+}
+
+// WithAccountSync resolves usernames of entities to Twitter IDs and checks their accounts every interval.
+// Entities without a Twitter ID or with a suspended or deleted account are skipped until that changes.
+func WithAccountSync(resolver twitter.UserResolver, storage database.AccountStorage, interval time.Duration) Option {
+	return func(w *Worker) {
+		w.userResolver = resolver
+		w.accountStorage = storage
+		w.accountSyncInterval = interval
+	}
+}
+
+// WithPendingTweetStorage keeps tweets the predictor failed to classify in storage until they are classified.
+// By default they are kept in memory and lost after a restart.
+func WithPendingTweetStorage(storage database.PendingTweetStorage) Option {
+	return func(w *Worker) {
+		w.pendingStorage = storage
+	}
+}
+
+// WithMaxClassifyAttempts limits how many times the classification of a tweet is attempted before it is given up.
+func WithMaxClassifyAttempts(attempts int) Option {
+	return func(w *Worker) {
+		w.maxClassifyAttempts = attempts
+	}
+}
+
+// WithEntitySettings applies per entity settings, e.g. whether retweets are analyzed.
+func WithEntitySettings(storage database.SettingsStorage) Option {
+	return func(w *Worker) {
+		w.settingsStorage = storage
+	}
+}
+
 func NewWorker(log logger.Interface, processor processor.ProcessFn, fakeNewsEventSender event.SendFakeNewsEventFn, entityStorage database.EntityStorage, opts ...Option) (*Worker, error) {
 	stopChan := make(chan bool)
 
@@ -54,6 +267,13 @@ func NewWorker(log logger.Interface, processor processor.ProcessFn, fakeNewsEven
 		log:                  log,
 		stopChannel:          stopChan,
 		processorTimeoutInMs: defaultProcessorTimeoutInMs,
+		overlapPolicy:        OverlapSkip,
+		poolSize:             defaultPoolSize,
+		deferred:             map[string]time.Time{},
+		streamBuffer:         newTweetBuffer(streamBufferSize),
+		watermarkStorage:     database.NewMemoryWatermarkStorage(),
+		pendingStorage:       database.NewMemoryPendingTweetStorage(),
+		maxClassifyAttempts:  defaultMaxClassifyAttempts,
 		processor:            processor,
 		fakeNewsEventSender:  fakeNewsEventSender,
 		entityStorage:        entityStorage,
@@ -87,6 +307,66 @@ func (w *Worker) validate() error {
 		return errors.New("entity storage is nil")
 	}
 
+	if w.watermarkStorage == nil {
+		return errors.New("watermark storage is nil")
+	}
+
+	if w.pendingStorage == nil {
+		return errors.New("pending tweet storage is nil")
+	}
+
+	if w.maxClassifyAttempts <= 0 {
+		return errors.New("max classify attempts must be positive")
+	}
+
+	if w.overlapPolicy < OverlapSkip || w.overlapPolicy > OverlapAllow {
+		return fmt.Errorf("invalid overlap policy: %s", w.overlapPolicy)
+	}
+
+	if w.poolSize <= 0 {
+		return errors.New("pool size must be positive")
+	}
+
+	if w.maxEntitiesPerTick < 0 {
+		return errors.New("max entities per tick can't be negative")
+	}
+
+	if w.maxPagesPerEntity < 0 {
+		return errors.New("max pages per entity can't be negative")
+	}
+
+	if w.maxTweetsPerEntity < 0 {
+		return errors.New("max tweets per entity can't be negative")
+	}
+
+	if w.processorTimeoutInMs <= 0 {
+		return errors.New("processor timeout must be positive")
+	}
+
+	if w.replicaRegistry != nil && w.replicaID == "" {
+		return errors.New("replica ID is empty")
+	}
+
+	if w.leaderElector != nil && w.leaseTTL <= 0 {
+		return errors.New("leader lease ttl must be positive")
+	}
+
+	if w.replicaRegistry != nil && w.replicaTTL <= 0 {
+		return errors.New("replica TTL must be positive")
+	}
+
+	if w.accountStorage != nil && w.userResolver == nil {
+		return errors.New("user resolver is nil")
+	}
+
+	if w.accountStorage != nil && w.accountSyncInterval <= 0 {
+		return errors.New("account sync interval must be positive")
+	}
+
+	if err := w.validateStream(); err != nil {
+		return err
+	}
+
 	return nil
 }
 
@@ -100,28 +380,95 @@ func (w *Worker) Run() error {
 		return fmt.Errorf("Can't run worker. Validation error: %v", err)
 	}
 
+	if pages := w.maxPages(); w.maxTweetsPerEntity == 0 || w.maxTweetsPerEntity > pages*twitter.FetchTweetsMaxResults {
+		w.log.Warn(fmt.Sprintf("Jobs fetch at most %d pages within the processor timeout, up to %d tweets per entity", pages, pages*twitter.FetchTweetsMaxResults))
+	}
+
 	atomic.StoreInt32(&w.running, 1)
+	w.ctx, w.cancel = context.WithCancel(context.Background())
+
+	if w.leaderElector != nil || w.replicaRegistry != nil {
+		// the first tick shouldn't wait for the lease
+		w.coordinate(w.ctx)
+		w.coordinationDone = make(chan struct{})
+		go func() {
+			defer close(w.coordinationDone)
+			w.coordinationLoop(w.ctx)
+		}()
+	}
+
+	if w.streamer != nil {
+		var streamCtx context.Context
+		streamCtx, w.streamCancel = context.WithCancel(w.ctx)
+		w.streamDone = make(chan struct{})
+		go func() {
+			defer close(w.streamDone)
+			w.streamWhileLeading(streamCtx)
+		}()
+	}
+
+	if w.accountStorage != nil {
+		w.accountSyncDone = make(chan struct{})
+		go func() {
+			defer close(w.accountSyncDone)
+			w.syncAccountsLoop(w.ctx)
+		}()
+	}
+
 	ticker := time.NewTicker(w.tickInterval)
 
 	go func() {
+		// ticks report back when they finish unless the loop already exited
+		tickDone := make(chan struct{})
+		loopDone := make(chan struct{})
+		defer close(loopDone)
+
+		startTick := func() {
+			w.inFlight.Add(1)
+			atomic.AddInt32(&w.inFlightTicks, 1)
+			go func() {
+				defer w.inFlight.Done()
+				defer atomic.AddInt32(&w.inFlightTicks, -1)
+
+				w.tick(w.ctx)
+
+				select {
+				case tickDone <- struct{}{}:
+				case <-loopDone:
+				}
+			}()
+		}
+
+		runningTicks := 0
+		queued := false
 		for {
 			select {
 			case <-w.stopChannel:
 				ticker.Stop()
 				w.log.Info("Stopping worker")
 				return
+			case <-tickDone:
+				runningTicks--
+				if queued && runningTicks == 0 {
+					queued = false
+					runningTicks++
+					startTick()
+				}
 			case <-ticker.C:
-				go func() {
-					// create processing task
-					w.log.Info("Worker tick")
-					results, err := w.process()
-					if err != nil {
-						w.log.Error(fmt.Sprintf("Processor finished with error: %v", err))
+				if runningTicks > 0 && w.overlapPolicy != OverlapAllow {
+					if w.overlapPolicy == OverlapQueueOne && !queued {
+						queued = true
+						w.log.Info("Previous tick still running, queueing tick")
+						continue
 					}
-					w.log.Info(fmt.Sprintf("Worker tick done, got %d results", len(results)))
-					w.postProcess(results)
-				}()
 
+					skipped := atomic.AddInt64(&w.skippedTicks, 1)
+					w.log.Warn(fmt.Sprintf("Previous tick still running, skipping tick (%d skipped so far)", skipped))
+					continue
+				}
+
+				runningTicks++
+				startTick()
 			}
 		}
 	}()
@@ -129,42 +476,413 @@ func (w *Worker) Run() error {
 	return nil
 }
 
+func (w *Worker) tick(ctx context.Context) {
+	if !w.leading() {
+		w.log.Debug("Not the leader, skipping tick")
+		return
+	}
+
+	// create processing task
+	w.log.Info("Worker tick")
+	results, watermarks, classified, err := w.process(ctx)
+	if err != nil {
+		w.log.Error(fmt.Sprintf("Processor finished with error: %v", err))
+	}
+	w.log.Info(fmt.Sprintf("Worker tick done, got %d results", len(results)))
+
+	// another replica takes over the entities once the lease lapses, it mustn't get duplicates nor
+	// have its watermarks overwritten with older ones
+	if !w.leading() {
+		w.log.Warn("Lost leadership during the tick, dropping its results")
+		return
+	}
+	if err := w.postProcess(ctx, results); err != nil {
+		w.log.Error(fmt.Sprintf("Post processing failed: %v", err))
+		return
+	}
+	if !w.leading() {
+		w.log.Warn("Lost leadership while sending events, not saving watermarks")
+		return
+	}
+	w.saveWatermarks(ctx, watermarks)
+	w.deletePending(ctx, classified)
+}
+
+// SkippedTicks returns how many ticks were dropped because the previous tick was still running.
+func (w *Worker) SkippedTicks() int64 {
+	return atomic.LoadInt64(&w.skippedTicks)
+}
+
+// SetPoolSize changes the number of concurrent jobs, starting with the next tick.
+func (w *Worker) SetPoolSize(size int) error {
+	if size <= 0 {
+		return errors.New("pool size must be positive")
+	}
+
+	atomic.StoreInt32(&w.poolSize, int32(size))
+	w.log.Info(fmt.Sprintf("Worker pool size set to %d", size))
+
+	return nil
+}
+
+func (w *Worker) PoolSize() int {
+	return int(atomic.LoadInt32(&w.poolSize))
+}
+
 func (w *Worker) Running() bool {
 	return atomic.LoadInt32(&w.running) == 1
 }
 
-func (w *Worker) Stop() {
+// Stop stops scheduling new ticks and waits for the in-flight ones to deliver their events.
+// If ctx is done first, in-flight ticks are cancelled and an error reporting them is returned.
+// Their watermarks are not advanced, so the abandoned work is picked up again on the next run.
+// The lease and the share of the entities are given up before the cancelled ticks are waited for (up to
+// abandonedTickWait), so none of them delivers its results after another replica may have taken over.
+func (w *Worker) Stop(ctx context.Context) error {
+	if !w.Running() {
+		return nil
+	}
+
 	defer func() {
 		atomic.StoreInt32(&w.running, 0)
 	}()
 
 	w.stopChannel <- true
+
+	if w.streamer != nil {
+		// stop receiving tweets, the ones already buffered are flushed below
+		w.streamCancel()
+		<-w.streamDone
+	}
+
+	drained := make(chan struct{})
+	go func() {
+		w.inFlight.Wait()
+
+		// flush after the in-flight ticks so buffered tweets aren't processed twice
+		if w.streamer != nil {
+			atomic.AddInt32(&w.inFlightTicks, 1)
+			w.tick(w.ctx)
+			atomic.AddInt32(&w.inFlightTicks, -1)
+		}
+
+		close(drained)
+	}()
+
+	var err error
+	select {
+	case <-drained:
+		w.log.Info("All in-flight ticks finished")
+	case <-ctx.Done():
+		err = fmt.Errorf("abandoned %d in-flight ticks: %w", atomic.LoadInt32(&w.inFlightTicks), ctx.Err())
+	}
+	w.cancel()
+
+	if w.coordinationDone != nil {
+		<-w.coordinationDone
+	}
+
+	// the lease isn't renewed anymore, cancelled ticks must not deliver their results once it's resigned
+	w.stepDown()
+
+	if err != nil {
+		select {
+		case <-drained:
+		case <-time.After(abandonedTickWait):
+			w.log.Error(fmt.Sprintf("In-flight ticks still running %s after being cancelled", abandonedTickWait))
+		}
+	}
+
+	if w.accountStorage != nil {
+		<-w.accountSyncDone
+	}
+
+	// use a fresh context, ctx may already be done at this point
+	if w.replicaRegistry != nil {
+		if err := w.replicaRegistry.Deregister(context.Background(), w.replicaID); err != nil {
+			w.log.Error(fmt.Sprintf("Failed to deregister replica: %v", err))
+		}
+	}
+
+	if w.leaderElector != nil {
+		if err := w.leaderElector.Resign(context.Background()); err != nil {
+			w.log.Error(fmt.Sprintf("Failed to resign leadership: %v", err))
+		}
+	}
+
+	return err
 }
 
-func (w *Worker) process() (processor.JobResults, error) {
-	ctx := context.Background()
+// process runs one job per entity and returns the job results together with the watermarks
+// the successfully processed entities should advance to once their events are delivered, and
+// the pending tweets classified in the meantime, which are deleted then.
+func (w *Worker) process(ctx context.Context) (processor.JobResults, []database.Watermark, []database.PendingTweet, error) {
 	endTime := time.Now()
-	startTime := endTime.Add(-w.tickInterval)
+	defaultStartTime := endTime.Add(-w.tickInterval)
 
-	w.log.Info(fmt.Sprintf("Processing for interval: %s - %s", startTime.Format(time.RFC3339), endTime.Format(time.RFC3339)))
+	w.log.Info(fmt.Sprintf("Processing until: %s", endTime.Format(time.RFC3339)))
 
 	entities, err := w.entityStorage.GetEntities(ctx)
 	if err != nil {
-		return processor.JobResults{}, fmt.Errorf("failed to get entities: %w", err)
+		return processor.JobResults{}, nil, nil, fmt.Errorf("failed to get entities: %w", err)
+	}
+
+	entities, err = w.availableEntities(ctx, entities)
+	if err != nil {
+		return processor.JobResults{}, nil, nil, fmt.Errorf("failed to get accounts: %w", err)
 	}
 
-	requests := make([]processor.JobRequest, len(entities))
-	for i, e := range entities {
-		requests[i] = processor.JobRequest{
-			EntityID:  e.TwitterId,
-			StartTime: startTime,
-			EndTime:   endTime,
+	w.purgePending(ctx, entities)
+
+	entities, err = w.ownEntities(entities)
+	if err != nil {
+		return processor.JobResults{}, nil, nil, fmt.Errorf("failed to shard entities: %w", err)
+	}
+
+	watermarks, err := w.watermarkStorage.GetWatermarks(ctx)
+	if err != nil {
+		return processor.JobResults{}, nil, nil, fmt.Errorf("failed to get watermarks: %w", err)
+	}
+
+	w.resetMovedWatermarks(entities, watermarks)
+
+	settings := map[string]database.EntitySettings{}
+	if w.settingsStorage != nil {
+		settings, err = w.settingsStorage.GetSettings(ctx)
+		if err != nil {
+			return processor.JobResults{}, nil, nil, fmt.Errorf("failed to get entity settings: %w", err)
+		}
+
+		for id, s := range settings {
+			if !s.Retweets.Valid() || !s.Replies.Valid() || (s.FakeThreshold != 0 && !processor.ValidFakeThreshold(s.FakeThreshold)) {
+				w.log.Warn(fmt.Sprintf("Invalid settings of entity %s, analyzing all tweets with the default threshold", id))
+				delete(settings, id)
+			}
+		}
+	}
+
+	if w.streamer != nil {
+		w.syncStreamRules(ctx, entities)
+	}
+
+	entities = w.readyEntities(entities, endTime)
+	entities = w.budgetEntities(entities, watermarks)
+
+	// results are keyed by the account ID on the entity's source, so keep track of which entity each of them belongs to
+	entitiesByAccountID := make(map[string]database.Entity, len(entities))
+	requests := make([]processor.JobRequest, 0, len(entities))
+	// requests are kept by the account ID as well to tell catch-up jobs from the regular ones
+	requestsByAccountID := make(map[string]processor.JobRequest, len(entities))
+	for _, e := range entities {
+		entitiesByAccountID[e.AccountID()] = e
+
+		wm := watermarks[e.ID]
+		startTime := defaultStartTime
+		if !wm.ProcessedUntil.IsZero() && wm.ProcessedUntil.Before(endTime) {
+			startTime = wm.ProcessedUntil
 		}
+
+		request := processor.JobRequest{
+			EntityID:      e.AccountID(),
+			StartTime:     startTime,
+			EndTime:       endTime,
+			SinceID:       wm.LastTweetID,
+			SinceTime:     wm.LastTweetTime,
+			Source:        e.Source,
+			MaxPages:      w.maxPages(),
+			MaxTweets:     w.maxTweetsPerEntity,
+			Retweets:      settings[e.ID].Retweets,
+			Replies:       settings[e.ID].Replies,
+			FakeThreshold: settings[e.ID].FakeThreshold,
+		}
+
+		if w.streamer != nil && e.IsTwitter() {
+			// buffered tweets stay until the watermark confirms they were delivered
+			request.Tweets = w.streamBuffer.take(e.TwitterId, wm.LastTweetID)
+			if len(request.Tweets) == 0 {
+				continue
+			}
+		} else if wm.CatchUpUntilID != "" {
+			// newer tweets wait until the gap is closed, the watermark already points past them
+			w.log.Info(fmt.Sprintf("Catching up on tweets of entity %s older than %s", e.ID, wm.CatchUpUntilID))
+			request.SinceID = wm.CatchUpSinceID
+			request.UntilID = wm.CatchUpUntilID
+			if !wm.CatchUpStartTime.IsZero() {
+				request.StartTime = wm.CatchUpStartTime
+			}
+		}
+
+		requests = append(requests, request)
+		requestsByAccountID[e.AccountID()] = request
 	}
 
 	results := w.pooledTasks(ctx, requests)
-	return results, nil
 
+	nextWatermarks := []database.Watermark{}
+	w.deferEntities(results)
+	w.flagUnavailableAccounts(ctx, results, entitiesByAccountID)
+	kept := w.keepUnclassified(ctx, results, entitiesByAccountID)
+
+	for _, result := range results {
+		// the watermark of unclassified tweets advances, they are classified from the pending ones
+		if result.Error != nil && !kept[result.EntityID] {
+			continue
+		}
+
+		entity, ok := entitiesByAccountID[result.EntityID]
+		if !ok {
+			continue
+		}
+
+		next := watermarks[entity.ID]
+		next.EntityID = entity.ID
+		next.Source = sourceOf(entity)
+		next.ProcessedUntil = endTime
+		request := requestsByAccountID[result.EntityID]
+		catchingUp := request.UntilID != ""
+		switch {
+		case catchingUp && result.Truncated:
+			// the gap shrinks down to the oldest tweet fetched so far
+			next.CatchUpUntilID = result.OldestTweetID
+		case catchingUp:
+			next.CatchUpSinceID = ""
+			next.CatchUpUntilID = ""
+			next.CatchUpStartTime = time.Time{}
+		case result.Truncated:
+			next.CatchUpSinceID = next.LastTweetID
+			next.CatchUpUntilID = result.OldestTweetID
+			next.CatchUpStartTime = time.Time{}
+			if next.LastTweetID == "" {
+				next.CatchUpStartTime = request.StartTime
+			}
+		}
+
+		if result.NewestTweetID != "" && !catchingUp {
+			next.LastTweetID = result.NewestTweetID
+			next.LastTweetTime = result.NewestTweetTime
+		}
+		nextWatermarks = append(nextWatermarks, next)
+	}
+
+	retried, classified := w.retryPending(ctx, results, entitiesByAccountID, settings)
+
+	return append(results, retried...), nextWatermarks, classified, nil
+}
+
+// resetMovedWatermarks drops what the watermarks of entities moved to another source recorded about the
+// previous one, e.g. a Twitter ID would be newer than any Mastodon post. The new source is polled from
+// when the previous one was processed last.
+func (w *Worker) resetMovedWatermarks(entities []database.Entity, watermarks map[string]database.Watermark) {
+	for _, e := range entities {
+		wm, ok := watermarks[e.ID]
+		// watermarks recorded before they had a source are taken as they are
+		if !ok || wm.Source == "" || wm.Source == sourceOf(e) {
+			continue
+		}
+
+		w.log.Info(fmt.Sprintf("Entity %s moved from %s to %s, resetting its watermark", e.ID, wm.Source, sourceOf(e)))
+		watermarks[e.ID] = database.Watermark{
+			EntityID:       e.ID,
+			Source:         sourceOf(e),
+			ProcessedUntil: wm.ProcessedUntil,
+		}
+	}
+}
+
+// sourceOf is the source of the entity, spelling out Twitter.
+func sourceOf(e database.Entity) database.SourceType {
+	if e.IsTwitter() {
+		return database.SourceTwitter
+	}
+
+	return e.Source
+}
+
+// maxPages limits the pages fetched by a job, so it finishes within the processor timeout and the rest of
+// the tweets is caught up on by the next jobs instead of the job timing out without advancing the watermark.
+func (w *Worker) maxPages() int {
+	timeout := time.Duration(w.processorTimeoutInMs) * time.Millisecond
+	pages := int(timeout / 2 / pageFetchTime)
+	if pages < 1 {
+		pages = 1
+	}
+
+	if w.maxPagesPerEntity > 0 && w.maxPagesPerEntity < pages {
+		return w.maxPagesPerEntity
+	}
+
+	return pages
+}
+
+// readyEntities filters out entities deferred past now.
+func (w *Worker) readyEntities(entities []database.Entity, now time.Time) []database.Entity {
+	w.deferredMu.Lock()
+	defer w.deferredMu.Unlock()
+
+	ready := []database.Entity{}
+	for _, e := range entities {
+		if retryAfter, ok := w.deferred[e.AccountID()]; ok {
+			if now.Before(retryAfter) {
+				w.log.Debug(fmt.Sprintf("Entity %s deferred until %s", e.ID, retryAfter.Format(time.RFC3339)))
+				continue
+			}
+			delete(w.deferred, e.AccountID())
+		}
+		ready = append(ready, e)
+	}
+
+	return ready
+}
+
+// deferEntities reschedules entities whose results asked to be retried later. Their watermarks
+// are not advanced, so nothing is lost while they wait.
+func (w *Worker) deferEntities(results processor.JobResults) {
+	w.deferredMu.Lock()
+	defer w.deferredMu.Unlock()
+
+	for _, result := range results {
+		retryAfter := result.RetryAfter
+		if result.Unavailable != "" {
+			// the account won't come back soon, don't fail on it every tick
+			retryAfter = time.Now().Add(unavailableEntityDelay)
+		}
+
+		if retryAfter.IsZero() {
+			continue
+		}
+
+		w.log.Info(fmt.Sprintf("Rescheduling entity %s after %s", result.EntityID, retryAfter.Format(time.RFC3339)))
+		w.deferred[result.EntityID] = retryAfter
+	}
+}
+
+// budgetEntities caps entities to the per tick budget, preferring the ones processed least recently.
+func (w *Worker) budgetEntities(entities []database.Entity, watermarks map[string]database.Watermark) []database.Entity {
+	if w.maxEntitiesPerTick == 0 || len(entities) <= w.maxEntitiesPerTick {
+		return entities
+	}
+
+	sorted := make([]database.Entity, len(entities))
+	copy(sorted, entities)
+	// entities without a watermark have a zero ProcessedUntil and therefore go first
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return watermarks[sorted[i].ID].ProcessedUntil.Before(watermarks[sorted[j].ID].ProcessedUntil)
+	})
+
+	w.log.Info(fmt.Sprintf("Processing %d of %d entities this tick", w.maxEntitiesPerTick, len(entities)))
+
+	return sorted[:w.maxEntitiesPerTick]
+}
+
+func (w *Worker) saveWatermarks(ctx context.Context, watermarks []database.Watermark) {
+	if len(watermarks) == 0 {
+		return
+	}
+
+	err := w.watermarkStorage.SaveWatermarks(ctx, watermarks)
+	if err != nil {
+		w.log.Error(fmt.Sprintf("Failed to save watermarks: %v", err))
+	}
 }
 
 func (w *Worker) pooledTasks(ctx context.Context, requests []processor.JobRequest) processor.JobResults {
@@ -173,7 +891,8 @@ func (w *Worker) pooledTasks(ctx context.Context, requests []processor.JobReques
 	results := make(chan processor.JobResult, numJobs)
 	defer close(results)
 
-	for t := 0; t < taskPoolSize; t++ {
+	poolSize := w.PoolSize()
+	for t := 0; t < poolSize; t++ {
 		go w.task(ctx, t, jobs, results)
 	}
 
@@ -194,20 +913,46 @@ func (w *Worker) pooledTasks(ctx context.Context, requests []processor.JobReques
 
 func (w *Worker) task(ctx context.Context, id int, jobs <-chan processor.JobRequest, results chan<- processor.JobResult) {
 	for job := range jobs {
-		request := job
-		select {
-		case <-time.After(time.Millisecond * 2):
-			w.log.Info("PROCESSOR TIMEOUT")
-			results <- processor.JobResult{
-				EntityID: job.EntityID,
-				Error:    context.Canceled,
-			}
-		case results <- w.processor(ctx, request):
+		results <- w.runJob(ctx, job)
+	}
+}
+
+// runJob runs a single job under the configured processor timeout. The job context is cancelled
+// once the timeout expires, which aborts any outgoing requests made by the processor.
+func (w *Worker) runJob(ctx context.Context, request processor.JobRequest) processor.JobResult {
+	timeout := time.Duration(w.processorTimeoutInMs) * time.Millisecond
+	jobCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	// buffered so the processor goroutine can finish even if nobody is waiting for it anymore
+	done := make(chan processor.JobResult, 1)
+	go func() {
+		done <- w.processor(jobCtx, request)
+	}()
+
+	var result processor.JobResult
+	select {
+	case result = <-done:
+	case <-jobCtx.Done():
+		result = processor.JobResult{
+			EntityID: request.EntityID,
+			Error:    jobCtx.Err(),
 		}
 	}
+
+	// the processor may have returned the cancellation error itself just before the deadline fired
+	if result.Error != nil && errors.Is(jobCtx.Err(), context.DeadlineExceeded) {
+		w.log.Warn(fmt.Sprintf("Processor timed out after %s for entity %s", timeout, request.EntityID))
+		result.Error = &processor.TimeoutError{
+			EntityID: request.EntityID,
+			Timeout:  timeout,
+		}
+	}
+
+	return result
 }
 
-func (w *Worker) postProcess(results processor.JobResults) error {
+func (w *Worker) postProcess(ctx context.Context, results processor.JobResults) error {
 	events := []event.FakeNews{}
 
 	for _, result := range results {
@@ -221,11 +966,17 @@ func (w *Worker) postProcess(results processor.JobResults) error {
 				EntityId:  result.EntityID,
 				Timestamp: fakeNewsTweet.Timestamp,
 				Content:   fakeNewsTweet.Content,
+				TweetID:   fakeNewsTweet.TweetID,
+				URL:       fakeNewsTweet.URL,
+				Tweet:     fakeNewsTweet.Tweet,
+				Source:    fakeNewsTweet.Source,
+				Post:      fakeNewsTweet.Post,
+				Score:     fakeNewsTweet.Score,
 			})
 		}
 	}
 
-	err := w.fakeNewsEventSender(context.Background(), events)
+	err := w.fakeNewsEventSender(ctx, events)
 
 	if err != nil {
 		return errors.New("failed to send events")
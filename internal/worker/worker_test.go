@@ -2,8 +2,11 @@ package worker
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -11,6 +14,8 @@ import (
 	"github.com/kordape/ottct-poller-service/internal/event"
 	"github.com/kordape/ottct-poller-service/internal/processor"
 	"github.com/kordape/ottct-poller-service/pkg/logger"
+	"github.com/kordape/ottct-poller-service/pkg/predictor"
+	"github.com/kordape/ottct-poller-service/pkg/twitter"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
 )
@@ -61,7 +66,7 @@ func TestWorker(t *testing.T) {
 		assert.NoError(t, err)
 
 		time.Sleep(8 * time.Second)
-		w.Stop()
+		assert.NoError(t, w.Stop(context.Background()))
 	})
 
 	t.Run("single tick half results failed", func(t *testing.T) {
@@ -115,7 +120,7 @@ func TestWorker(t *testing.T) {
 		assert.NoError(t, err)
 
 		time.Sleep(8 * time.Second)
-		w.Stop()
+		assert.NoError(t, w.Stop(context.Background()))
 	})
 
 	t.Run("single tick processing timeout", func(t *testing.T) {
@@ -164,7 +169,7 @@ func TestWorker(t *testing.T) {
 		assert.NoError(t, err)
 
 		time.Sleep(8 * time.Second)
-		w.Stop()
+		assert.NoError(t, w.Stop(context.Background()))
 	})
 }
 
@@ -212,3 +217,1592 @@ func TestPooledTasks(t *testing.T) {
 	assert.NotNil(t, results)
 	assert.Equal(t, 4, len(results))
 }
+
+func TestProcessWatermarks(t *testing.T) {
+	log := logger.New("DEBUG")
+
+	eventSenderFn := func(ctx context.Context, events []event.FakeNews) error {
+		return nil
+	}
+
+	processedUntil := time.Now().Add(-time.Hour)
+	newestTweetTime := time.Now()
+
+	var mu sync.Mutex
+	requests := map[string]processor.JobRequest{}
+	processEntityFn := func(ctx context.Context, request processor.JobRequest) processor.JobResult {
+		mu.Lock()
+		requests[request.EntityID] = request
+		mu.Unlock()
+
+		if request.EntityID == "baz" {
+			return processor.JobResult{
+				EntityID: request.EntityID,
+				Error:    errors.New("big error"),
+			}
+		}
+
+		if request.EntityID == "bar" {
+			return processor.JobResult{
+				EntityID: request.EntityID,
+			}
+		}
+
+		return processor.JobResult{
+			EntityID:        request.EntityID,
+			NewestTweetID:   "42",
+			NewestTweetTime: newestTweetTime,
+		}
+	}
+
+	db := database.NewMockEntityStorage(t)
+	db.On("GetEntities", mock.Anything).Return([]database.Entity{
+		{
+			ID:          "id1",
+			TwitterId:   "foo",
+			DisplayName: "foo",
+		},
+		{
+			ID:          "id2",
+			TwitterId:   "bar",
+			DisplayName: "bar",
+		},
+		{
+			ID:          "id3",
+			TwitterId:   "baz",
+			DisplayName: "baz",
+		},
+	}, nil)
+
+	watermarkStorage := database.NewMockWatermarkStorage(t)
+	watermarkStorage.On("GetWatermarks", mock.Anything).Return(map[string]database.Watermark{
+		"id2": {
+			EntityID:       "id2",
+			LastTweetID:    "7",
+			ProcessedUntil: processedUntil,
+		},
+	}, nil)
+
+	w, err := NewWorker(log, processEntityFn, eventSenderFn, db, WithInterval(5*time.Second), WithWatermarkStorage(watermarkStorage))
+	assert.NoError(t, err)
+
+	results, watermarks, _, err := w.process(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, 3, len(results))
+
+	endTime := requests["foo"].EndTime
+	assert.Equal(t, endTime.Add(-5*time.Second), requests["foo"].StartTime)
+	assert.Equal(t, processedUntil, requests["bar"].StartTime)
+	assert.Equal(t, "7", requests["bar"].SinceID)
+	assert.Empty(t, requests["foo"].SinceID)
+	assert.Equal(t, endTime.Add(-5*time.Second), requests["baz"].StartTime)
+
+	assert.ElementsMatch(t, []database.Watermark{
+		{
+			EntityID:       "id1",
+			Source:         database.SourceTwitter,
+			LastTweetID:    "42",
+			LastTweetTime:  newestTweetTime,
+			ProcessedUntil: endTime,
+		},
+		{
+			EntityID:       "id2",
+			Source:         database.SourceTwitter,
+			LastTweetID:    "7",
+			ProcessedUntil: endTime,
+		},
+	}, watermarks)
+}
+
+func TestProcessMovedEntity(t *testing.T) {
+	log := logger.New("DEBUG")
+	processedUntil := time.Now().Add(-time.Minute).Truncate(time.Second)
+
+	requests := []processor.JobRequest{}
+	processEntityFn := func(ctx context.Context, request processor.JobRequest) processor.JobResult {
+		requests = append(requests, request)
+		return processor.JobResult{
+			EntityID:      request.EntityID,
+			NewestTweetID: "110",
+		}
+	}
+
+	db := database.NewMockEntityStorage(t)
+	db.On("GetEntities", mock.Anything).Return([]database.Entity{
+		{ID: "id1", Source: database.SourceMastodon, SourceAccount: "foo@mastodon.social"},
+	}, nil)
+
+	// the entity was moved from Twitter, which left a snowflake ID and a gap to catch up on
+	watermarkStorage := database.NewMockWatermarkStorage(t)
+	watermarkStorage.On("GetWatermarks", mock.Anything).Return(map[string]database.Watermark{
+		"id1": {
+			EntityID:       "id1",
+			Source:         database.SourceTwitter,
+			LastTweetID:    "1600000000000000000",
+			ProcessedUntil: processedUntil,
+			CatchUpSinceID: "1500000000000000000",
+			CatchUpUntilID: "1550000000000000000",
+		},
+	}, nil)
+
+	w, err := NewWorker(log, processEntityFn, func(ctx context.Context, events []event.FakeNews) error {
+		return nil
+	}, db, WithWatermarkStorage(watermarkStorage))
+	assert.NoError(t, err)
+
+	_, watermarks, _, err := w.process(context.Background())
+	assert.NoError(t, err)
+
+	assert.Len(t, requests, 1)
+	assert.Empty(t, requests[0].SinceID)
+	assert.Empty(t, requests[0].UntilID)
+	assert.Equal(t, processedUntil, requests[0].StartTime)
+
+	assert.Equal(t, []database.Watermark{{
+		EntityID:       "id1",
+		Source:         database.SourceMastodon,
+		LastTweetID:    "110",
+		ProcessedUntil: requests[0].EndTime,
+	}}, watermarks)
+}
+
+func TestTickLeaderElection(t *testing.T) {
+	log := logger.New("DEBUG")
+
+	eventSenderFn := func(ctx context.Context, events []event.FakeNews) error {
+		return nil
+	}
+
+	processEntityFn := func(ctx context.Context, request processor.JobRequest) processor.JobResult {
+		return processor.JobResult{
+			EntityID: request.EntityID,
+		}
+	}
+
+	t.Run("follower skips tick", func(t *testing.T) {
+		db := database.NewMockEntityStorage(t)
+		elector := database.NewMockLeaderElector(t)
+		elector.On("IsLeader", mock.Anything).Return(false, nil)
+
+		w, err := NewWorker(log, processEntityFn, eventSenderFn, db, WithLeaderElector(elector, time.Minute))
+		assert.NoError(t, err)
+
+		w.coordinate(context.Background())
+		w.tick(context.Background())
+		db.AssertNotCalled(t, "GetEntities", mock.Anything)
+	})
+
+	t.Run("election error skips tick", func(t *testing.T) {
+		db := database.NewMockEntityStorage(t)
+		elector := database.NewMockLeaderElector(t)
+		elector.On("IsLeader", mock.Anything).Return(false, errors.New("big error"))
+
+		w, err := NewWorker(log, processEntityFn, eventSenderFn, db, WithLeaderElector(elector, time.Minute))
+		assert.NoError(t, err)
+
+		w.coordinate(context.Background())
+		w.tick(context.Background())
+		db.AssertNotCalled(t, "GetEntities", mock.Anything)
+	})
+
+	t.Run("leader processes tick", func(t *testing.T) {
+		db := database.NewMockEntityStorage(t)
+		db.On("GetEntities", mock.Anything).Return([]database.Entity{
+			{
+				ID:          "id1",
+				TwitterId:   "foo",
+				DisplayName: "foo",
+			},
+		}, nil)
+		elector := database.NewMockLeaderElector(t)
+		elector.On("IsLeader", mock.Anything).Return(true, nil)
+
+		w, err := NewWorker(log, processEntityFn, eventSenderFn, db, WithLeaderElector(elector, time.Minute))
+		assert.NoError(t, err)
+
+		w.coordinate(context.Background())
+		w.tick(context.Background())
+	})
+
+	t.Run("lease lapsing during the tick drops its results", func(t *testing.T) {
+		db := database.NewMockEntityStorage(t)
+		db.On("GetEntities", mock.Anything).Return([]database.Entity{
+			{ID: "id1", TwitterId: "foo"},
+		}, nil)
+		elector := database.NewMockLeaderElector(t)
+		elector.On("IsLeader", mock.Anything).Return(true, nil).Once()
+		elector.On("IsLeader", mock.Anything).Return(false, nil).Once()
+		watermarkStorage := database.NewMockWatermarkStorage(t)
+		watermarkStorage.On("GetWatermarks", mock.Anything).Return(map[string]database.Watermark{}, nil)
+
+		var w *Worker
+		sent := false
+		w, err := NewWorker(log, func(ctx context.Context, request processor.JobRequest) processor.JobResult {
+			// another replica takes the lease over while the job runs
+			w.coordinate(ctx)
+			return processor.JobResult{
+				EntityID:       request.EntityID,
+				FakeNewsTweets: []processor.FakeNewsTweet{{TweetID: "1"}},
+				NewestTweetID:  "1",
+			}
+		}, func(ctx context.Context, events []event.FakeNews) error {
+			sent = true
+			return nil
+		}, db, WithLeaderElector(elector, time.Minute), WithWatermarkStorage(watermarkStorage))
+		assert.NoError(t, err)
+
+		w.coordinate(context.Background())
+		w.tick(context.Background())
+
+		assert.False(t, sent)
+		watermarkStorage.AssertNotCalled(t, "SaveWatermarks", mock.Anything, mock.Anything)
+	})
+
+	t.Run("renews the lease in the background", func(t *testing.T) {
+		var renewals int32
+		elector := database.NewMockLeaderElector(t)
+		elector.On("IsLeader", mock.Anything).Run(func(mock.Arguments) {
+			atomic.AddInt32(&renewals, 1)
+		}).Return(true, nil)
+		elector.On("Resign", mock.Anything).Return(nil)
+
+		w, err := NewWorker(log, processEntityFn, eventSenderFn, database.NewMockEntityStorage(t),
+			WithLeaderElector(elector, 300*time.Millisecond), WithInterval(time.Hour))
+		assert.NoError(t, err)
+
+		assert.NoError(t, w.Run())
+		time.Sleep(time.Second)
+		assert.True(t, w.leading())
+		assert.NoError(t, w.Stop(context.Background()))
+
+		// without any tick running
+		assert.GreaterOrEqual(t, atomic.LoadInt32(&renewals), int32(4))
+	})
+}
+
+func TestProcessSharding(t *testing.T) {
+	log := logger.New("DEBUG")
+
+	eventSenderFn := func(ctx context.Context, events []event.FakeNews) error {
+		return nil
+	}
+
+	processEntityFn := func(ctx context.Context, request processor.JobRequest) processor.JobResult {
+		return processor.JobResult{
+			EntityID: request.EntityID,
+		}
+	}
+
+	entities := make([]database.Entity, 50)
+	for i := range entities {
+		entities[i] = database.Entity{
+			ID:        fmt.Sprintf("id%d", i),
+			TwitterId: fmt.Sprintf("twitter%d", i),
+		}
+	}
+
+	replicas := []string{"replica1", "replica2", "replica3"}
+
+	seen := map[string]int{}
+	for _, replicaID := range replicas {
+		db := database.NewMockEntityStorage(t)
+		db.On("GetEntities", mock.Anything).Return(entities, nil)
+
+		registry := database.NewMockReplicaRegistry(t)
+		registry.On("Heartbeat", mock.Anything, replicaID, time.Minute).Return(replicas, nil)
+
+		w, err := NewWorker(log, processEntityFn, eventSenderFn, db, WithSharding(registry, replicaID, time.Minute))
+		assert.NoError(t, err)
+		w.coordinate(context.Background())
+
+		results, _, _, err := w.process(context.Background())
+		assert.NoError(t, err)
+		assert.NotEmpty(t, results)
+
+		for _, r := range results {
+			seen[r.EntityID]++
+		}
+	}
+
+	// every entity is processed by exactly one replica
+	assert.Equal(t, len(entities), len(seen))
+	for _, count := range seen {
+		assert.Equal(t, 1, count)
+	}
+}
+
+func TestRunJob(t *testing.T) {
+	log := logger.New("DEBUG")
+
+	eventSenderFn := func(ctx context.Context, events []event.FakeNews) error {
+		return nil
+	}
+
+	t.Run("processor finishes in time", func(t *testing.T) {
+		processEntityFn := func(ctx context.Context, request processor.JobRequest) processor.JobResult {
+			_, hasDeadline := ctx.Deadline()
+			assert.True(t, hasDeadline)
+
+			return processor.JobResult{
+				EntityID: request.EntityID,
+			}
+		}
+
+		w, err := NewWorker(log, processEntityFn, eventSenderFn, database.NewMockEntityStorage(t), WithProcessorTimeout(1000))
+		assert.NoError(t, err)
+
+		result := w.runJob(context.Background(), processor.JobRequest{EntityID: "foo"})
+		assert.NoError(t, result.Error)
+		assert.Equal(t, "foo", result.EntityID)
+	})
+
+	t.Run("processor ignoring cancellation times out", func(t *testing.T) {
+		processEntityFn := func(ctx context.Context, request processor.JobRequest) processor.JobResult {
+			time.Sleep(time.Second)
+			return processor.JobResult{
+				EntityID: request.EntityID,
+			}
+		}
+
+		w, err := NewWorker(log, processEntityFn, eventSenderFn, database.NewMockEntityStorage(t), WithProcessorTimeout(10))
+		assert.NoError(t, err)
+
+		result := w.runJob(context.Background(), processor.JobRequest{EntityID: "foo"})
+		var timeoutErr *processor.TimeoutError
+		assert.ErrorAs(t, result.Error, &timeoutErr)
+		assert.Equal(t, "foo", timeoutErr.EntityID)
+		assert.ErrorIs(t, result.Error, context.DeadlineExceeded)
+	})
+
+	t.Run("processor cancelled by timeout", func(t *testing.T) {
+		cancelled := make(chan struct{})
+		processEntityFn := func(ctx context.Context, request processor.JobRequest) processor.JobResult {
+			<-ctx.Done()
+			close(cancelled)
+			return processor.JobResult{
+				EntityID: request.EntityID,
+				Error:    ctx.Err(),
+			}
+		}
+
+		w, err := NewWorker(log, processEntityFn, eventSenderFn, database.NewMockEntityStorage(t), WithProcessorTimeout(10))
+		assert.NoError(t, err)
+
+		result := w.runJob(context.Background(), processor.JobRequest{EntityID: "foo"})
+		var timeoutErr *processor.TimeoutError
+		assert.ErrorAs(t, result.Error, &timeoutErr)
+
+		select {
+		case <-cancelled:
+		case <-time.After(time.Second):
+			t.Fatal("processor context was not cancelled")
+		}
+	})
+
+	t.Run("invalid timeout", func(t *testing.T) {
+		_, err := NewWorker(log, func(ctx context.Context, request processor.JobRequest) processor.JobResult {
+			return processor.JobResult{}
+		}, eventSenderFn, database.NewMockEntityStorage(t), WithProcessorTimeout(0))
+		assert.Error(t, err)
+	})
+}
+
+func TestStop(t *testing.T) {
+	log := logger.New("DEBUG")
+
+	entities := []database.Entity{
+		{
+			ID:          "id1",
+			TwitterId:   "foo",
+			DisplayName: "foo",
+		},
+	}
+
+	t.Run("waits for in-flight tick to deliver events", func(t *testing.T) {
+		started := make(chan struct{}, 1)
+		processEntityFn := func(ctx context.Context, request processor.JobRequest) processor.JobResult {
+			select {
+			case started <- struct{}{}:
+			default:
+			}
+			time.Sleep(200 * time.Millisecond)
+			return processor.JobResult{
+				EntityID: request.EntityID,
+				FakeNewsTweets: []processor.FakeNewsTweet{
+					{
+						Content:   "Tweet",
+						Timestamp: time.Now(),
+					},
+				},
+			}
+		}
+
+		var sent int32
+		eventSenderFn := func(ctx context.Context, events []event.FakeNews) error {
+			atomic.AddInt32(&sent, int32(len(events)))
+			return nil
+		}
+
+		db := database.NewMockEntityStorage(t)
+		db.On("GetEntities", mock.Anything).Return(entities, nil)
+
+		w, err := NewWorker(log, processEntityFn, eventSenderFn, db, WithInterval(50*time.Millisecond))
+		assert.NoError(t, err)
+		assert.NoError(t, w.Run())
+
+		<-started
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		assert.NoError(t, w.Stop(ctx))
+		assert.False(t, w.Running())
+		assert.GreaterOrEqual(t, atomic.LoadInt32(&sent), int32(1))
+	})
+
+	t.Run("abandons in-flight tick after deadline", func(t *testing.T) {
+		started := make(chan struct{}, 1)
+		cancelled := make(chan struct{})
+		var once sync.Once
+		processEntityFn := func(ctx context.Context, request processor.JobRequest) processor.JobResult {
+			select {
+			case started <- struct{}{}:
+			default:
+			}
+			<-ctx.Done()
+			once.Do(func() { close(cancelled) })
+			return processor.JobResult{
+				EntityID: request.EntityID,
+				Error:    ctx.Err(),
+			}
+		}
+
+		eventSenderFn := func(ctx context.Context, events []event.FakeNews) error {
+			return nil
+		}
+
+		db := database.NewMockEntityStorage(t)
+		db.On("GetEntities", mock.Anything).Return(entities, nil)
+
+		w, err := NewWorker(log, processEntityFn, eventSenderFn, db, WithInterval(50*time.Millisecond))
+		assert.NoError(t, err)
+		assert.NoError(t, w.Run())
+
+		<-started
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+
+		err = w.Stop(ctx)
+		assert.ErrorIs(t, err, context.DeadlineExceeded)
+
+		select {
+		case <-cancelled:
+		case <-time.After(time.Second):
+			t.Fatal("in-flight job was not cancelled")
+		}
+	})
+
+	t.Run("drops results of abandoned tick before resigning", func(t *testing.T) {
+		processEntityFn := func(ctx context.Context, request processor.JobRequest) processor.JobResult {
+			return processor.JobResult{
+				EntityID:       request.EntityID,
+				FakeNewsTweets: []processor.FakeNewsTweet{{TweetID: "1"}},
+				NewestTweetID:  "1",
+			}
+		}
+
+		sending := make(chan struct{}, 1)
+		var delivered int32
+		eventSenderFn := func(ctx context.Context, events []event.FakeNews) error {
+			select {
+			case sending <- struct{}{}:
+			default:
+			}
+			<-ctx.Done()
+			// the sender ignores the cancellation for a while and still delivers the events
+			time.Sleep(100 * time.Millisecond)
+			atomic.StoreInt32(&delivered, 1)
+			return nil
+		}
+
+		db := database.NewMockEntityStorage(t)
+		db.On("GetEntities", mock.Anything).Return(entities, nil)
+		watermarkStorage := database.NewMockWatermarkStorage(t)
+		watermarkStorage.On("GetWatermarks", mock.Anything).Return(map[string]database.Watermark{}, nil)
+		elector := database.NewMockLeaderElector(t)
+		elector.On("IsLeader", mock.Anything).Return(true, nil)
+		elector.On("Resign", mock.Anything).Run(func(mock.Arguments) {
+			assert.Equal(t, int32(1), atomic.LoadInt32(&delivered), "resigned before the abandoned tick finished")
+		}).Return(nil)
+
+		w, err := NewWorker(log, processEntityFn, eventSenderFn, db, WithInterval(50*time.Millisecond),
+			WithLeaderElector(elector, time.Minute), WithWatermarkStorage(watermarkStorage))
+		assert.NoError(t, err)
+		assert.NoError(t, w.Run())
+
+		<-sending
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+
+		assert.ErrorIs(t, w.Stop(ctx), context.DeadlineExceeded)
+		assert.False(t, w.leading())
+		watermarkStorage.AssertNotCalled(t, "SaveWatermarks", mock.Anything, mock.Anything)
+		elector.AssertCalled(t, "Resign", mock.Anything)
+	})
+
+	t.Run("not running", func(t *testing.T) {
+		w, err := NewWorker(log, func(ctx context.Context, request processor.JobRequest) processor.JobResult {
+			return processor.JobResult{}
+		}, func(ctx context.Context, events []event.FakeNews) error {
+			return nil
+		}, database.NewMockEntityStorage(t))
+		assert.NoError(t, err)
+		assert.NoError(t, w.Stop(context.Background()))
+	})
+}
+
+func TestOverlapPolicy(t *testing.T) {
+	log := logger.New("DEBUG")
+
+	eventSenderFn := func(ctx context.Context, events []event.FakeNews) error {
+		return nil
+	}
+
+	run := func(t *testing.T, policy OverlapPolicy) (*Worker, int32) {
+		var concurrent, maxConcurrent int32
+		processEntityFn := func(ctx context.Context, request processor.JobRequest) processor.JobResult {
+			c := atomic.AddInt32(&concurrent, 1)
+			defer atomic.AddInt32(&concurrent, -1)
+			for {
+				m := atomic.LoadInt32(&maxConcurrent)
+				if c <= m || atomic.CompareAndSwapInt32(&maxConcurrent, m, c) {
+					break
+				}
+			}
+
+			time.Sleep(100 * time.Millisecond)
+			return processor.JobResult{
+				EntityID: request.EntityID,
+			}
+		}
+
+		db := database.NewMockEntityStorage(t)
+		db.On("GetEntities", mock.Anything).Return([]database.Entity{
+			{
+				ID:          "id1",
+				TwitterId:   "foo",
+				DisplayName: "foo",
+			},
+		}, nil)
+
+		w, err := NewWorker(log, processEntityFn, eventSenderFn, db, WithInterval(20*time.Millisecond), WithOverlapPolicy(policy))
+		assert.NoError(t, err)
+		assert.NoError(t, w.Run())
+
+		time.Sleep(300 * time.Millisecond)
+		assert.NoError(t, w.Stop(context.Background()))
+
+		return w, atomic.LoadInt32(&maxConcurrent)
+	}
+
+	t.Run("skip", func(t *testing.T) {
+		w, maxConcurrent := run(t, OverlapSkip)
+		assert.Equal(t, int32(1), maxConcurrent)
+		assert.Greater(t, w.SkippedTicks(), int64(0))
+	})
+
+	t.Run("queue one", func(t *testing.T) {
+		w, maxConcurrent := run(t, OverlapQueueOne)
+		assert.Equal(t, int32(1), maxConcurrent)
+		assert.Greater(t, w.SkippedTicks(), int64(0))
+	})
+
+	t.Run("allow", func(t *testing.T) {
+		w, maxConcurrent := run(t, OverlapAllow)
+		assert.Greater(t, maxConcurrent, int32(1))
+		assert.Equal(t, int64(0), w.SkippedTicks())
+	})
+
+	t.Run("parse", func(t *testing.T) {
+		for _, policy := range []OverlapPolicy{OverlapSkip, OverlapQueueOne, OverlapAllow} {
+			parsed, err := ParseOverlapPolicy(policy.String())
+			assert.NoError(t, err)
+			assert.Equal(t, policy, parsed)
+		}
+
+		_, err := ParseOverlapPolicy("whatever")
+		assert.Error(t, err)
+	})
+}
+
+func TestPoolBudget(t *testing.T) {
+	log := logger.New("DEBUG")
+
+	eventSenderFn := func(ctx context.Context, events []event.FakeNews) error {
+		return nil
+	}
+
+	t.Run("pool size limits concurrent jobs", func(t *testing.T) {
+		var concurrent, maxConcurrent int32
+		processEntityFn := func(ctx context.Context, request processor.JobRequest) processor.JobResult {
+			c := atomic.AddInt32(&concurrent, 1)
+			defer atomic.AddInt32(&concurrent, -1)
+			for {
+				m := atomic.LoadInt32(&maxConcurrent)
+				if c <= m || atomic.CompareAndSwapInt32(&maxConcurrent, m, c) {
+					break
+				}
+			}
+
+			time.Sleep(20 * time.Millisecond)
+			return processor.JobResult{
+				EntityID: request.EntityID,
+			}
+		}
+
+		w, err := NewWorker(log, processEntityFn, eventSenderFn, database.NewMockEntityStorage(t), WithPoolSize(3))
+		assert.NoError(t, err)
+
+		requests := make([]processor.JobRequest, 12)
+		for i := range requests {
+			requests[i] = processor.JobRequest{EntityID: fmt.Sprintf("%d", i)}
+		}
+
+		results := w.pooledTasks(context.Background(), requests)
+		assert.Equal(t, 12, len(results))
+		assert.Equal(t, int32(3), atomic.LoadInt32(&maxConcurrent))
+
+		assert.NoError(t, w.SetPoolSize(6))
+		assert.Error(t, w.SetPoolSize(0))
+		assert.Equal(t, 6, w.PoolSize())
+
+		atomic.StoreInt32(&maxConcurrent, 0)
+		results = w.pooledTasks(context.Background(), requests)
+		assert.Equal(t, 12, len(results))
+		assert.Equal(t, int32(6), atomic.LoadInt32(&maxConcurrent))
+	})
+
+	t.Run("entity budget prefers least recently processed", func(t *testing.T) {
+		var mu sync.Mutex
+		requests := []processor.JobRequest{}
+		processEntityFn := func(ctx context.Context, request processor.JobRequest) processor.JobResult {
+			mu.Lock()
+			requests = append(requests, request)
+			mu.Unlock()
+
+			return processor.JobResult{
+				EntityID: request.EntityID,
+			}
+		}
+
+		db := database.NewMockEntityStorage(t)
+		db.On("GetEntities", mock.Anything).Return([]database.Entity{
+			{ID: "id1", TwitterId: "foo"},
+			{ID: "id2", TwitterId: "bar"},
+			{ID: "id3", TwitterId: "baz"},
+		}, nil)
+
+		now := time.Now()
+		watermarkStorage := database.NewMockWatermarkStorage(t)
+		watermarkStorage.On("GetWatermarks", mock.Anything).Return(map[string]database.Watermark{
+			"id1": {EntityID: "id1", ProcessedUntil: now.Add(-time.Minute)},
+			"id2": {EntityID: "id2", ProcessedUntil: now.Add(-time.Hour)},
+		}, nil)
+
+		w, err := NewWorker(
+			log,
+			processEntityFn,
+			eventSenderFn,
+			db,
+			WithWatermarkStorage(watermarkStorage),
+			WithMaxEntitiesPerTick(2),
+			WithMaxPagesPerEntity(4),
+		)
+		assert.NoError(t, err)
+
+		results, _, _, err := w.process(context.Background())
+		assert.NoError(t, err)
+		assert.Equal(t, 2, len(results))
+
+		processed := []string{}
+		for _, r := range requests {
+			processed = append(processed, r.EntityID)
+			assert.Equal(t, 4, r.MaxPages)
+		}
+		assert.ElementsMatch(t, []string{"baz", "bar"}, processed)
+	})
+
+	t.Run("pages fit into the processor timeout", func(t *testing.T) {
+		newWorker := func(opts ...Option) *Worker {
+			w, err := NewWorker(log, func(ctx context.Context, request processor.JobRequest) processor.JobResult {
+				return processor.JobResult{EntityID: request.EntityID}
+			}, func(ctx context.Context, events []event.FakeNews) error {
+				return nil
+			}, database.NewMockEntityStorage(t), opts...)
+			assert.NoError(t, err)
+			return w
+		}
+
+		assert.Equal(t, 10, newWorker().maxPages())
+		assert.Equal(t, 2, newWorker(WithProcessorTimeout(2000)).maxPages())
+		assert.Equal(t, 1, newWorker(WithProcessorTimeout(100)).maxPages())
+		assert.Equal(t, 2, newWorker(WithMaxPagesPerEntity(2)).maxPages())
+		assert.Equal(t, 2, newWorker(WithMaxPagesPerEntity(4), WithProcessorTimeout(2000)).maxPages())
+	})
+}
+
+func TestProcessDeferral(t *testing.T) {
+	log := logger.New("DEBUG")
+
+	eventSenderFn := func(ctx context.Context, events []event.FakeNews) error {
+		return nil
+	}
+
+	var mu sync.Mutex
+	calls := map[string]int{}
+	processEntityFn := func(ctx context.Context, request processor.JobRequest) processor.JobResult {
+		mu.Lock()
+		calls[request.EntityID]++
+		mu.Unlock()
+
+		if request.EntityID == "foo" {
+			return processor.JobResult{
+				EntityID:   request.EntityID,
+				Error:      errors.New("rate limited"),
+				RetryAfter: time.Now().Add(time.Hour),
+			}
+		}
+
+		return processor.JobResult{
+			EntityID: request.EntityID,
+		}
+	}
+
+	db := database.NewMockEntityStorage(t)
+	db.On("GetEntities", mock.Anything).Return([]database.Entity{
+		{ID: "id1", TwitterId: "foo"},
+		{ID: "id2", TwitterId: "bar"},
+	}, nil)
+
+	w, err := NewWorker(log, processEntityFn, eventSenderFn, db)
+	assert.NoError(t, err)
+
+	results, watermarks, _, err := w.process(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, 2, len(results))
+	assert.Equal(t, 1, len(watermarks))
+
+	results, _, _, err = w.process(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(results))
+	assert.Equal(t, "bar", results[0].EntityID)
+
+	assert.Equal(t, 1, calls["foo"])
+	assert.Equal(t, 2, calls["bar"])
+}
+
+func TestProcessRemembersNewestTweet(t *testing.T) {
+	log := logger.New("DEBUG")
+
+	eventSenderFn := func(ctx context.Context, events []event.FakeNews) error {
+		return nil
+	}
+
+	var mu sync.Mutex
+	sinceIDs := []string{}
+	processEntityFn := func(ctx context.Context, request processor.JobRequest) processor.JobResult {
+		mu.Lock()
+		sinceIDs = append(sinceIDs, request.SinceID)
+		mu.Unlock()
+
+		return processor.JobResult{
+			EntityID:        request.EntityID,
+			NewestTweetID:   "42",
+			NewestTweetTime: time.Now(),
+		}
+	}
+
+	db := database.NewMockEntityStorage(t)
+	db.On("GetEntities", mock.Anything).Return([]database.Entity{
+		{ID: "id1", TwitterId: "foo"},
+	}, nil)
+
+	w, err := NewWorker(log, processEntityFn, eventSenderFn, db)
+	assert.NoError(t, err)
+
+	w.tick(context.Background())
+	w.tick(context.Background())
+
+	assert.Equal(t, []string{"", "42"}, sinceIDs)
+}
+
+func TestProcessCatchUp(t *testing.T) {
+	log := logger.New("DEBUG")
+
+	eventSenderFn := func(ctx context.Context, events []event.FakeNews) error {
+		return nil
+	}
+
+	// the first job and the first catch-up are truncated, the second catch-up closes the gap
+	responses := []processor.JobResult{
+		{NewestTweetID: "50", Truncated: true, OldestTweetID: "40"},
+		{NewestTweetID: "39", Truncated: true, OldestTweetID: "30"},
+		{NewestTweetID: "29"},
+		{NewestTweetID: "51"},
+	}
+
+	var mu sync.Mutex
+	requests := []processor.JobRequest{}
+	processEntityFn := func(ctx context.Context, request processor.JobRequest) processor.JobResult {
+		mu.Lock()
+		defer mu.Unlock()
+
+		result := responses[len(requests)]
+		result.EntityID = request.EntityID
+		requests = append(requests, request)
+		return result
+	}
+
+	db := database.NewMockEntityStorage(t)
+	db.On("GetEntities", mock.Anything).Return([]database.Entity{
+		{ID: "id1", TwitterId: "foo"},
+	}, nil)
+
+	watermarkStorage := database.NewMemoryWatermarkStorage()
+	err := watermarkStorage.SaveWatermarks(context.Background(), []database.Watermark{{EntityID: "id1", LastTweetID: "10"}})
+	assert.NoError(t, err)
+
+	w, err := NewWorker(log, processEntityFn, eventSenderFn, db, WithWatermarkStorage(watermarkStorage), WithMaxTweetsPerEntity(100))
+	assert.NoError(t, err)
+
+	for range responses {
+		w.tick(context.Background())
+	}
+
+	assert.Len(t, requests, 4)
+	sinceIDs := []string{}
+	untilIDs := []string{}
+	for _, r := range requests {
+		sinceIDs = append(sinceIDs, r.SinceID)
+		untilIDs = append(untilIDs, r.UntilID)
+		assert.Equal(t, 100, r.MaxTweets)
+	}
+	assert.Equal(t, []string{"10", "10", "10", "50"}, sinceIDs)
+	assert.Equal(t, []string{"", "40", "30", ""}, untilIDs)
+
+	watermarks, err := watermarkStorage.GetWatermarks(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, "51", watermarks["id1"].LastTweetID)
+	assert.Empty(t, watermarks["id1"].CatchUpUntilID)
+}
+
+func TestStreamMode(t *testing.T) {
+	log := logger.New("DEBUG")
+
+	eventSenderFn := func(ctx context.Context, events []event.FakeNews) error {
+		return nil
+	}
+
+	entities := []database.Entity{
+		{ID: "id1", TwitterId: "foo"},
+		{ID: "id2", TwitterId: "bar"},
+	}
+
+	t.Run("only the leader holds the stream", func(t *testing.T) {
+		var leader int32
+		elector := database.NewMockLeaderElector(t)
+		elector.On("IsLeader", mock.Anything).Return(func(context.Context) bool {
+			return atomic.LoadInt32(&leader) == 1
+		}, nil)
+		elector.On("Resign", mock.Anything).Return(nil)
+
+		connected := make(chan struct{}, 2)
+		disconnected := make(chan struct{}, 2)
+		streamer := twitter.NewMockTweetsStreamer(t)
+		streamer.On("Stream", mock.Anything, mock.Anything, mock.Anything).Return(
+			func(ctx context.Context, log logger.Interface, handler twitter.StreamHandler) error {
+				connected <- struct{}{}
+				<-ctx.Done()
+				disconnected <- struct{}{}
+				return ctx.Err()
+			},
+		)
+
+		streamer.On("SyncStreamRules", mock.Anything, mock.Anything, streamRuleTag, mock.Anything).Return(nil)
+
+		// buffered tweets are flushed on stop
+		db := database.NewMockEntityStorage(t)
+		db.On("GetEntities", mock.Anything).Return(entities, nil)
+
+		w, err := NewWorker(log, func(ctx context.Context, request processor.JobRequest) processor.JobResult {
+			return processor.JobResult{EntityID: request.EntityID}
+		}, eventSenderFn, db, WithTweetStream(streamer),
+			WithLeaderElector(elector, 30*time.Millisecond), WithInterval(time.Hour))
+		assert.NoError(t, err)
+
+		wait := func(events chan struct{}) bool {
+			select {
+			case <-events:
+				return true
+			case <-time.After(time.Second):
+				return false
+			}
+		}
+
+		assert.NoError(t, w.Run())
+		time.Sleep(50 * time.Millisecond)
+		assert.Empty(t, connected)
+
+		atomic.StoreInt32(&leader, 1)
+		assert.True(t, wait(connected), "leader didn't connect")
+
+		atomic.StoreInt32(&leader, 0)
+		assert.True(t, wait(disconnected), "follower didn't disconnect")
+
+		atomic.StoreInt32(&leader, 1)
+		assert.True(t, wait(connected), "leader didn't reconnect")
+
+		assert.NoError(t, w.Stop(context.Background()))
+	})
+
+	t.Run("processes buffered tweets", func(t *testing.T) {
+		var mu sync.Mutex
+		requests := []processor.JobRequest{}
+		processEntityFn := func(ctx context.Context, request processor.JobRequest) processor.JobResult {
+			mu.Lock()
+			requests = append(requests, request)
+			mu.Unlock()
+
+			return processor.JobResult{
+				EntityID:        request.EntityID,
+				NewestTweetID:   request.Tweets[len(request.Tweets)-1].ID,
+				NewestTweetTime: time.Now(),
+			}
+		}
+
+		streamer := twitter.NewMockTweetsStreamer(t)
+		streamer.On("SyncStreamRules", mock.Anything, mock.Anything, streamRuleTag, []twitter.StreamRule{
+			{Value: "from:bar OR from:foo", Tag: streamRuleTag},
+		}).Return(nil).Once()
+
+		db := database.NewMockEntityStorage(t)
+		db.On("GetEntities", mock.Anything).Return(entities, nil)
+
+		w, err := NewWorker(log, processEntityFn, eventSenderFn, db, WithTweetStream(streamer))
+		assert.NoError(t, err)
+
+		w.streamBuffer.add("foo", twitter.Tweet{ID: "1", Text: "Tweet 1"})
+		w.streamBuffer.add("foo", twitter.Tweet{ID: "2", Text: "Tweet 2"})
+		w.tick(context.Background())
+
+		// nothing new was streamed
+		w.tick(context.Background())
+
+		w.streamBuffer.add("foo", twitter.Tweet{ID: "3", Text: "Tweet 3"})
+		w.tick(context.Background())
+
+		assert.Equal(t, 2, len(requests))
+		assert.Equal(t, []twitter.Tweet{{ID: "1", Text: "Tweet 1"}, {ID: "2", Text: "Tweet 2"}}, requests[0].Tweets)
+		assert.Equal(t, []twitter.Tweet{{ID: "3", Text: "Tweet 3"}}, requests[1].Tweets)
+	})
+
+	t.Run("flushes buffered tweets on stop", func(t *testing.T) {
+		var processed int32
+		processEntityFn := func(ctx context.Context, request processor.JobRequest) processor.JobResult {
+			atomic.AddInt32(&processed, int32(len(request.Tweets)))
+			return processor.JobResult{
+				EntityID: request.EntityID,
+			}
+		}
+
+		streamed := make(chan struct{})
+		streamer := twitter.NewMockTweetsStreamer(t)
+		streamer.On("SyncStreamRules", mock.Anything, mock.Anything, streamRuleTag, mock.Anything).Return(nil)
+		streamer.On("Stream", mock.Anything, mock.Anything, mock.Anything).Return(
+			func(ctx context.Context, log logger.Interface, handler twitter.StreamHandler) error {
+				handler(twitter.StreamedTweet{Tweet: twitter.Tweet{ID: "1", AuthorID: "bar"}})
+				close(streamed)
+				<-ctx.Done()
+				return ctx.Err()
+			},
+		)
+
+		db := database.NewMockEntityStorage(t)
+		db.On("GetEntities", mock.Anything).Return(entities, nil)
+
+		w, err := NewWorker(log, processEntityFn, eventSenderFn, db, WithTweetStream(streamer), WithInterval(time.Hour))
+		assert.NoError(t, err)
+
+		assert.NoError(t, w.Run())
+		<-streamed
+		assert.NoError(t, w.Stop(context.Background()))
+
+		assert.Equal(t, int32(1), atomic.LoadInt32(&processed))
+	})
+}
+
+func TestSyncAccounts(t *testing.T) {
+	log := logger.New("DEBUG")
+
+	eventSenderFn := func(ctx context.Context, events []event.FakeNews) error {
+		return nil
+	}
+
+	processEntityFn := func(ctx context.Context, request processor.JobRequest) processor.JobResult {
+		return processor.JobResult{
+			EntityID: request.EntityID,
+		}
+	}
+
+	db := database.NewMockEntityStorage(t)
+	db.On("GetEntities", mock.Anything).Return([]database.Entity{
+		{ID: "id1", TwitterId: "1"},
+		{ID: "id2", TwitterId: "2"},
+		{ID: "id3", TwitterId: "3"},
+		{ID: "id4"},
+		{ID: "id5"},
+	}, nil)
+
+	stored := map[string]database.Account{
+		"id1": {EntityID: "id1", Username: "foo", TwitterID: "1", Status: database.AccountActive},
+		"id4": {EntityID: "id4", Username: "Bar"},
+		"id5": {EntityID: "id5", Username: "nobody"},
+	}
+	accounts := database.NewMockAccountStorage(t)
+	accounts.On("GetAccounts", mock.Anything).Return(func(ctx context.Context) map[string]database.Account {
+		result := map[string]database.Account{}
+		for id, a := range stored {
+			result[id] = a
+		}
+		return result
+	}, nil)
+
+	resolver := twitter.NewMockUserResolver(t)
+	resolver.On("LookupUserIDs", mock.Anything, mock.Anything, []string{"1", "2", "3"}).Return(twitter.UsersLookupResponse{
+		Users: []twitter.User{
+			{ID: "1", Username: "renamed_foo"},
+			{ID: "2", Username: "baz"},
+		},
+		Unavailable: map[string]twitter.AccountState{
+			"3": twitter.AccountSuspended,
+		},
+	}, nil)
+	resolver.On("LookupUsernames", mock.Anything, mock.Anything, []string{"Bar", "nobody"}).Return(twitter.UsersLookupResponse{
+		Users: []twitter.User{
+			{ID: "4", Username: "bar"},
+		},
+		Unavailable: map[string]twitter.AccountState{
+			"nobody": twitter.AccountNotFound,
+		},
+	}, nil)
+
+	accounts.On("SetTwitterID", mock.Anything, "id4", "4").Return(nil)
+
+	accounts.On("SaveAccounts", mock.Anything, mock.Anything).Run(func(args mock.Arguments) {
+		for _, a := range args.Get(1).([]database.Account) {
+			stored[a.EntityID] = a
+		}
+	}).Return(nil)
+
+	w, err := NewWorker(log, processEntityFn, eventSenderFn, db, WithAccountSync(resolver, accounts, time.Hour))
+	assert.NoError(t, err)
+
+	assert.NoError(t, w.syncAccounts(context.Background()))
+
+	statuses := map[string]database.AccountStatus{}
+	for _, a := range stored {
+		statuses[a.EntityID] = a.Status
+	}
+	assert.Equal(t, map[string]database.AccountStatus{
+		"id1": database.AccountRenamed,
+		"id2": database.AccountActive,
+		"id3": database.AccountSuspended,
+		"id4": database.AccountActive,
+		"id5": database.AccountUnresolved,
+	}, statuses)
+
+	// only entities with a twitter ID and an available account are processed
+	results, _, _, err := w.process(context.Background())
+	assert.NoError(t, err)
+
+	processed := []string{}
+	for _, r := range results {
+		processed = append(processed, r.EntityID)
+	}
+	assert.ElementsMatch(t, []string{"1", "2"}, processed)
+}
+
+func TestSyncAccountsSharding(t *testing.T) {
+	log := logger.New("DEBUG")
+
+	eventSenderFn := func(ctx context.Context, events []event.FakeNews) error {
+		return nil
+	}
+
+	processEntityFn := func(ctx context.Context, request processor.JobRequest) processor.JobResult {
+		return processor.JobResult{
+			EntityID: request.EntityID,
+		}
+	}
+
+	entities := make([]database.Entity, 50)
+	for i := range entities {
+		entities[i] = database.Entity{
+			ID:        fmt.Sprintf("id%d", i),
+			TwitterId: fmt.Sprintf("twitter%d", i),
+		}
+	}
+
+	replicas := []string{"replica1", "replica2", "replica3"}
+
+	seen := map[string]int{}
+	for _, replicaID := range replicas {
+		db := database.NewMockEntityStorage(t)
+		db.On("GetEntities", mock.Anything).Return(entities, nil)
+
+		registry := database.NewMockReplicaRegistry(t)
+		registry.On("Heartbeat", mock.Anything, replicaID, time.Minute).Return(replicas, nil)
+
+		accounts := database.NewMockAccountStorage(t)
+		accounts.On("GetAccounts", mock.Anything).Return(map[string]database.Account{}, nil)
+		accounts.On("SaveAccounts", mock.Anything, mock.Anything).Return(nil)
+
+		resolver := twitter.NewMockUserResolver(t)
+		resolver.On("LookupUserIDs", mock.Anything, mock.Anything, mock.Anything).Return(func(ctx context.Context, log logger.Interface, ids []string) twitter.UsersLookupResponse {
+			assert.Less(t, len(ids), len(entities))
+			for _, id := range ids {
+				seen[id]++
+			}
+			return twitter.UsersLookupResponse{}
+		}, nil)
+
+		w, err := NewWorker(log, processEntityFn, eventSenderFn, db, WithSharding(registry, replicaID, time.Minute),
+			WithAccountSync(resolver, accounts, time.Hour))
+		assert.NoError(t, err)
+		w.coordinate(context.Background())
+
+		assert.NoError(t, w.syncAccounts(context.Background()))
+	}
+
+	// every account is looked up by exactly one replica
+	assert.Equal(t, len(entities), len(seen))
+	for _, count := range seen {
+		assert.Equal(t, 1, count)
+	}
+}
+
+func TestProcessEntitySettings(t *testing.T) {
+	log := logger.New("DEBUG")
+
+	eventSenderFn := func(ctx context.Context, events []event.FakeNews) error {
+		return nil
+	}
+
+	var mu sync.Mutex
+	requests := map[string]processor.JobRequest{}
+	processEntityFn := func(ctx context.Context, request processor.JobRequest) processor.JobResult {
+		mu.Lock()
+		requests[request.EntityID] = request
+		mu.Unlock()
+
+		return processor.JobResult{
+			EntityID: request.EntityID,
+		}
+	}
+
+	db := database.NewMockEntityStorage(t)
+	db.On("GetEntities", mock.Anything).Return([]database.Entity{
+		{ID: "id1", TwitterId: "foo"},
+		{ID: "id2", TwitterId: "bar"},
+		{ID: "id3", TwitterId: "baz"},
+		{ID: "id4", TwitterId: "qux"},
+	}, nil)
+
+	settings := database.NewMockSettingsStorage(t)
+	settings.On("GetSettings", mock.Anything).Return(map[string]database.EntitySettings{
+		"id1": {EntityID: "id1", Retweets: database.TweetsOriginal, Replies: database.TweetsExcluded, FakeThreshold: 0.8},
+		"id3": {EntityID: "id3", Retweets: "sometimes"},
+		"id4": {EntityID: "id4", FakeThreshold: 1.5},
+	}, nil)
+
+	w, err := NewWorker(log, processEntityFn, eventSenderFn, db, WithEntitySettings(settings))
+	assert.NoError(t, err)
+
+	_, _, _, err = w.process(context.Background())
+	assert.NoError(t, err)
+
+	assert.Equal(t, database.TweetsOriginal, requests["foo"].Retweets)
+	assert.Equal(t, database.TweetsExcluded, requests["foo"].Replies)
+	assert.Empty(t, requests["bar"].Retweets)
+	assert.Empty(t, requests["baz"].Retweets)
+	assert.Equal(t, 0.8, requests["foo"].FakeThreshold)
+	assert.Zero(t, requests["qux"].FakeThreshold)
+}
+
+func TestProcessUnavailableAccount(t *testing.T) {
+	log := logger.New("DEBUG")
+
+	eventSenderFn := func(ctx context.Context, events []event.FakeNews) error {
+		return nil
+	}
+
+	var calls int32
+	processEntityFn := func(ctx context.Context, request processor.JobRequest) processor.JobResult {
+		atomic.AddInt32(&calls, 1)
+		return processor.JobResult{
+			EntityID:    request.EntityID,
+			Error:       errors.New("suspended"),
+			Unavailable: database.AccountSuspended,
+		}
+	}
+
+	db := database.NewMockEntityStorage(t)
+	db.On("GetEntities", mock.Anything).Return([]database.Entity{
+		{ID: "id1", TwitterId: "foo"},
+	}, nil)
+
+	accounts := database.NewMockAccountStorage(t)
+	accounts.On("GetAccounts", mock.Anything).Return(map[string]database.Account{}, nil)
+	accounts.On("SaveAccounts", mock.Anything, mock.MatchedBy(func(flagged []database.Account) bool {
+		return len(flagged) == 1 && flagged[0].EntityID == "id1" && flagged[0].Status == database.AccountSuspended
+	})).Return(nil).Once()
+
+	resolver := twitter.NewMockUserResolver(t)
+
+	w, err := NewWorker(log, processEntityFn, eventSenderFn, db, WithAccountSync(resolver, accounts, time.Hour))
+	assert.NoError(t, err)
+
+	_, watermarks, _, err := w.process(context.Background())
+	assert.NoError(t, err)
+	assert.Empty(t, watermarks)
+
+	// the entity is deferred instead of failing again on the next tick
+	results, _, _, err := w.process(context.Background())
+	assert.NoError(t, err)
+	assert.Empty(t, results)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&calls))
+}
+
+func TestProcessOtherSources(t *testing.T) {
+	log := logger.New("DEBUG")
+
+	eventSenderFn := func(ctx context.Context, events []event.FakeNews) error {
+		return nil
+	}
+
+	feed := "https://news.example/feed.xml"
+	published := time.Now().Add(-time.Hour).Truncate(time.Second)
+
+	var mu sync.Mutex
+	requests := map[string]processor.JobRequest{}
+	processEntityFn := func(ctx context.Context, request processor.JobRequest) processor.JobResult {
+		mu.Lock()
+		requests[request.EntityID] = request
+		mu.Unlock()
+
+		if request.Source == database.SourceMastodon {
+			return processor.JobResult{
+				EntityID:    request.EntityID,
+				Error:       errors.New("gone"),
+				Unavailable: database.AccountDeleted,
+			}
+		}
+
+		return processor.JobResult{
+			EntityID:        request.EntityID,
+			NewestTweetID:   "entry",
+			NewestTweetTime: published.Add(time.Minute),
+		}
+	}
+
+	db := database.NewMockEntityStorage(t)
+	db.On("GetEntities", mock.Anything).Return([]database.Entity{
+		{ID: "id1", TwitterId: "foo"},
+		{ID: "id2", Source: database.SourceRSS, SourceAccount: feed},
+		{ID: "id3", Source: database.SourceMastodon, SourceAccount: "bar@mastodon.social"},
+	}, nil)
+
+	watermarkStorage := database.NewMockWatermarkStorage(t)
+	watermarkStorage.On("GetWatermarks", mock.Anything).Return(map[string]database.Watermark{
+		"id2": {EntityID: "id2", LastTweetID: "older", LastTweetTime: published},
+	}, nil)
+
+	// only the Twitter account is looked up and no account of other sources is flagged
+	accounts := database.NewMockAccountStorage(t)
+	accounts.On("GetAccounts", mock.Anything).Return(map[string]database.Account{}, nil).Once()
+
+	w, err := NewWorker(log, processEntityFn, eventSenderFn, db,
+		WithWatermarkStorage(watermarkStorage),
+		WithAccountSync(twitter.NewMockUserResolver(t), accounts, time.Hour),
+	)
+	assert.NoError(t, err)
+
+	results, watermarks, _, err := w.process(context.Background())
+	assert.NoError(t, err)
+	assert.Len(t, results, 3)
+
+	assert.Equal(t, database.SourceRSS, requests[feed].Source)
+	assert.Equal(t, published, requests[feed].SinceTime)
+	assert.Contains(t, requests, "foo")
+
+	for _, wm := range watermarks {
+		if wm.EntityID == "id2" {
+			assert.Equal(t, "entry", wm.LastTweetID)
+		}
+	}
+	assert.Len(t, watermarks, 2)
+}
+
+func TestProcessPendingTweets(t *testing.T) {
+	log := logger.New("DEBUG")
+
+	newWorker := func(t *testing.T, classify func(request processor.JobRequest) processor.JobResult, events *[]event.FakeNews, opts ...Option) (*Worker, *database.MemoryPendingTweetStorage) {
+		eventSenderFn := func(ctx context.Context, sent []event.FakeNews) error {
+			*events = append(*events, sent...)
+			return nil
+		}
+
+		db := database.NewMockEntityStorage(t)
+		db.On("GetEntities", mock.Anything).Return([]database.Entity{
+			{ID: "id1", TwitterId: "foo"},
+		}, nil)
+
+		pending := database.NewMemoryPendingTweetStorage()
+		w, err := NewWorker(log, func(ctx context.Context, request processor.JobRequest) processor.JobResult {
+			return classify(request)
+		}, eventSenderFn, db, append(opts, WithPendingTweetStorage(pending))...)
+		assert.NoError(t, err)
+
+		return w, pending
+	}
+
+	tweet := twitter.Tweet{ID: "5", Text: "Dummy 5"}
+	failed := processor.JobResult{
+		EntityID:      "foo",
+		Error:         errors.New("predictor unavailable"),
+		NewestTweetID: "5",
+		Unclassified:  []twitter.Tweet{tweet},
+	}
+
+	t.Run("classifies pending tweets on the next tick", func(t *testing.T) {
+		requests := []processor.JobRequest{}
+		events := []event.FakeNews{}
+		w, pending := newWorker(t, func(request processor.JobRequest) processor.JobResult {
+			requests = append(requests, request)
+			switch {
+			case len(requests) == 1:
+				return failed
+			case request.Tweets != nil:
+				return processor.JobResult{
+					EntityID:       request.EntityID,
+					FakeNewsTweets: []processor.FakeNewsTweet{{TweetID: request.Tweets[0].ID, Score: 0.9}},
+					ClassifiedIDs:  []string{request.Tweets[0].ID},
+				}
+			default:
+				return processor.JobResult{EntityID: request.EntityID}
+			}
+		}, &events)
+
+		w.tick(context.Background())
+		assert.Empty(t, events)
+		stored, err := pending.GetPendingTweets(context.Background(), []string{"foo"})
+		assert.NoError(t, err)
+		assert.Len(t, stored, 1)
+
+		w.tick(context.Background())
+		assert.Len(t, requests, 3)
+		// the watermark advanced past the pending tweet
+		assert.Equal(t, "5", requests[1].SinceID)
+		assert.Equal(t, []twitter.Tweet{tweet}, requests[2].Tweets)
+		assert.Len(t, events, 1)
+		assert.Equal(t, "5", events[0].TweetID)
+
+		stored, err = pending.GetPendingTweets(context.Background(), []string{"foo"})
+		assert.NoError(t, err)
+		assert.Empty(t, stored)
+	})
+
+	t.Run("classifies analyzed originals as they are", func(t *testing.T) {
+		// the entity replied to a tweet which is itself a reply
+		reply := twitter.Tweet{ID: "5", Text: "Reply", ReferencedTweets: []twitter.ReferencedTweet{{Type: twitter.ReferenceRepliedTo, ID: "4"}}}
+		original := twitter.Tweet{ID: "4", Text: "Original", ReferencedTweets: []twitter.ReferencedTweet{{Type: twitter.ReferenceRepliedTo, ID: "3"}}}
+
+		fetcher := twitter.NewMockTweetsFetcher(t)
+		fetcher.On("FetchTweets", mock.Anything, mock.Anything, mock.MatchedBy(func(r twitter.FetchTweetsRequest) bool {
+			return r.SinceID == ""
+		})).Return(twitter.FetchTweetsResponse{Tweets: []twitter.Tweet{reply}}, nil).Once()
+		fetcher.On("FetchTweets", mock.Anything, mock.Anything, mock.Anything).Return(twitter.FetchTweetsResponse{}, nil).Once()
+		fetcher.On("LookupTweets", mock.Anything, mock.Anything, []string{"4"}).Return([]twitter.Tweet{original}, nil).Once()
+
+		classifier := predictor.NewMockFakeNewsClassifier(t)
+		classifier.On("Classify", mock.Anything, predictor.ClassifyRequest{"Original"}).Return(predictor.ClassifyResponse{}, errors.New("predictor unavailable")).Once()
+		classifier.On("Classify", mock.Anything, predictor.ClassifyRequest{}).Return(predictor.ClassifyResponse{}, nil).Once()
+		classifier.On("Classify", mock.Anything, predictor.ClassifyRequest{"Original"}).Return(predictor.ClassifyResponse{
+			Classification: []predictor.Classification{predictor.Fake},
+			Scores:         []float64{0.9},
+		}, nil).Once()
+
+		settings := database.NewMockSettingsStorage(t)
+		settings.On("GetSettings", mock.Anything).Return(map[string]database.EntitySettings{
+			"id1": {Replies: database.TweetsOriginal},
+		}, nil)
+
+		process := processor.GetProcessFn(log, fetcher, classifier)
+		events := []event.FakeNews{}
+		w, pending := newWorker(t, func(request processor.JobRequest) processor.JobResult {
+			return process(context.Background(), request)
+		}, &events, WithEntitySettings(settings))
+
+		w.tick(context.Background())
+		stored, err := pending.GetPendingTweets(context.Background(), []string{"foo"})
+		assert.NoError(t, err)
+		assert.Len(t, stored, 1)
+
+		w.tick(context.Background())
+		assert.Len(t, events, 1)
+		assert.Equal(t, "4", events[0].TweetID)
+
+		stored, err = pending.GetPendingTweets(context.Background(), []string{"foo"})
+		assert.NoError(t, err)
+		assert.Empty(t, stored)
+	})
+
+	t.Run("purges pending tweets of entities no longer polled", func(t *testing.T) {
+		events := []event.FakeNews{}
+		w, pending := newWorker(t, func(request processor.JobRequest) processor.JobResult {
+			if request.Tweets != nil {
+				return processor.JobResult{EntityID: request.EntityID, Error: errors.New("predictor unavailable")}
+			}
+			return failed
+		}, &events)
+
+		payload, err := json.Marshal(twitter.Tweet{ID: "9", Text: "Dummy 9"})
+		assert.NoError(t, err)
+		assert.NoError(t, pending.SavePendingTweets(context.Background(), []database.PendingTweet{
+			{EntityID: "deleted", TweetID: "9", Payload: payload},
+		}))
+
+		w.tick(context.Background())
+
+		stored, err := pending.GetPendingTweets(context.Background(), []string{"foo", "deleted"})
+		assert.NoError(t, err)
+		assert.Len(t, stored, 1)
+		assert.Equal(t, "foo", stored[0].EntityID)
+	})
+
+	t.Run("drops pending tweets which can't be decoded", func(t *testing.T) {
+		requests := []processor.JobRequest{}
+		events := []event.FakeNews{}
+		w, pending := newWorker(t, func(request processor.JobRequest) processor.JobResult {
+			requests = append(requests, request)
+			return processor.JobResult{EntityID: request.EntityID}
+		}, &events)
+
+		assert.NoError(t, pending.SavePendingTweets(context.Background(), []database.PendingTweet{
+			{EntityID: "foo", TweetID: "9", Payload: []byte("{")},
+		}))
+
+		w.tick(context.Background())
+
+		// only the regular job ran
+		assert.Len(t, requests, 1)
+		assert.Nil(t, requests[0].Tweets)
+		stored, err := pending.GetPendingTweets(context.Background(), []string{"foo"})
+		assert.NoError(t, err)
+		assert.Empty(t, stored)
+	})
+
+	t.Run("gives up after max attempts", func(t *testing.T) {
+		events := []event.FakeNews{}
+		w, pending := newWorker(t, func(request processor.JobRequest) processor.JobResult {
+			if request.SinceID == "" || request.Tweets != nil {
+				return failed
+			}
+			return processor.JobResult{EntityID: request.EntityID}
+		}, &events, WithMaxClassifyAttempts(2))
+
+		w.tick(context.Background())
+		w.tick(context.Background())
+
+		stored, err := pending.GetPendingTweets(context.Background(), []string{"foo"})
+		assert.NoError(t, err)
+		assert.Empty(t, stored)
+		assert.Empty(t, events)
+	})
+
+	t.Run("keeps pending tweets while the predictor circuit is open", func(t *testing.T) {
+		// the circuit reopens right away, so every tick retries and fails fast
+		circuitOpen := func(request processor.JobRequest) processor.JobResult {
+			until := time.Now()
+			return processor.JobResult{
+				EntityID:      request.EntityID,
+				Error:         &predictor.CircuitOpenError{Until: until},
+				RetryAfter:    until,
+				NewestTweetID: "5",
+				Unclassified:  request.Tweets,
+			}
+		}
+
+		retries := 0
+		events := []event.FakeNews{}
+		w, pending := newWorker(t, func(request processor.JobRequest) processor.JobResult {
+			switch {
+			case request.Tweets != nil:
+				retries++
+				return circuitOpen(request)
+			case request.SinceID == "":
+				result := circuitOpen(request)
+				result.Unclassified = []twitter.Tweet{tweet}
+				return result
+			default:
+				// nothing new to classify, so the predictor isn't asked
+				return processor.JobResult{EntityID: request.EntityID}
+			}
+		}, &events, WithMaxClassifyAttempts(2), WithInterval(time.Millisecond))
+
+		for i := 0; i < 5; i++ {
+			w.tick(context.Background())
+			// pending tweets back off for a tick
+			time.Sleep(2 * time.Millisecond)
+		}
+
+		assert.Equal(t, 4, retries)
+		stored, err := pending.GetPendingTweets(context.Background(), []string{"foo"})
+		assert.NoError(t, err)
+		assert.Len(t, stored, 1)
+		assert.Equal(t, 0, stored[0].Attempts)
+		assert.Empty(t, events)
+	})
+
+	t.Run("defers retries until the predictor circuit closes", func(t *testing.T) {
+		until := time.Now().Add(time.Minute)
+		retries := 0
+		events := []event.FakeNews{}
+		w, pending := newWorker(t, func(request processor.JobRequest) processor.JobResult {
+			switch {
+			case request.Tweets != nil:
+				retries++
+				return processor.JobResult{
+					EntityID:   request.EntityID,
+					Error:      &predictor.CircuitOpenError{Until: until},
+					RetryAfter: until,
+				}
+			case request.SinceID == "":
+				return failed
+			default:
+				return processor.JobResult{EntityID: request.EntityID}
+			}
+		}, &events)
+
+		w.tick(context.Background())
+		w.tick(context.Background())
+		w.tick(context.Background())
+
+		assert.Equal(t, 1, retries)
+		assert.Equal(t, until, w.deferred["foo"])
+		stored, err := pending.GetPendingTweets(context.Background(), []string{"foo"})
+		assert.NoError(t, err)
+		assert.Len(t, stored, 1)
+		assert.Equal(t, 1, stored[0].Attempts)
+		assert.Equal(t, until, stored[0].NextAttemptAt)
+	})
+}
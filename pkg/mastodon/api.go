@@ -0,0 +1,203 @@
+package mastodon
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/kordape/ottct-poller-service/pkg/logger"
+	"github.com/kordape/ottct-poller-service/pkg/source"
+)
+
+const (
+	lookupAccountPath   = "/api/v1/accounts/lookup"
+	accountStatusesPath = "/api/v1/accounts/%s/statuses"
+
+	rateLimitResetHeader = "X-RateLimit-Reset"
+	// Mastodon limits requests in 5 minute windows
+	defaultRateLimitWindow = 5 * time.Minute
+)
+
+type lookupResponse struct {
+	ID string `json:"id"`
+}
+
+type status struct {
+	ID        string    `json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	Content   string    `json:"content"`
+	URL       string    `json:"url"`
+	URI       string    `json:"uri"`
+	Language  string    `json:"language"`
+	Account   struct {
+		ID   string `json:"id"`
+		Acct string `json:"acct"`
+	} `json:"account"`
+	// Reblog is the boosted status, its content is what the boost shares
+	Reblog *status `json:"reblog"`
+}
+
+func (c *Client) FetchPosts(ctx context.Context, log logger.Interface, request source.FetchPostsRequest) (source.FetchPostsResponse, error) {
+	acct, err := parseAccount(request.Account)
+	if err != nil {
+		return source.FetchPostsResponse{}, err
+	}
+
+	accountID, err := c.accountID(ctx, acct)
+	if err != nil {
+		return source.FetchPostsResponse{}, err
+	}
+
+	response := source.FetchPostsResponse{Posts: []source.Post{}}
+	maxID := request.UntilID
+	for pages := 1; ; pages++ {
+		statuses, err := c.statuses(ctx, acct, accountID, request.SinceID, maxID)
+		if err != nil {
+			return source.FetchPostsResponse{}, err
+		}
+
+		reachedStart := false
+		for _, s := range statuses {
+			if request.SinceID == "" {
+				if s.CreatedAt.Before(request.StartTime) {
+					reachedStart = true
+					continue
+				}
+				if !request.EndTime.IsZero() && !s.CreatedAt.Before(request.EndTime) {
+					continue
+				}
+			}
+			response.Posts = append(response.Posts, toPost(s))
+		}
+
+		if len(statuses) < statusesPageSize || reachedStart {
+			// reached end of results
+			break
+		}
+
+		if request.MaxPages > 0 && pages >= request.MaxPages {
+			log.Info(fmt.Sprintf("Reached max pages limit (%d) for mastodon account %s", request.MaxPages, acct))
+			response.Truncated = len(response.Posts) > 0
+			break
+		}
+
+		maxID = statuses[len(statuses)-1].ID
+	}
+
+	log.Info(fmt.Sprintf("Received %d statuses of mastodon account %s", len(response.Posts), acct))
+
+	return response, nil
+}
+
+// accountID looks up the ID of the account, statuses can only be fetched by it.
+func (c *Client) accountID(ctx context.Context, acct account) (string, error) {
+	c.mu.Lock()
+	id, ok := c.accountIDs[acct.String()]
+	c.mu.Unlock()
+	if ok {
+		return id, nil
+	}
+
+	query := url.Values{}
+	query.Set("acct", acct.username)
+	body, err := c.get(ctx, fmt.Sprintf("%s%s?%s", acct.instance, lookupAccountPath, query.Encode()))
+	if err != nil {
+		return "", fmt.Errorf("error looking up mastodon account %s: %w", acct, err)
+	}
+
+	var response lookupResponse
+	if err := json.Unmarshal(body, &response); err != nil {
+		return "", fmt.Errorf("error unmarshalling response: %w", err)
+	}
+
+	c.mu.Lock()
+	c.accountIDs[acct.String()] = response.ID
+	c.mu.Unlock()
+
+	return response.ID, nil
+}
+
+func (c *Client) statuses(ctx context.Context, acct account, accountID, sinceID, maxID string) ([]status, error) {
+	query := url.Values{}
+	query.Set("limit", strconv.Itoa(statusesPageSize))
+	if sinceID != "" {
+		query.Set("since_id", sinceID)
+	}
+	if maxID != "" {
+		query.Set("max_id", maxID)
+	}
+
+	body, err := c.get(ctx, fmt.Sprintf("%s%s?%s", acct.instance, fmt.Sprintf(accountStatusesPath, url.PathEscape(accountID)), query.Encode()))
+	if err != nil {
+		return nil, fmt.Errorf("error fetching statuses of mastodon account %s: %w", acct, err)
+	}
+
+	var statuses []status
+	if err := json.Unmarshal(body, &statuses); err != nil {
+		return nil, fmt.Errorf("error unmarshalling response: %w", err)
+	}
+
+	return statuses, nil
+}
+
+func (c *Client) get(ctx context.Context, rawURL string) ([]byte, error) {
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, rawURL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("error creating request: %w", err)
+	}
+	request.Header.Set("Accept", "application/json")
+
+	resp, err := c.retryPolicy.Do(ctx, c.httpClient, request)
+	if err != nil {
+		return nil, fmt.Errorf("error doing request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusTooManyRequests:
+		reset, err := time.Parse(time.RFC3339, resp.Header.Get(rateLimitResetHeader))
+		if err != nil {
+			reset = time.Now().Add(defaultRateLimitWindow)
+		}
+		return nil, &source.RateLimitedError{Source: "mastodon", Reset: reset}
+	case http.StatusNotFound, http.StatusGone:
+		return nil, source.ErrNotFound
+	default:
+		return nil, fmt.Errorf("request failed with: %d", resp.StatusCode)
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("error reading response: %w", err)
+	}
+
+	return body, nil
+}
+
+func toPost(s status) source.Post {
+	post := source.Post{
+		ID:        s.ID,
+		Text:      source.PlainText(s.Content),
+		CreatedAt: s.CreatedAt,
+		URL:       s.URL,
+		AuthorID:  s.Account.ID,
+		Author:    s.Account.Acct,
+		Lang:      s.Language,
+	}
+
+	if post.URL == "" {
+		post.URL = s.URI
+	}
+
+	if s.Reblog != nil {
+		post.Text = source.PlainText(s.Reblog.Content)
+	}
+
+	return post
+}
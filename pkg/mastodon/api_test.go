@@ -0,0 +1,154 @@
+package mastodon
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kordape/ottct-poller-service/pkg/logger"
+	"github.com/kordape/ottct-poller-service/pkg/retry"
+	"github.com/kordape/ottct-poller-service/pkg/source"
+	"github.com/stretchr/testify/assert"
+)
+
+func statusJSON(id int, createdAt time.Time) string {
+	return fmt.Sprintf(`{"id": "%d", "created_at": "%s", "content": "<p>status %d &amp; more</p>", "url": "https://mastodon.example/@foo/%d", "language": "en", "account": {"id": "7", "acct": "foo"}, "reblog": null}`,
+		id, createdAt.Format(time.RFC3339), id, id)
+}
+
+func TestFetchPosts(t *testing.T) {
+	log := logger.New("DEBUG")
+	start := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+	lookups := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/api/v1/accounts/lookup":
+			lookups++
+			if r.URL.Query().Get("acct") != "foo" {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			fmt.Fprint(w, `{"id": "7"}`)
+		case r.URL.Path == "/api/v1/accounts/7/statuses":
+			// 45 statuses, newest first, one every hour
+			maxID := 1046
+			if v := r.URL.Query().Get("max_id"); v != "" {
+				maxID, _ = strconv.Atoi(v)
+			}
+			sinceID, _ := strconv.Atoi(r.URL.Query().Get("since_id"))
+			statuses := []string{}
+			for id := maxID - 1; id > 1000 && id > sinceID && len(statuses) < 40; id-- {
+				statuses = append(statuses, statusJSON(id, start.Add(time.Duration(id-1000)*time.Hour)))
+			}
+			fmt.Fprintf(w, "[%s]", strings.Join(statuses, ","))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	client := New(server.Client())
+
+	t.Run("fetches statuses since id page by page", func(t *testing.T) {
+		response, err := client.FetchPosts(context.Background(), log, source.FetchPostsRequest{
+			Account: server.URL + "/@foo",
+			SinceID: "1002",
+		})
+		assert.NoError(t, err)
+		posts := response.Posts
+		assert.Len(t, posts, 43)
+		assert.Equal(t, source.Post{
+			ID:        "1045",
+			Text:      "status 1045 & more",
+			CreatedAt: start.Add(45 * time.Hour),
+			URL:       "https://mastodon.example/@foo/1045",
+			AuthorID:  "7",
+			Author:    "foo",
+			Lang:      "en",
+		}, posts[0])
+		assert.Equal(t, "1003", posts[42].ID)
+		assert.False(t, response.Truncated)
+		assert.Equal(t, 1, lookups)
+	})
+
+	t.Run("fetches statuses in the time window", func(t *testing.T) {
+		response, err := client.FetchPosts(context.Background(), log, source.FetchPostsRequest{
+			Account:   server.URL + "/@foo",
+			StartTime: start.Add(40 * time.Hour),
+			EndTime:   start.Add(44 * time.Hour),
+		})
+		assert.NoError(t, err)
+		posts := response.Posts
+		assert.Len(t, posts, 4)
+		assert.Equal(t, "1043", posts[0].ID)
+	})
+
+	t.Run("limits pages", func(t *testing.T) {
+		response, err := client.FetchPosts(context.Background(), log, source.FetchPostsRequest{
+			Account:  server.URL + "/@foo",
+			MaxPages: 1,
+		})
+		assert.NoError(t, err)
+		posts := response.Posts
+		assert.Len(t, posts, 40)
+		assert.True(t, response.Truncated)
+	})
+
+	t.Run("catches up until id", func(t *testing.T) {
+		response, err := client.FetchPosts(context.Background(), log, source.FetchPostsRequest{
+			Account: server.URL + "/@foo",
+			SinceID: "1002",
+			UntilID: "1006",
+		})
+		assert.NoError(t, err)
+		assert.False(t, response.Truncated)
+		assert.Len(t, response.Posts, 3)
+		assert.Equal(t, "1005", response.Posts[0].ID)
+		assert.Equal(t, "1003", response.Posts[2].ID)
+	})
+
+	t.Run("fails for unknown account", func(t *testing.T) {
+		_, err := client.FetchPosts(context.Background(), log, source.FetchPostsRequest{Account: server.URL + "/@bar"})
+		assert.True(t, errors.Is(err, source.ErrNotFound))
+	})
+}
+
+func TestFetchPostsRateLimited(t *testing.T) {
+	reset := time.Now().Add(time.Minute).UTC().Truncate(time.Second)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set(rateLimitResetHeader, reset.Format(time.RFC3339))
+		w.WriteHeader(http.StatusTooManyRequests)
+	}))
+	defer server.Close()
+
+	client := New(server.Client(), WithRetryPolicy(retry.NoRetry()))
+	_, err := client.FetchPosts(context.Background(), logger.New("DEBUG"), source.FetchPostsRequest{Account: server.URL + "/@foo"})
+
+	var rateLimited *source.RateLimitedError
+	assert.True(t, errors.As(err, &rateLimited))
+	assert.True(t, reset.Equal(rateLimited.Reset))
+}
+
+func TestParseAccount(t *testing.T) {
+	for value, expected := range map[string]account{
+		"foo@mastodon.social":          {instance: "https://mastodon.social", username: "foo"},
+		"@foo@mastodon.social":         {instance: "https://mastodon.social", username: "foo"},
+		"https://mastodon.social/@foo": {instance: "https://mastodon.social", username: "foo"},
+		"http://localhost:8080/@foo/":  {instance: "http://localhost:8080", username: "foo"},
+	} {
+		acct, err := parseAccount(value)
+		assert.NoError(t, err)
+		assert.Equal(t, expected, acct)
+	}
+
+	for _, value := range []string{"foo", "@foo", "foo@", "https://mastodon.social/", "https://mastodon.social/@foo/1"} {
+		_, err := parseAccount(value)
+		assert.Error(t, err, value)
+	}
+}
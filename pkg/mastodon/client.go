@@ -0,0 +1,89 @@
+package mastodon
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+
+	"github.com/kordape/ottct-poller-service/pkg/retry"
+	"github.com/kordape/ottct-poller-service/pkg/source"
+)
+
+const (
+	// statusesPageSize is the most statuses Mastodon returns per page
+	statusesPageSize = 40
+)
+
+// Make sure Client implement PostsFetcher interface
+var _ source.PostsFetcher = &Client{}
+
+// Client fetches public statuses of Mastodon accounts. Accounts are given either as handles, e.g.
+// user@mastodon.social, or as profile URLs, e.g. https://mastodon.social/@user.
+type Client struct {
+	httpClient  *http.Client
+	retryPolicy retry.Policy
+
+	// accountIDs caches IDs of looked up accounts by handle
+	mu         sync.Mutex
+	accountIDs map[string]string
+}
+
+type Option func(c *Client)
+
+// WithRetryPolicy sets the policy failed requests are retried with.
+func WithRetryPolicy(policy retry.Policy) Option {
+	return func(c *Client) {
+		c.retryPolicy = policy
+	}
+}
+
+func New(client *http.Client, opts ...Option) *Client {
+	c := &Client{
+		httpClient:  client,
+		retryPolicy: retry.DefaultPolicy(),
+		accountIDs:  map[string]string{},
+	}
+
+	for _, opt := range opts {
+		opt(c)
+	}
+
+	c.retryPolicy = c.retryPolicy.ExceptStatus(http.StatusTooManyRequests)
+
+	return c
+}
+
+// account is a Mastodon account split into the instance hosting it and the username on the instance.
+type account struct {
+	instance string
+	username string
+}
+
+func (a account) String() string {
+	return fmt.Sprintf("%s/@%s", a.instance, a.username)
+}
+
+func parseAccount(value string) (account, error) {
+	if strings.HasPrefix(value, "http://") || strings.HasPrefix(value, "https://") {
+		u, err := url.Parse(value)
+		if err != nil {
+			return account{}, fmt.Errorf("invalid mastodon profile url %s: %w", value, err)
+		}
+
+		username := strings.TrimPrefix(strings.Trim(u.Path, "/"), "@")
+		if username == "" || strings.Contains(username, "/") {
+			return account{}, fmt.Errorf("invalid mastodon profile url %s", value)
+		}
+
+		return account{instance: fmt.Sprintf("%s://%s", u.Scheme, u.Host), username: username}, nil
+	}
+
+	parts := strings.Split(strings.TrimPrefix(value, "@"), "@")
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return account{}, fmt.Errorf("invalid mastodon handle %s, expected user@instance", value)
+	}
+
+	return account{instance: "https://" + parts[1], username: parts[0]}, nil
+}
@@ -4,19 +4,176 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io/ioutil"
+	"net"
 	"net/http"
+	"sync"
+
+	"github.com/kordape/ottct-poller-service/pkg/retry"
 )
 
+// StatusError is returned when the predictor answers with a status other than 200.
+type StatusError struct {
+	StatusCode int
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("request failed with: %d", e.StatusCode)
+}
+
+// Unavailable reports whether err means the predictor couldn't classify anything at the moment, e.g. it's
+// unreachable, overloaded or behind an open circuit, as opposed to failing on the given texts.
+func Unavailable(err error) bool {
+	var circuitOpenErr *CircuitOpenError
+	var statusErr *StatusError
+	var netErr net.Error
+	switch {
+	case errors.As(err, &circuitOpenErr), errors.Is(err, context.DeadlineExceeded), errors.As(err, &netErr):
+		return true
+	case errors.As(err, &statusErr):
+		return retry.TransientErrors(statusErr.StatusCode)
+	default:
+		return false
+	}
+}
+
 type request struct {
 	Tweet string `json:"tweet"`
 }
 type response struct {
-	Prediction []int `json:"prediction"`
+	Prediction []prediction `json:"prediction"`
+	// Scores may accompany bare labels in Prediction
+	Scores []float64 `json:"scores"`
+}
+
+// modelThreshold is where models answering with bare scores draw the line between real and fake.
+const modelThreshold = 0.5
+
+// prediction is decoded from a bare number, either a 0/1 label or the probability of the text being
+// fake news, or from an object with the label and its score, e.g. {"label": 1, "score": 0.87}.
+type prediction struct {
+	classification Classification
+	score          float64
+}
+
+func (p *prediction) UnmarshalJSON(b []byte) error {
+	var score float64
+	if err := json.Unmarshal(b, &score); err == nil {
+		return p.set(nil, &score)
+	}
+
+	var labeled struct {
+		Label       *int     `json:"label"`
+		Score       *float64 `json:"score"`
+		Probability *float64 `json:"probability"`
+	}
+	if err := json.Unmarshal(b, &labeled); err != nil {
+		return fmt.Errorf("unexpected prediction %s", b)
+	}
+
+	if labeled.Score == nil {
+		labeled.Score = labeled.Probability
+	}
+
+	return p.set(labeled.Label, labeled.Score)
+}
+
+func (p *prediction) set(label *int, score *float64) error {
+	switch {
+	case label == nil && score == nil:
+		return errors.New("prediction has neither label nor score")
+	case score != nil && (*score < 0 || *score > 1):
+		return fmt.Errorf("prediction score %v is out of range", *score)
+	case label != nil && Classification(*label) != Real && Classification(*label) != Fake:
+		return fmt.Errorf("unexpected prediction label %d", *label)
+	}
+
+	if score != nil {
+		p.score = *score
+		p.classification = Real
+		if p.score >= modelThreshold {
+			p.classification = Fake
+		}
+	}
+
+	if label != nil {
+		p.classification = Classification(*label)
+		if score == nil && p.classification == Fake {
+			p.score = 1
+		}
+	}
+
+	return nil
 }
 
+// Classify splits requests larger than the max batch size into chunks, which are classified in parallel.
+// The response follows the order of the requests regardless of the order the chunks complete in.
 func (c *Client) Classify(ctx context.Context, requests ClassifyRequest) (ClassifyResponse, error) {
+	if c.maxBatchSize <= 0 || len(requests) <= c.maxBatchSize {
+		return c.classifyBatch(ctx, requests)
+	}
+
+	chunks := []ClassifyRequest{}
+	for start := 0; start < len(requests); start += c.maxBatchSize {
+		end := start + c.maxBatchSize
+		if end > len(requests) {
+			end = len(requests)
+		}
+		chunks = append(chunks, requests[start:end])
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	responses := make([]ClassifyResponse, len(chunks))
+	errs := make([]error, len(chunks))
+	slots := make(chan struct{}, c.maxParallelBatches)
+	var wg sync.WaitGroup
+	for i, chunk := range chunks {
+		wg.Add(1)
+		go func(i int, chunk ClassifyRequest) {
+			defer wg.Done()
+
+			slots <- struct{}{}
+			defer func() { <-slots }()
+
+			if ctx.Err() != nil {
+				errs[i] = ctx.Err()
+				return
+			}
+
+			responses[i], errs[i] = c.classifyBatch(ctx, chunk)
+			if errs[i] != nil {
+				// the response is useless without any of the chunks
+				cancel()
+			}
+		}(i, chunk)
+	}
+	wg.Wait()
+
+	result := ClassifyResponse{
+		Classification: make([]Classification, 0, len(requests)),
+		Scores:         make([]float64, 0, len(requests)),
+	}
+	for i, r := range responses {
+		if errs[i] != nil {
+			return ClassifyResponse{}, fmt.Errorf("error classifying chunk %d of %d: %w", i+1, len(chunks), errs[i])
+		}
+
+		if len(r.Classification) != len(chunks[i]) {
+			return ClassifyResponse{}, fmt.Errorf("got %d predictions for chunk %d of %d texts", len(r.Classification), i+1, len(chunks[i]))
+		}
+
+		result.Classification = append(result.Classification, r.Classification...)
+		result.Scores = append(result.Scores, r.Scores...)
+	}
+
+	return result, nil
+}
+
+func (c *Client) classifyBatch(ctx context.Context, requests ClassifyRequest) (ClassifyResponse, error) {
 	predictRequest := make([]request, len(requests))
 	for i, r := range requests {
 		predictRequest[i] = request{
@@ -35,7 +192,7 @@ func (c *Client) Classify(ctx context.Context, requests ClassifyRequest) (Classi
 		return ClassifyResponse{}, fmt.Errorf("error creating http request: %w", err)
 	}
 
-	resp, err := c.httpClient.Do(request)
+	resp, err := c.retryPolicy.Do(ctx, c.httpClient, request)
 	if err != nil {
 		return ClassifyResponse{}, fmt.Errorf("error doing http request: %w", err)
 	}
@@ -43,7 +200,7 @@ func (c *Client) Classify(ctx context.Context, requests ClassifyRequest) (Classi
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		return ClassifyResponse{}, fmt.Errorf("request failed with: %d", resp.StatusCode)
+		return ClassifyResponse{}, &StatusError{StatusCode: resp.StatusCode}
 	}
 
 	body, err := ioutil.ReadAll(resp.Body)
@@ -57,12 +214,25 @@ func (c *Client) Classify(ctx context.Context, requests ClassifyRequest) (Classi
 		return ClassifyResponse{}, fmt.Errorf("error unmarshalling response: %w", err)
 	}
 
+	if len(predictions.Scores) > 0 && len(predictions.Scores) != len(predictions.Prediction) {
+		return ClassifyResponse{}, fmt.Errorf("got %d scores for %d predictions", len(predictions.Scores), len(predictions.Prediction))
+	}
+
 	result := ClassifyResponse{}
 	classifications := make([]Classification, len(predictions.Prediction))
+	scores := make([]float64, len(predictions.Prediction))
 	for i, p := range predictions.Prediction {
-		classifications[i] = Classification(p)
+		classifications[i] = p.classification
+		scores[i] = p.score
+		if len(predictions.Scores) > 0 {
+			if predictions.Scores[i] < 0 || predictions.Scores[i] > 1 {
+				return ClassifyResponse{}, fmt.Errorf("prediction score %v is out of range", predictions.Scores[i])
+			}
+			scores[i] = predictions.Scores[i]
+		}
 	}
 	result.Classification = classifications
+	result.Scores = scores
 
 	return result, nil
 }
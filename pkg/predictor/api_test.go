@@ -3,12 +3,18 @@ package predictor
 import (
 	"bytes"
 	"context"
+	"encoding/json"
+	"fmt"
 	"io"
 	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 
 	"github.com/kordape/ottct-poller-service/pkg/predictor/mocks"
+	"github.com/kordape/ottct-poller-service/pkg/retry"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -59,3 +65,143 @@ func TestFetchTweets(t *testing.T) {
 		assert.Empty(t, resp)
 	})
 }
+
+func TestClassifyRetry(t *testing.T) {
+	count := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		count++
+		if count == 1 {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte(mocks.SuccessResponse))
+	}))
+	defer server.Close()
+
+	api := New(server.Client(), server.URL, WithRetryPolicy(retry.Policy{
+		MaxAttempts:    2,
+		InitialBackoff: time.Millisecond,
+		MaxBackoff:     time.Millisecond,
+		Retryable:      retry.TransientErrors,
+	}))
+
+	resp, err := api.Classify(context.Background(), ClassifyRequest{"tweet"})
+
+	assert.NoError(t, err)
+	assert.NotEmpty(t, resp)
+	assert.Equal(t, 2, count)
+}
+
+func TestUnavailable(t *testing.T) {
+	t.Run("predictor down", func(t *testing.T) {
+		assert.True(t, Unavailable(&CircuitOpenError{Until: time.Now()}))
+		assert.True(t, Unavailable(fmt.Errorf("error classifying: %w", &StatusError{StatusCode: http.StatusServiceUnavailable})))
+		assert.True(t, Unavailable(fmt.Errorf("error doing http request: %w", context.DeadlineExceeded)))
+	})
+
+	t.Run("texts rejected", func(t *testing.T) {
+		assert.False(t, Unavailable(&StatusError{StatusCode: http.StatusBadRequest}))
+		assert.False(t, Unavailable(fmt.Errorf("got %d predictions for %d texts", 1, 2)))
+	})
+}
+
+func TestClassifyScores(t *testing.T) {
+	classify := func(body string) (ClassifyResponse, error) {
+		client := newHTTPCli(func(r *http.Request) (*http.Response, error) {
+			return &http.Response{
+				StatusCode: http.StatusOK,
+				Body:       io.NopCloser(bytes.NewBufferString(body)),
+			}, nil
+		})
+
+		return New(client, "futile").Classify(context.Background(), ClassifyRequest{"a", "b", "c"})
+	}
+
+	t.Run("bare labels", func(t *testing.T) {
+		resp, err := classify(`{"prediction": [0, 1, 0]}`)
+		assert.NoError(t, err)
+		assert.Equal(t, []Classification{Real, Fake, Real}, resp.Classification)
+		assert.Equal(t, []float64{0, 1, 0}, resp.Scores)
+	})
+
+	t.Run("probabilities", func(t *testing.T) {
+		resp, err := classify(`{"prediction": [0.1, 0.93, 0.5]}`)
+		assert.NoError(t, err)
+		assert.Equal(t, []Classification{Real, Fake, Fake}, resp.Classification)
+		assert.Equal(t, []float64{0.1, 0.93, 0.5}, resp.Scores)
+	})
+
+	t.Run("labels with scores", func(t *testing.T) {
+		resp, err := classify(`{"prediction": [{"label": 0, "score": 0.2}, {"label": 1, "probability": 0.7}, {"label": 1}]}`)
+		assert.NoError(t, err)
+		assert.Equal(t, []Prediction{
+			{Classification: Real, Score: 0.2},
+			{Classification: Fake, Score: 0.7},
+			{Classification: Fake, Score: 1},
+		}, resp.Predictions())
+	})
+
+	t.Run("separate scores", func(t *testing.T) {
+		resp, err := classify(`{"prediction": [0, 1, 1], "scores": [0.3, 0.6, 0.99]}`)
+		assert.NoError(t, err)
+		assert.Equal(t, []float64{0.3, 0.6, 0.99}, resp.Scores)
+		assert.False(t, resp.Predictions()[1].Fake(0.8))
+		assert.True(t, resp.Predictions()[2].Fake(0.8))
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		for _, body := range []string{
+			`{"prediction": [0, 1.5, 0]}`,
+			`{"prediction": [0, {"label": 2}, 0]}`,
+			`{"prediction": [0, {}, 0]}`,
+			`{"prediction": [0, 1, 0], "scores": [0.1]}`,
+		} {
+			_, err := classify(body)
+			assert.Error(t, err, body)
+		}
+	})
+}
+
+func TestClassifyChunks(t *testing.T) {
+	var mu sync.Mutex
+	sizes := []int{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var texts []request
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&texts))
+
+		mu.Lock()
+		sizes = append(sizes, len(texts))
+		mu.Unlock()
+
+		// later chunks answer first, the texts are the scores
+		if texts[0].Tweet == "0.1" {
+			time.Sleep(20 * time.Millisecond)
+		}
+
+		scores := make([]string, len(texts))
+		for i, text := range texts {
+			scores[i] = text.Tweet
+		}
+		fmt.Fprintf(w, `{"prediction": [%s]}`, strings.Join(scores, ","))
+	}))
+	defer server.Close()
+
+	t.Run("reassembles chunks in order", func(t *testing.T) {
+		sizes = []int{}
+		api := New(server.Client(), server.URL, WithMaxBatchSize(2), WithMaxParallelBatches(3))
+
+		resp, err := api.Classify(context.Background(), ClassifyRequest{"0.1", "0.2", "0.3", "0.6", "0.7"})
+		assert.NoError(t, err)
+		assert.Equal(t, []float64{0.1, 0.2, 0.3, 0.6, 0.7}, resp.Scores)
+		assert.Equal(t, []Classification{Real, Real, Real, Fake, Fake}, resp.Classification)
+		assert.ElementsMatch(t, []int{2, 2, 1}, sizes)
+	})
+
+	t.Run("fails with any chunk", func(t *testing.T) {
+		api := New(server.Client(), server.URL, WithMaxBatchSize(2), WithRetryPolicy(retry.NoRetry()))
+
+		_, err := api.Classify(context.Background(), ClassifyRequest{"0.1", "0.2", "2"})
+		assert.Error(t, err)
+	})
+}
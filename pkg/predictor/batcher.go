@@ -0,0 +1,208 @@
+package predictor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Make sure Batcher implement FakeNewsClassifier interface
+var _ FakeNewsClassifier = &Batcher{}
+
+// Batcher combines requests made at about the same time, e.g. by jobs of different entities in a tick,
+// into a single request to the classifier. A batch is sent once it holds maxSize texts or once the first
+// request in it waited for linger, a maxSize of 0 means batches are only limited by linger.
+type Batcher struct {
+	classifier FakeNewsClassifier
+	maxSize    int
+	linger     time.Duration
+
+	mu      sync.Mutex
+	pending []*batchedRequest
+	size    int
+	timer   *time.Timer
+}
+
+type batchedRequest struct {
+	ctx   context.Context
+	texts ClassifyRequest
+	done  chan batchedResult
+}
+
+type batchedResult struct {
+	response ClassifyResponse
+	err      error
+}
+
+func NewBatcher(classifier FakeNewsClassifier, maxSize int, linger time.Duration) (*Batcher, error) {
+	b := &Batcher{
+		classifier: classifier,
+		maxSize:    maxSize,
+		linger:     linger,
+	}
+
+	if err := b.validate(); err != nil {
+		return nil, err
+	}
+
+	return b, nil
+}
+
+func (b *Batcher) validate() error {
+	if b.classifier == nil {
+		return errors.New("classifier is nil")
+	}
+
+	if b.maxSize < 0 {
+		return errors.New("max batch size can't be negative")
+	}
+
+	if b.linger <= 0 {
+		return errors.New("linger must be positive")
+	}
+
+	return nil
+}
+
+// Classify waits for the batch the request joined to be classified. The batch is shared with other
+// requests, so it's only cancelled once all of them are.
+func (b *Batcher) Classify(ctx context.Context, request ClassifyRequest) (ClassifyResponse, error) {
+	if len(request) == 0 {
+		return ClassifyResponse{Classification: []Classification{}, Scores: []float64{}}, nil
+	}
+
+	r := &batchedRequest{
+		ctx:   ctx,
+		texts: request,
+		done:  make(chan batchedResult, 1),
+	}
+	b.add(r)
+
+	select {
+	case result := <-r.done:
+		return result.response, result.err
+	case <-ctx.Done():
+		return ClassifyResponse{}, ctx.Err()
+	}
+}
+
+func (b *Batcher) add(r *batchedRequest) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.pending = append(b.pending, r)
+	b.size += len(r.texts)
+
+	if b.maxSize > 0 && b.size >= b.maxSize {
+		b.flushLocked()
+		return
+	}
+
+	if b.timer == nil {
+		b.timer = time.AfterFunc(b.linger, b.flush)
+	}
+}
+
+func (b *Batcher) flush() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.flushLocked()
+}
+
+func (b *Batcher) flushLocked() {
+	if b.timer != nil {
+		b.timer.Stop()
+		b.timer = nil
+	}
+
+	if len(b.pending) == 0 {
+		return
+	}
+
+	batch := b.pending
+	b.pending = nil
+	b.size = 0
+
+	go b.send(batch)
+}
+
+func (b *Batcher) send(requests []*batchedRequest) {
+	// requests cancelled while lingering are left out
+	batch := []*batchedRequest{}
+	texts := ClassifyRequest{}
+	for _, r := range requests {
+		if err := r.ctx.Err(); err != nil {
+			r.done <- batchedResult{err: err}
+			continue
+		}
+		batch = append(batch, r)
+		texts = append(texts, r.texts...)
+	}
+
+	if len(batch) == 0 {
+		return
+	}
+
+	ctx, cancel := batchContext(batch)
+	defer cancel()
+
+	response, err := b.classifier.Classify(ctx, texts)
+	if err == nil && len(response.Classification) != len(texts) {
+		err = fmt.Errorf("got %d predictions for %d texts", len(response.Classification), len(texts))
+	}
+
+	offset := 0
+	for _, r := range batch {
+		if err != nil {
+			r.done <- batchedResult{err: err}
+			continue
+		}
+
+		end := offset + len(r.texts)
+		result := ClassifyResponse{Classification: response.Classification[offset:end]}
+		if len(response.Scores) == len(texts) {
+			result.Scores = response.Scores[offset:end]
+		}
+		r.done <- batchedResult{response: result}
+		offset = end
+	}
+}
+
+// batchContext lasts until the latest deadline of the requests and is cancelled once all of them are done.
+func batchContext(batch []*batchedRequest) (context.Context, context.CancelFunc) {
+	var deadline time.Time
+	for _, r := range batch {
+		d, ok := r.ctx.Deadline()
+		if !ok {
+			deadline = time.Time{}
+			break
+		}
+		if d.After(deadline) {
+			deadline = d
+		}
+	}
+
+	var ctx context.Context
+	var cancel context.CancelFunc
+	if deadline.IsZero() {
+		ctx, cancel = context.WithCancel(context.Background())
+	} else {
+		ctx, cancel = context.WithDeadline(context.Background(), deadline)
+	}
+
+	go func() {
+		for _, r := range batch {
+			select {
+			case <-r.ctx.Done():
+			case <-ctx.Done():
+				return
+			}
+		}
+		cancel()
+	}()
+
+	return ctx, cancel
+}
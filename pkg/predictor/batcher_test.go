@@ -0,0 +1,149 @@
+package predictor
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestBatcher(t *testing.T) {
+	t.Run("combines concurrent requests", func(t *testing.T) {
+		classifier := NewMockFakeNewsClassifier(t)
+		classifier.On("Classify", mock.Anything, mock.Anything).Return(func(_ context.Context, texts ClassifyRequest) ClassifyResponse {
+			response := ClassifyResponse{}
+			for _, text := range texts {
+				c := Real
+				if text == "fake" {
+					c = Fake
+				}
+				response.Classification = append(response.Classification, c)
+				response.Scores = append(response.Scores, float64(c))
+			}
+			return response
+		}, nil).Once()
+
+		batcher, err := NewBatcher(classifier, 100, 50*time.Millisecond)
+		assert.NoError(t, err)
+
+		requests := []ClassifyRequest{{"real", "fake"}, {"fake"}, {"real", "real", "fake"}}
+		responses := make([]ClassifyResponse, len(requests))
+		var wg sync.WaitGroup
+		for i, r := range requests {
+			wg.Add(1)
+			go func(i int, r ClassifyRequest) {
+				defer wg.Done()
+				var err error
+				responses[i], err = batcher.Classify(context.Background(), r)
+				assert.NoError(t, err)
+			}(i, r)
+		}
+		wg.Wait()
+
+		assert.Equal(t, []Classification{Real, Fake}, responses[0].Classification)
+		assert.Equal(t, []Classification{Fake}, responses[1].Classification)
+		assert.Equal(t, []Classification{Real, Real, Fake}, responses[2].Classification)
+		assert.Equal(t, []float64{0, 0, 1}, responses[2].Scores)
+	})
+
+	t.Run("sends full batches right away", func(t *testing.T) {
+		classifier := NewMockFakeNewsClassifier(t)
+		classifier.On("Classify", mock.Anything, ClassifyRequest{"a", "b"}).Return(ClassifyResponse{
+			Classification: []Classification{Real, Fake},
+		}, nil)
+
+		batcher, err := NewBatcher(classifier, 2, time.Hour)
+		assert.NoError(t, err)
+
+		resp, err := batcher.Classify(context.Background(), ClassifyRequest{"a", "b"})
+		assert.NoError(t, err)
+		assert.Equal(t, []Classification{Real, Fake}, resp.Classification)
+	})
+
+	t.Run("fails every request of the batch", func(t *testing.T) {
+		classifier := NewMockFakeNewsClassifier(t)
+		classifier.On("Classify", mock.Anything, ClassifyRequest{"a", "b"}).Return(ClassifyResponse{}, errors.New("unavailable"))
+
+		batcher, err := NewBatcher(classifier, 10, time.Millisecond)
+		assert.NoError(t, err)
+
+		_, err = batcher.Classify(context.Background(), ClassifyRequest{"a", "b"})
+		assert.Error(t, err)
+	})
+
+	t.Run("cancels the predictor request once every caller is cancelled", func(t *testing.T) {
+		received := make(chan struct{}, 2)
+		cancelled := make(chan struct{})
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			// the server notices the client going away once the body is read
+			io.ReadAll(r.Body)
+			received <- struct{}{}
+			<-r.Context().Done()
+			close(cancelled)
+		}))
+		defer server.Close()
+
+		batcher, err := NewBatcher(New(server.Client(), server.URL), 2, time.Hour)
+		assert.NoError(t, err)
+
+		ctx1, cancel1 := context.WithCancel(context.Background())
+		ctx2, cancel2 := context.WithCancel(context.Background())
+		errs := make(chan error, 2)
+		go func() {
+			_, err := batcher.Classify(ctx1, ClassifyRequest{"a"})
+			errs <- err
+		}()
+		go func() {
+			_, err := batcher.Classify(ctx2, ClassifyRequest{"b"})
+			errs <- err
+		}()
+
+		<-received
+		cancel1()
+		assert.ErrorIs(t, <-errs, context.Canceled)
+		select {
+		case <-cancelled:
+			t.Fatal("request cancelled while a caller still waits for it")
+		case <-time.After(20 * time.Millisecond):
+		}
+
+		cancel2()
+		select {
+		case <-cancelled:
+		case <-time.After(time.Second):
+			t.Fatal("request not cancelled")
+		}
+		assert.ErrorIs(t, <-errs, context.Canceled)
+	})
+
+	t.Run("bounds the predictor request by the latest deadline", func(t *testing.T) {
+		classifier := NewMockFakeNewsClassifier(t)
+		var deadline time.Time
+		classifier.On("Classify", mock.Anything, ClassifyRequest{"a"}).Run(func(args mock.Arguments) {
+			deadline, _ = args.Get(0).(context.Context).Deadline()
+		}).Return(ClassifyResponse{Classification: []Classification{Real}}, nil)
+
+		batcher, err := NewBatcher(classifier, 1, time.Hour)
+		assert.NoError(t, err)
+
+		ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+		defer cancel()
+		expected, _ := ctx.Deadline()
+
+		_, err = batcher.Classify(ctx, ClassifyRequest{"a"})
+		assert.NoError(t, err)
+		assert.Equal(t, expected, deadline)
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		_, err := NewBatcher(NewMockFakeNewsClassifier(t), -1, time.Millisecond)
+		assert.Error(t, err)
+	})
+}
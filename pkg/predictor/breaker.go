@@ -0,0 +1,265 @@
+package predictor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/kordape/ottct-poller-service/pkg/logger"
+)
+
+const (
+	defaultBreakerWindow      = 20
+	defaultBreakerMinRequests = 5
+	defaultBreakerFailureRate = 0.5
+	defaultBreakerCoolDown    = 30 * time.Second
+)
+
+// Make sure Breaker implement FakeNewsClassifier interface
+var _ FakeNewsClassifier = &Breaker{}
+
+type BreakerState int
+
+const (
+	// BreakerClosed lets requests through while tracking how many of them fail.
+	BreakerClosed BreakerState = iota
+	// BreakerOpen fails requests right away until the cool-down passes.
+	BreakerOpen
+	// BreakerHalfOpen lets a single probe through, its outcome closes or reopens the breaker.
+	BreakerHalfOpen
+)
+
+func (s BreakerState) String() string {
+	switch s {
+	case BreakerClosed:
+		return "closed"
+	case BreakerOpen:
+		return "open"
+	case BreakerHalfOpen:
+		return "half-open"
+	default:
+		return fmt.Sprintf("BreakerState(%d)", int(s))
+	}
+}
+
+// CircuitOpenError is returned without calling the predictor while it's considered down.
+type CircuitOpenError struct {
+	// Until is when the predictor is going to be probed again
+	Until time.Time
+}
+
+func (e *CircuitOpenError) Error() string {
+	return fmt.Sprintf("predictor circuit is open until %s", e.Until.Format(time.RFC3339))
+}
+
+// Breaker stops calling the classifier once the rate of failures among the last requests reaches
+// the threshold, so jobs fail fast instead of waiting for timeouts of a predictor that is down.
+type Breaker struct {
+	log         logger.Interface
+	classifier  FakeNewsClassifier
+	window      int
+	minRequests int
+	failureRate float64
+	coolDown    time.Duration
+	now         func() time.Time
+
+	mu       sync.Mutex
+	state    BreakerState
+	outcomes []bool
+	next     int
+	openedAt time.Time
+	probing  bool
+}
+
+type BreakerOption func(b *Breaker)
+
+// WithFailureRate opens the breaker once rate of the requests in the window failed, given that the window
+// holds at least minRequests of them.
+func WithFailureRate(rate float64, window, minRequests int) BreakerOption {
+	return func(b *Breaker) {
+		b.failureRate = rate
+		b.window = window
+		b.minRequests = minRequests
+	}
+}
+
+// WithCoolDown sets how long the breaker stays open before probing the predictor again.
+func WithCoolDown(coolDown time.Duration) BreakerOption {
+	return func(b *Breaker) {
+		b.coolDown = coolDown
+	}
+}
+
+func NewBreaker(log logger.Interface, classifier FakeNewsClassifier, opts ...BreakerOption) (*Breaker, error) {
+	b := &Breaker{
+		log:         log,
+		classifier:  classifier,
+		window:      defaultBreakerWindow,
+		minRequests: defaultBreakerMinRequests,
+		failureRate: defaultBreakerFailureRate,
+		coolDown:    defaultBreakerCoolDown,
+		now:         time.Now,
+	}
+
+	for _, opt := range opts {
+		opt(b)
+	}
+
+	if err := b.validate(); err != nil {
+		return nil, err
+	}
+
+	return b, nil
+}
+
+func (b *Breaker) validate() error {
+	if b.log == nil {
+		return errors.New("log is nil")
+	}
+
+	if b.classifier == nil {
+		return errors.New("classifier is nil")
+	}
+
+	if b.window <= 0 {
+		return errors.New("window must be positive")
+	}
+
+	if b.minRequests <= 0 || b.minRequests > b.window {
+		return errors.New("min requests must be between 1 and the window size")
+	}
+
+	if b.failureRate <= 0 || b.failureRate > 1 {
+		return errors.New("failure rate must be in (0, 1]")
+	}
+
+	if b.coolDown <= 0 {
+		return errors.New("cool-down must be positive")
+	}
+
+	return nil
+}
+
+func (b *Breaker) State() BreakerState {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.state
+}
+
+func (b *Breaker) Classify(ctx context.Context, request ClassifyRequest) (ClassifyResponse, error) {
+	if err := b.allow(); err != nil {
+		return ClassifyResponse{}, err
+	}
+
+	response, err := b.classifier.Classify(ctx, request)
+	switch {
+	case err == nil:
+		b.record(true)
+	case ctx.Err() != nil || !Unavailable(err):
+		// requests cancelled or timed out by the caller and requests rejected by the predictor, e.g. with 400,
+		// say nothing about its health
+		b.release()
+	default:
+		b.record(false)
+	}
+
+	return response, err
+}
+
+func (b *Breaker) allow() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case BreakerOpen:
+		until := b.openedAt.Add(b.coolDown)
+		if b.now().Before(until) {
+			return &CircuitOpenError{Until: until}
+		}
+		b.transition(BreakerHalfOpen)
+		b.probing = true
+		return nil
+	case BreakerHalfOpen:
+		if b.probing {
+			// the probe decides for the requests waiting on it
+			return &CircuitOpenError{Until: b.now().Add(b.coolDown)}
+		}
+		b.probing = true
+		return nil
+	default:
+		return nil
+	}
+}
+
+func (b *Breaker) record(success bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case BreakerHalfOpen:
+		b.probing = false
+		if success {
+			b.outcomes = nil
+			b.next = 0
+			b.transition(BreakerClosed)
+		} else {
+			b.open()
+		}
+	case BreakerClosed:
+		if len(b.outcomes) < b.window {
+			b.outcomes = append(b.outcomes, success)
+		} else {
+			b.outcomes[b.next] = success
+			b.next = (b.next + 1) % b.window
+		}
+
+		if len(b.outcomes) >= b.minRequests && b.failures() >= b.failureRate {
+			b.open()
+		}
+	}
+}
+
+// release gives up the probe of a half-open breaker without deciding its state.
+func (b *Breaker) release() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.state == BreakerHalfOpen {
+		b.probing = false
+	}
+}
+
+func (b *Breaker) failures() float64 {
+	failed := 0
+	for _, success := range b.outcomes {
+		if !success {
+			failed++
+		}
+	}
+
+	return float64(failed) / float64(len(b.outcomes))
+}
+
+func (b *Breaker) open() {
+	b.openedAt = b.now()
+	b.outcomes = nil
+	b.next = 0
+	b.transition(BreakerOpen)
+}
+
+func (b *Breaker) transition(state BreakerState) {
+	if b.state == state {
+		return
+	}
+
+	message := fmt.Sprintf("Predictor circuit breaker went from %s to %s", b.state, state)
+	if state == BreakerOpen {
+		b.log.Warn(fmt.Sprintf("%s, failing requests for %s", message, b.coolDown))
+	} else {
+		b.log.Info(message)
+	}
+	b.state = state
+}
@@ -0,0 +1,121 @@
+package predictor
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/kordape/ottct-poller-service/pkg/logger"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestBreaker(t *testing.T) {
+	log := logger.New("DEBUG")
+	unavailable := &StatusError{StatusCode: http.StatusServiceUnavailable}
+	ok := ClassifyResponse{Classification: []Classification{Real}}
+
+	t.Run("opens on failure rate and fails fast", func(t *testing.T) {
+		classifier := NewMockFakeNewsClassifier(t)
+		classifier.On("Classify", mock.Anything, ClassifyRequest{"ok"}).Return(ok, nil)
+		classifier.On("Classify", mock.Anything, ClassifyRequest{"fail"}).Return(ClassifyResponse{}, unavailable)
+
+		breaker, err := NewBreaker(log, classifier, WithFailureRate(0.5, 4, 4), WithCoolDown(time.Minute))
+		assert.NoError(t, err)
+
+		for _, text := range []string{"ok", "fail", "ok"} {
+			_, _ = breaker.Classify(context.Background(), ClassifyRequest{text})
+		}
+		assert.Equal(t, BreakerClosed, breaker.State())
+
+		_, err = breaker.Classify(context.Background(), ClassifyRequest{"fail"})
+		assert.Equal(t, unavailable, err)
+		assert.Equal(t, BreakerOpen, breaker.State())
+
+		_, err = breaker.Classify(context.Background(), ClassifyRequest{"ok"})
+		var open *CircuitOpenError
+		assert.True(t, errors.As(err, &open))
+		assert.True(t, open.Until.After(time.Now()))
+		classifier.AssertNumberOfCalls(t, "Classify", 4)
+	})
+
+	t.Run("probes after cool-down", func(t *testing.T) {
+		classifier := NewMockFakeNewsClassifier(t)
+		classifier.On("Classify", mock.Anything, ClassifyRequest{"ok"}).Return(ok, nil)
+		classifier.On("Classify", mock.Anything, ClassifyRequest{"fail"}).Return(ClassifyResponse{}, unavailable)
+
+		breaker, err := NewBreaker(log, classifier, WithFailureRate(1, 1, 1), WithCoolDown(time.Minute))
+		assert.NoError(t, err)
+
+		now := time.Now()
+		breaker.now = func() time.Time { return now }
+		_, _ = breaker.Classify(context.Background(), ClassifyRequest{"fail"})
+		assert.Equal(t, BreakerOpen, breaker.State())
+
+		// a failed probe opens the breaker again
+		now = now.Add(time.Minute)
+		_, err = breaker.Classify(context.Background(), ClassifyRequest{"fail"})
+		assert.Equal(t, unavailable, err)
+		assert.Equal(t, BreakerOpen, breaker.State())
+
+		now = now.Add(time.Minute)
+		resp, err := breaker.Classify(context.Background(), ClassifyRequest{"ok"})
+		assert.NoError(t, err)
+		assert.Equal(t, ok, resp)
+		assert.Equal(t, BreakerClosed, breaker.State())
+	})
+
+	t.Run("ignores cancelled requests", func(t *testing.T) {
+		classifier := NewMockFakeNewsClassifier(t)
+		classifier.On("Classify", mock.Anything, mock.Anything).Return(ClassifyResponse{}, context.Canceled)
+
+		breaker, err := NewBreaker(log, classifier, WithFailureRate(1, 1, 1))
+		assert.NoError(t, err)
+
+		_, err = breaker.Classify(context.Background(), ClassifyRequest{"text"})
+		assert.Error(t, err)
+		assert.Equal(t, BreakerClosed, breaker.State())
+	})
+
+	t.Run("ignores requests timed out by the caller", func(t *testing.T) {
+		classifier := NewMockFakeNewsClassifier(t)
+		classifier.On("Classify", mock.Anything, mock.Anything).Return(ClassifyResponse{}, context.DeadlineExceeded)
+
+		breaker, err := NewBreaker(log, classifier, WithFailureRate(1, 1, 1))
+		assert.NoError(t, err)
+
+		ctx, cancel := context.WithDeadline(context.Background(), time.Now())
+		defer cancel()
+
+		_, err = breaker.Classify(ctx, ClassifyRequest{"text"})
+		assert.ErrorIs(t, err, context.DeadlineExceeded)
+		assert.Equal(t, BreakerClosed, breaker.State())
+
+		// the predictor timing out on its own is a failure
+		_, err = breaker.Classify(context.Background(), ClassifyRequest{"text"})
+		assert.ErrorIs(t, err, context.DeadlineExceeded)
+		assert.Equal(t, BreakerOpen, breaker.State())
+	})
+
+	t.Run("ignores rejected requests", func(t *testing.T) {
+		classifier := NewMockFakeNewsClassifier(t)
+		classifier.On("Classify", mock.Anything, mock.Anything).Return(ClassifyResponse{}, &StatusError{StatusCode: http.StatusBadRequest})
+
+		breaker, err := NewBreaker(log, classifier, WithFailureRate(1, 1, 1))
+		assert.NoError(t, err)
+
+		for i := 0; i < 3; i++ {
+			_, err = breaker.Classify(context.Background(), ClassifyRequest{"text"})
+			assert.Error(t, err)
+		}
+		assert.Equal(t, BreakerClosed, breaker.State())
+		classifier.AssertNumberOfCalls(t, "Classify", 3)
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		_, err := NewBreaker(log, NewMockFakeNewsClassifier(t), WithFailureRate(0.5, 2, 3))
+		assert.Error(t, err)
+	})
+}
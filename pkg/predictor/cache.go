@@ -0,0 +1,262 @@
+package predictor
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/kordape/ottct-poller-service/pkg/logger"
+)
+
+// maxExpiryInterval is how often at most expired predictions are dropped from stores which don't
+// evict them on their own.
+const maxExpiryInterval = time.Hour
+
+// Make sure Cache implement FakeNewsClassifier interface
+var _ FakeNewsClassifier = &Cache{}
+
+//go:generate mockery --inpackage --case snake --disable-version-string --name "PredictionStore"
+type PredictionStore interface {
+	// GetPredictions returns the stored predictions of the keys, keyed by the key. Missing keys are left out.
+	GetPredictions(ctx context.Context, keys []string) (map[string]CachedPrediction, error)
+	SavePredictions(ctx context.Context, predictions []CachedPrediction) error
+}
+
+// ExpiringPredictionStore is a PredictionStore which keeps predictions until they are deleted, e.g. a
+// database table, unlike MemoryPredictionStore which evicts them on its own.
+type ExpiringPredictionStore interface {
+	PredictionStore
+	DeletePredictionsBefore(ctx context.Context, before time.Time) error
+}
+
+// CachedPrediction is the prediction of a text identified by Key, see CacheKey.
+type CachedPrediction struct {
+	Key        string
+	Prediction Prediction
+	CreatedAt  time.Time
+}
+
+// CacheStats count the texts served from the cache and the ones classified by the predictor.
+// Errors count failed store lookups and saves, which don't fail the classification.
+type CacheStats struct {
+	Hits   int64
+	Misses int64
+	Errors int64
+}
+
+// Cache classifies only texts it hasn't seen recently, e.g. retweets of the same viral tweet,
+// and serves the rest from the store.
+type Cache struct {
+	log          logger.Interface
+	classifier   FakeNewsClassifier
+	store        PredictionStore
+	ttl          time.Duration
+	modelVersion string
+	now          func() time.Time
+
+	hits   int64
+	misses int64
+	errors int64
+	// expiredAt is when expired predictions were last dropped from the store, in unix nanoseconds
+	expiredAt int64
+}
+
+type CacheOption func(c *Cache)
+
+// WithTTL expires cached predictions after ttl, 0 means they never expire.
+func WithTTL(ttl time.Duration) CacheOption {
+	return func(c *Cache) {
+		c.ttl = ttl
+	}
+}
+
+// WithModelVersion keys the predictions with the version of the model, so a new model doesn't get
+// predictions of the previous one.
+func WithModelVersion(version string) CacheOption {
+	return func(c *Cache) {
+		c.modelVersion = version
+	}
+}
+
+func NewCache(log logger.Interface, classifier FakeNewsClassifier, store PredictionStore, opts ...CacheOption) (*Cache, error) {
+	c := &Cache{
+		log:        log,
+		classifier: classifier,
+		store:      store,
+		now:        time.Now,
+	}
+
+	for _, opt := range opts {
+		opt(c)
+	}
+
+	if err := c.validate(); err != nil {
+		return nil, err
+	}
+
+	return c, nil
+}
+
+func (c *Cache) validate() error {
+	if c.log == nil {
+		return errors.New("logger is nil")
+	}
+
+	if c.classifier == nil {
+		return errors.New("classifier is nil")
+	}
+
+	if c.store == nil {
+		return errors.New("prediction store is nil")
+	}
+
+	if c.ttl < 0 {
+		return errors.New("ttl can't be negative")
+	}
+
+	return nil
+}
+
+func (c *Cache) Stats() CacheStats {
+	return CacheStats{
+		Hits:   atomic.LoadInt64(&c.hits),
+		Misses: atomic.LoadInt64(&c.misses),
+		Errors: atomic.LoadInt64(&c.errors),
+	}
+}
+
+func (c *Cache) Classify(ctx context.Context, request ClassifyRequest) (ClassifyResponse, error) {
+	keys := make([]string, len(request))
+	uniqueKeys := []string{}
+	seen := map[string]bool{}
+	for i, text := range request {
+		keys[i] = CacheKey(c.modelVersion, text)
+		if !seen[keys[i]] {
+			seen[keys[i]] = true
+			uniqueKeys = append(uniqueKeys, keys[i])
+		}
+	}
+
+	predictions := map[string]Prediction{}
+	if len(uniqueKeys) > 0 {
+		cached, err := c.store.GetPredictions(ctx, uniqueKeys)
+		if err != nil {
+			// the predictor can still classify everything
+			atomic.AddInt64(&c.errors, 1)
+			c.log.Warn(fmt.Sprintf("Failed to get cached predictions: %v", err))
+		}
+
+		now := c.now()
+		for key, p := range cached {
+			if c.ttl == 0 || now.Sub(p.CreatedAt) < c.ttl {
+				predictions[key] = p.Prediction
+			}
+		}
+	}
+
+	// texts sharing a key are classified once
+	missingTexts := ClassifyRequest{}
+	missingKeys := []string{}
+	queued := map[string]bool{}
+	for i, text := range request {
+		if _, ok := predictions[keys[i]]; ok || queued[keys[i]] {
+			continue
+		}
+		queued[keys[i]] = true
+		missingTexts = append(missingTexts, text)
+		missingKeys = append(missingKeys, keys[i])
+	}
+
+	if len(missingTexts) > 0 {
+		response, err := c.classifier.Classify(ctx, missingTexts)
+		if err != nil {
+			return ClassifyResponse{}, err
+		}
+
+		if len(response.Classification) != len(missingTexts) {
+			return ClassifyResponse{}, fmt.Errorf("got %d predictions for %d texts", len(response.Classification), len(missingTexts))
+		}
+
+		now := c.now()
+		classified := make([]CachedPrediction, len(missingKeys))
+		for i, p := range response.Predictions() {
+			predictions[missingKeys[i]] = p
+			classified[i] = CachedPrediction{Key: missingKeys[i], Prediction: p, CreatedAt: now}
+		}
+
+		if err := c.store.SavePredictions(ctx, classified); err != nil {
+			atomic.AddInt64(&c.errors, 1)
+			c.log.Warn(fmt.Sprintf("Failed to cache predictions: %v", err))
+		}
+	}
+
+	c.expire(ctx)
+
+	atomic.AddInt64(&c.misses, int64(len(missingTexts)))
+	atomic.AddInt64(&c.hits, int64(len(request)-len(missingTexts)))
+
+	result := ClassifyResponse{
+		Classification: make([]Classification, len(request)),
+		Scores:         make([]float64, len(request)),
+	}
+	for i, key := range keys {
+		result.Classification[i] = predictions[key].Classification
+		result.Scores[i] = predictions[key].Score
+	}
+
+	return result, nil
+}
+
+// expire drops expired predictions from stores which keep them until deleted, at most once per
+// expiry interval. Expired predictions are never served, this only keeps the store from growing.
+func (c *Cache) expire(ctx context.Context) {
+	store, ok := c.store.(ExpiringPredictionStore)
+	if !ok || c.ttl == 0 {
+		return
+	}
+
+	interval := c.ttl
+	if interval > maxExpiryInterval {
+		interval = maxExpiryInterval
+	}
+
+	now := c.now()
+	expiredAt := atomic.LoadInt64(&c.expiredAt)
+	if now.Sub(time.Unix(0, expiredAt)) < interval || !atomic.CompareAndSwapInt64(&c.expiredAt, expiredAt, now.UnixNano()) {
+		return
+	}
+
+	if err := store.DeletePredictionsBefore(ctx, now.Add(-c.ttl)); err != nil {
+		atomic.AddInt64(&c.errors, 1)
+		c.log.Warn(fmt.Sprintf("Failed to delete expired predictions: %v", err))
+	}
+}
+
+var (
+	retweetPrefix = regexp.MustCompile(`^rt @\w+:\s*`)
+	shortLinks    = regexp.MustCompile(`https?://t\.co/\S+`)
+)
+
+// NormalizeText strips what differs between copies of the same text: case, whitespace, t.co links,
+// which Twitter shortens differently in each tweet, and the retweet prefix. Other links are kept,
+// texts linking to different articles aren't the same.
+func NormalizeText(text string) string {
+	text = strings.ToLower(text)
+	text = shortLinks.ReplaceAllString(text, "")
+	text = strings.Join(strings.Fields(text), " ")
+
+	return retweetPrefix.ReplaceAllString(text, "")
+}
+
+// CacheKey identifies the prediction of the model version for the text.
+func CacheKey(modelVersion, text string) string {
+	sum := sha256.Sum256([]byte(modelVersion + "\x00" + NormalizeText(text)))
+
+	return hex.EncodeToString(sum[:])
+}
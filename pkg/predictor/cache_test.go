@@ -0,0 +1,136 @@
+package predictor
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/kordape/ottct-poller-service/pkg/logger"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestCache(t *testing.T) {
+	t.Run("classifies only unseen texts", func(t *testing.T) {
+		classifier := NewMockFakeNewsClassifier(t)
+		classifier.On("Classify", mock.Anything, ClassifyRequest{"Moon landing was staged https://t.co/a", "Sky is blue"}).Return(ClassifyResponse{
+			Classification: []Classification{Fake, Real},
+			Scores:         []float64{0.9, 0.1},
+		}, nil).Once()
+		classifier.On("Classify", mock.Anything, ClassifyRequest{"Water is wet"}).Return(ClassifyResponse{
+			Classification: []Classification{Real},
+		}, nil).Once()
+
+		cache, err := NewCache(logger.New("DEBUG"), classifier, NewMemoryPredictionStore(10))
+		assert.NoError(t, err)
+
+		resp, err := cache.Classify(context.Background(), ClassifyRequest{"Moon landing was staged https://t.co/a", "Sky is blue", "moon landing  was staged https://t.co/a"})
+		assert.NoError(t, err)
+		assert.Equal(t, []Classification{Fake, Real, Fake}, resp.Classification)
+		assert.Equal(t, []float64{0.9, 0.1, 0.9}, resp.Scores)
+
+		resp, err = cache.Classify(context.Background(), ClassifyRequest{"Water is wet", "RT @foo: Moon landing was staged https://t.co/b"})
+		assert.NoError(t, err)
+		assert.Equal(t, []Classification{Real, Fake}, resp.Classification)
+		assert.Equal(t, CacheStats{Hits: 2, Misses: 3}, cache.Stats())
+	})
+
+	t.Run("expires predictions", func(t *testing.T) {
+		classifier := NewMockFakeNewsClassifier(t)
+		classifier.On("Classify", mock.Anything, ClassifyRequest{"text"}).Return(ClassifyResponse{
+			Classification: []Classification{Fake},
+		}, nil).Twice()
+
+		cache, err := NewCache(logger.New("DEBUG"), classifier, NewMemoryPredictionStore(10), WithTTL(time.Hour))
+		assert.NoError(t, err)
+
+		now := time.Now()
+		cache.now = func() time.Time { return now }
+		_, err = cache.Classify(context.Background(), ClassifyRequest{"text"})
+		assert.NoError(t, err)
+
+		cache.now = func() time.Time { return now.Add(time.Hour) }
+		_, err = cache.Classify(context.Background(), ClassifyRequest{"text"})
+		assert.NoError(t, err)
+	})
+
+	t.Run("keys predictions by model version", func(t *testing.T) {
+		assert.Equal(t, CacheKey("v1", "Some  TEXT"), CacheKey("v1", "some text"))
+		assert.NotEqual(t, CacheKey("v1", "some text"), CacheKey("v2", "some text"))
+	})
+
+	t.Run("keys predictions by links other than t.co", func(t *testing.T) {
+		assert.Equal(t, CacheKey("v1", "Read this https://t.co/a"), CacheKey("v1", "Read this https://t.co/b"))
+		assert.NotEqual(t, CacheKey("v1", "Read this https://example.com/a"), CacheKey("v1", "Read this https://example.com/b"))
+	})
+
+	t.Run("falls back to the classifier when the store fails", func(t *testing.T) {
+		store := NewMockPredictionStore(t)
+		store.On("GetPredictions", mock.Anything, mock.Anything).Return(nil, errors.New("unavailable"))
+		store.On("SavePredictions", mock.Anything, mock.Anything).Return(errors.New("unavailable"))
+
+		classifier := NewMockFakeNewsClassifier(t)
+		classifier.On("Classify", mock.Anything, ClassifyRequest{"text"}).Return(ClassifyResponse{
+			Classification: []Classification{Real},
+		}, nil)
+
+		cache, err := NewCache(logger.New("DEBUG"), classifier, store)
+		assert.NoError(t, err)
+
+		resp, err := cache.Classify(context.Background(), ClassifyRequest{"text"})
+		assert.NoError(t, err)
+		assert.Equal(t, []Classification{Real}, resp.Classification)
+		assert.Equal(t, CacheStats{Misses: 1, Errors: 2}, cache.Stats())
+	})
+
+	t.Run("deletes expired predictions from the store", func(t *testing.T) {
+		classifier := NewMockFakeNewsClassifier(t)
+		classifier.On("Classify", mock.Anything, mock.Anything).Return(ClassifyResponse{
+			Classification: []Classification{Real},
+		}, nil)
+
+		store := &expiringStore{MemoryPredictionStore: NewMemoryPredictionStore(10)}
+		cache, err := NewCache(logger.New("DEBUG"), classifier, store, WithTTL(24*time.Hour))
+		assert.NoError(t, err)
+
+		now := time.Now()
+		cache.now = func() time.Time { return now }
+		for _, text := range []string{"text1", "text2"} {
+			_, err = cache.Classify(context.Background(), ClassifyRequest{text})
+			assert.NoError(t, err)
+		}
+		assert.Equal(t, []time.Time{now.Add(-24 * time.Hour)}, store.deletedBefore)
+
+		cache.now = func() time.Time { return now.Add(maxExpiryInterval) }
+		_, err = cache.Classify(context.Background(), ClassifyRequest{"text3"})
+		assert.NoError(t, err)
+		assert.Equal(t, []time.Time{now.Add(-24 * time.Hour), now.Add(maxExpiryInterval - 24*time.Hour)}, store.deletedBefore)
+	})
+}
+
+type expiringStore struct {
+	*MemoryPredictionStore
+	deletedBefore []time.Time
+}
+
+func (s *expiringStore) DeletePredictionsBefore(_ context.Context, before time.Time) error {
+	s.deletedBefore = append(s.deletedBefore, before)
+	return nil
+}
+
+func TestMemoryPredictionStore(t *testing.T) {
+	store := NewMemoryPredictionStore(2)
+	ctx := context.Background()
+
+	assert.NoError(t, store.SavePredictions(ctx, []CachedPrediction{{Key: "a"}, {Key: "b"}}))
+	_, err := store.GetPredictions(ctx, []string{"a"})
+	assert.NoError(t, err)
+	assert.NoError(t, store.SavePredictions(ctx, []CachedPrediction{{Key: "c"}}))
+
+	predictions, err := store.GetPredictions(ctx, []string{"a", "b", "c"})
+	assert.NoError(t, err)
+	assert.Len(t, predictions, 2)
+	assert.NotContains(t, predictions, "b")
+	assert.Equal(t, 2, store.Len())
+}
@@ -3,8 +3,12 @@ package predictor
 import (
 	"context"
 	"net/http"
+
+	"github.com/kordape/ottct-poller-service/pkg/retry"
 )
 
+const defaultMaxParallelBatches = 4
+
 type Classification int
 
 const (
@@ -21,19 +25,90 @@ type ClassifyRequest []string
 
 type ClassifyResponse struct {
 	Classification []Classification
+	// Scores are the probabilities of the texts being fake news, in the order of Classification.
+	// Models answering with bare labels score 0 or 1.
+	Scores []float64
+}
+
+// Prediction is the classification of a single text along with the confidence of the model.
+type Prediction struct {
+	Classification Classification
+	Score          float64
+}
+
+// Fake tells whether the text counts as fake news when scores of at least threshold do.
+func (p Prediction) Fake(threshold float64) bool {
+	return p.Score >= threshold
+}
+
+// Predictions pairs the classifications with their scores. Classifications without a score
+// are scored 0 or 1 according to their label.
+func (r ClassifyResponse) Predictions() []Prediction {
+	predictions := make([]Prediction, len(r.Classification))
+	for i, c := range r.Classification {
+		predictions[i] = Prediction{Classification: c}
+		switch {
+		case i < len(r.Scores):
+			predictions[i].Score = r.Scores[i]
+		case c == Fake:
+			predictions[i].Score = 1
+		}
+	}
+
+	return predictions
 }
 
 // Make sure Client implement FakeNewsClassifier interface
 var _ FakeNewsClassifier = &Client{}
 
 type Client struct {
-	httpClient *http.Client
-	baseURL    string
+	httpClient  *http.Client
+	baseURL     string
+	retryPolicy retry.Policy
+	// maxBatchSize limits how many texts are sent in a single request, 0 means no limit
+	maxBatchSize       int
+	maxParallelBatches int
 }
 
-func New(client *http.Client, baseURL string) *Client {
-	return &Client{
-		httpClient: client,
-		baseURL:    baseURL,
+type Option func(c *Client)
+
+// WithRetryPolicy sets how failed classification requests are retried.
+func WithRetryPolicy(policy retry.Policy) Option {
+	return func(c *Client) {
+		c.retryPolicy = policy
 	}
 }
+
+// WithMaxBatchSize limits how many texts are sent to the predictor in a single request, 0 means no limit.
+// Larger requests are split into chunks.
+func WithMaxBatchSize(size int) Option {
+	return func(c *Client) {
+		c.maxBatchSize = size
+	}
+}
+
+// WithMaxParallelBatches limits how many chunks of a request are classified at the same time.
+func WithMaxParallelBatches(parallel int) Option {
+	return func(c *Client) {
+		c.maxParallelBatches = parallel
+	}
+}
+
+func New(client *http.Client, baseURL string, opts ...Option) *Client {
+	c := &Client{
+		httpClient:         client,
+		baseURL:            baseURL,
+		retryPolicy:        retry.DefaultPolicy(),
+		maxParallelBatches: defaultMaxParallelBatches,
+	}
+
+	for _, opt := range opts {
+		opt(c)
+	}
+
+	if c.maxParallelBatches <= 0 {
+		c.maxParallelBatches = 1
+	}
+
+	return c
+}
@@ -0,0 +1,73 @@
+package predictor
+
+import (
+	"container/list"
+	"context"
+	"sync"
+)
+
+// Make sure MemoryPredictionStore implement PredictionStore interface
+var _ PredictionStore = &MemoryPredictionStore{}
+
+// MemoryPredictionStore keeps the most recently used predictions in memory, evicting the least recently
+// used ones beyond its size. They are lost when the process exits.
+type MemoryPredictionStore struct {
+	size int
+
+	mu      sync.Mutex
+	order   *list.List
+	entries map[string]*list.Element
+}
+
+func NewMemoryPredictionStore(size int) *MemoryPredictionStore {
+	return &MemoryPredictionStore{
+		size:    size,
+		order:   list.New(),
+		entries: map[string]*list.Element{},
+	}
+}
+
+func (s *MemoryPredictionStore) GetPredictions(_ context.Context, keys []string) (map[string]CachedPrediction, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	predictions := map[string]CachedPrediction{}
+	for _, key := range keys {
+		if e, ok := s.entries[key]; ok {
+			s.order.MoveToFront(e)
+			predictions[key] = e.Value.(CachedPrediction)
+		}
+	}
+
+	return predictions, nil
+}
+
+func (s *MemoryPredictionStore) SavePredictions(_ context.Context, predictions []CachedPrediction) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, p := range predictions {
+		if e, ok := s.entries[p.Key]; ok {
+			e.Value = p
+			s.order.MoveToFront(e)
+			continue
+		}
+
+		s.entries[p.Key] = s.order.PushFront(p)
+	}
+
+	for s.size > 0 && s.order.Len() > s.size {
+		oldest := s.order.Back()
+		s.order.Remove(oldest)
+		delete(s.entries, oldest.Value.(CachedPrediction).Key)
+	}
+
+	return nil
+}
+
+func (s *MemoryPredictionStore) Len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.order.Len()
+}
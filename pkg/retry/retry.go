@@ -0,0 +1,190 @@
+package retry
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Policy describes how failed HTTP requests are retried. Attempts are spaced with exponential
+// backoff randomized by Jitter, unless the server asks for a specific delay with Retry-After.
+type Policy struct {
+	// MaxAttempts is the total number of attempts including the first one, values below 2 disable retries
+	MaxAttempts    int
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+	Multiplier     float64
+	// Jitter is the fraction of the backoff which is randomized, from 0 to 1
+	Jitter float64
+	// Retryable reports whether a response with the given status code should be retried
+	Retryable func(statusCode int) bool
+}
+
+func DefaultPolicy() Policy {
+	return Policy{
+		MaxAttempts:    3,
+		InitialBackoff: 200 * time.Millisecond,
+		MaxBackoff:     5 * time.Second,
+		Multiplier:     2,
+		Jitter:         0.2,
+		Retryable:      TransientErrors,
+	}
+}
+
+// NoRetry makes only a single attempt.
+func NoRetry() Policy {
+	return Policy{
+		MaxAttempts: 1,
+	}
+}
+
+// TransientErrors retries throttled requests and server errors which are likely to go away.
+func TransientErrors(statusCode int) bool {
+	return statusCode == http.StatusTooManyRequests || ServerErrors(statusCode)
+}
+
+// ServerErrors retries 5xx responses except those which won't change by retrying.
+func ServerErrors(statusCode int) bool {
+	return statusCode >= 500 && statusCode != http.StatusNotImplemented && statusCode != http.StatusHTTPVersionNotSupported
+}
+
+// ExceptStatus returns a copy of the policy which doesn't retry responses with the given status codes.
+// The API clients apply it to any policy they're given with 429, so throttled requests are never retried.
+func (p Policy) ExceptStatus(statusCodes ...int) Policy {
+	retryable := p.Retryable
+	p.Retryable = func(statusCode int) bool {
+		for _, code := range statusCodes {
+			if statusCode == code {
+				return false
+			}
+		}
+
+		return retryable != nil && retryable(statusCode)
+	}
+
+	return p
+}
+
+func (p Policy) Validate() error {
+	if p.MaxAttempts > 1 && p.InitialBackoff <= 0 {
+		return errors.New("initial backoff must be positive")
+	}
+
+	if p.MaxBackoff < p.InitialBackoff {
+		return errors.New("max backoff can't be lower than initial backoff")
+	}
+
+	if p.Jitter < 0 || p.Jitter > 1 {
+		return errors.New("jitter must be between 0 and 1")
+	}
+
+	return nil
+}
+
+// Do sends req with client, retrying network errors and retryable responses. Requests with a
+// body are replayed using req.GetBody, which http.NewRequest sets for in-memory bodies.
+// The response of the last attempt is returned as is, so callers handle it like a single call.
+func (p Policy) Do(ctx context.Context, client *http.Client, req *http.Request) (*http.Response, error) {
+	attempts := p.MaxAttempts
+	if attempts < 1 {
+		attempts = 1
+	}
+
+	for attempt := 1; ; attempt++ {
+		attemptReq := req.Clone(ctx)
+		if req.Body != nil && attempt > 1 {
+			if req.GetBody == nil {
+				return nil, errors.New("can't retry request with a body that can't be replayed")
+			}
+
+			body, err := req.GetBody()
+			if err != nil {
+				return nil, fmt.Errorf("error replaying request body: %w", err)
+			}
+			attemptReq.Body = body
+		}
+
+		resp, err := client.Do(attemptReq)
+		if attempt >= attempts || !p.shouldRetry(ctx, resp, err) {
+			return resp, err
+		}
+
+		wait, ok := p.wait(attempt, resp)
+		if !ok {
+			// the server asked to come back later than we'd wait, its response tells the caller when
+			return resp, nil
+		}
+		if resp != nil {
+			// drain the body so the connection can be reused
+			io.Copy(io.Discard, resp.Body)
+			resp.Body.Close()
+		}
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+func (p Policy) shouldRetry(ctx context.Context, resp *http.Response, err error) bool {
+	if ctx.Err() != nil {
+		return false
+	}
+
+	if err != nil {
+		return true
+	}
+
+	return p.Retryable != nil && p.Retryable(resp.StatusCode)
+}
+
+// wait returns how long to wait before the next attempt. It reports false if the server asks
+// to wait longer than MaxBackoff.
+func (p Policy) wait(attempt int, resp *http.Response) (time.Duration, bool) {
+	if resp != nil {
+		if retryAfter, ok := parseRetryAfter(resp.Header.Get("Retry-After"), time.Now()); ok {
+			return retryAfter, retryAfter <= p.MaxBackoff
+		}
+	}
+
+	backoff := float64(p.InitialBackoff) * math.Pow(math.Max(p.Multiplier, 1), float64(attempt-1))
+	if backoff > float64(p.MaxBackoff) {
+		backoff = float64(p.MaxBackoff)
+	}
+	backoff -= backoff * p.Jitter * rand.Float64()
+
+	return time.Duration(backoff), true
+}
+
+// parseRetryAfter parses Retry-After given either in seconds or as an HTTP date.
+func parseRetryAfter(header string, now time.Time) (time.Duration, bool) {
+	if header == "" {
+		return 0, false
+	}
+
+	if seconds, err := strconv.Atoi(header); err == nil {
+		if seconds < 0 {
+			return 0, false
+		}
+		return time.Duration(seconds) * time.Second, true
+	}
+
+	if date, err := http.ParseTime(header); err == nil {
+		if wait := date.Sub(now); wait > 0 {
+			return wait, true
+		}
+		return 0, true
+	}
+
+	return 0, false
+}
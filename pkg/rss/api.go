@@ -0,0 +1,212 @@
+package rss
+
+import (
+	"context"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/kordape/ottct-poller-service/pkg/logger"
+	"github.com/kordape/ottct-poller-service/pkg/source"
+)
+
+// used when a feed throttles requests without telling when to come back
+const defaultRetryAfter = 15 * time.Minute
+
+// pubDateLayouts are the date formats found in the wild in RSS pubDate elements.
+var pubDateLayouts = []string{
+	time.RFC1123Z,
+	time.RFC1123,
+	"Mon, 2 Jan 2006 15:04:05 -0700",
+	"Mon, 2 Jan 2006 15:04:05 MST",
+	time.RFC822Z,
+	time.RFC822,
+	time.RFC3339,
+}
+
+// feed holds both RSS 2.0 and Atom documents, only the elements of one of them are set.
+type feed struct {
+	Channel struct {
+		Items []item `xml:"item"`
+	} `xml:"channel"`
+	Entries []entry `xml:"entry"`
+}
+
+type item struct {
+	Title       string `xml:"title"`
+	Link        string `xml:"link"`
+	Description string `xml:"description"`
+	GUID        string `xml:"guid"`
+	PubDate     string `xml:"pubDate"`
+	Creator     string `xml:"creator"`
+	Author      string `xml:"author"`
+}
+
+type entry struct {
+	ID    string `xml:"id"`
+	Title string `xml:"title"`
+	Links []struct {
+		Href string `xml:"href,attr"`
+		Rel  string `xml:"rel,attr"`
+	} `xml:"link"`
+	Summary   string `xml:"summary"`
+	Content   string `xml:"content"`
+	Published string `xml:"published"`
+	Updated   string `xml:"updated"`
+	Author    struct {
+		Name string `xml:"name"`
+	} `xml:"author"`
+}
+
+// FetchPosts returns the feed entries published after SinceTime, or in the time window when it's not set.
+// Feeds have no ordered IDs, so SinceID and UntilID are ignored. A feed is a single page, so MaxPages is
+// always met and the response is never truncated, entries which dropped off the feed can't be fetched.
+func (c *Client) FetchPosts(ctx context.Context, log logger.Interface, request source.FetchPostsRequest) (source.FetchPostsResponse, error) {
+	f, err := c.fetchFeed(ctx, request.Account)
+	if err != nil {
+		return source.FetchPostsResponse{}, fmt.Errorf("error fetching feed %s: %w", request.Account, err)
+	}
+
+	entries := append(fromItems(f.Channel.Items), fromEntries(f.Entries)...)
+
+	posts := []source.Post{}
+	for _, p := range entries {
+		switch {
+		case p.CreatedAt.IsZero():
+			log.Debug(fmt.Sprintf("Skipping entry %s of feed %s without a date", p.ID, request.Account))
+		case !request.SinceTime.IsZero():
+			if p.CreatedAt.After(request.SinceTime) {
+				posts = append(posts, p)
+			}
+		case !p.CreatedAt.Before(request.StartTime) && (request.EndTime.IsZero() || p.CreatedAt.Before(request.EndTime)):
+			posts = append(posts, p)
+		}
+	}
+
+	sort.SliceStable(posts, func(i, j int) bool {
+		return posts[i].CreatedAt.After(posts[j].CreatedAt)
+	})
+
+	log.Info(fmt.Sprintf("Received %d of %d entries of feed %s", len(posts), len(entries), request.Account))
+
+	return source.FetchPostsResponse{Posts: posts}, nil
+}
+
+func (c *Client) fetchFeed(ctx context.Context, feedURL string) (feed, error) {
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, feedURL, nil)
+	if err != nil {
+		return feed{}, fmt.Errorf("error creating request: %w", err)
+	}
+	request.Header.Set("Accept", "application/rss+xml, application/atom+xml, application/xml;q=0.9, text/xml;q=0.8")
+
+	resp, err := c.retryPolicy.Do(ctx, c.httpClient, request)
+	if err != nil {
+		return feed{}, fmt.Errorf("error doing request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusTooManyRequests, http.StatusServiceUnavailable:
+		reset := time.Now().Add(defaultRetryAfter)
+		if seconds, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil {
+			reset = time.Now().Add(time.Duration(seconds) * time.Second)
+		}
+		return feed{}, &source.RateLimitedError{Source: "rss", Reset: reset}
+	case http.StatusNotFound, http.StatusGone:
+		return feed{}, source.ErrNotFound
+	default:
+		return feed{}, fmt.Errorf("request failed with: %d", resp.StatusCode)
+	}
+
+	var f feed
+	decoder := xml.NewDecoder(resp.Body)
+	// feeds declare all kinds of encodings, the text is passed through as it is
+	decoder.CharsetReader = func(_ string, input io.Reader) (io.Reader, error) {
+		return input, nil
+	}
+	if err := decoder.Decode(&f); err != nil {
+		return feed{}, fmt.Errorf("error decoding feed: %w", err)
+	}
+
+	return f, nil
+}
+
+func fromItems(items []item) []source.Post {
+	posts := make([]source.Post, len(items))
+	for i, it := range items {
+		posts[i] = source.Post{
+			ID:        firstNonEmpty(it.GUID, it.Link),
+			Text:      text(it.Title, it.Description),
+			CreatedAt: parseDate(it.PubDate),
+			URL:       strings.TrimSpace(it.Link),
+			Author:    firstNonEmpty(it.Creator, it.Author),
+		}
+	}
+
+	return posts
+}
+
+func fromEntries(entries []entry) []source.Post {
+	posts := make([]source.Post, len(entries))
+	for i, e := range entries {
+		link := ""
+		for _, l := range e.Links {
+			if l.Rel == "" || l.Rel == "alternate" {
+				link = l.Href
+				break
+			}
+		}
+
+		posts[i] = source.Post{
+			ID:        firstNonEmpty(e.ID, link),
+			Text:      text(e.Title, firstNonEmpty(e.Summary, e.Content)),
+			CreatedAt: parseDate(firstNonEmpty(e.Published, e.Updated)),
+			URL:       link,
+			Author:    strings.TrimSpace(e.Author.Name),
+		}
+	}
+
+	return posts
+}
+
+// text joins the title and the description of an entry, as both of them can carry the claim.
+func text(title, description string) string {
+	title = source.PlainText(title)
+	description = source.PlainText(description)
+	if description == "" || description == title {
+		return title
+	}
+
+	if title == "" {
+		return description
+	}
+
+	return title + "\n" + description
+}
+
+func parseDate(value string) time.Time {
+	value = strings.TrimSpace(value)
+	for _, layout := range pubDateLayouts {
+		if t, err := time.Parse(layout, value); err == nil {
+			return t
+		}
+	}
+
+	return time.Time{}
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if v = strings.TrimSpace(v); v != "" {
+			return v
+		}
+	}
+
+	return ""
+}
@@ -0,0 +1,153 @@
+package rss
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/kordape/ottct-poller-service/pkg/logger"
+	"github.com/kordape/ottct-poller-service/pkg/retry"
+	"github.com/kordape/ottct-poller-service/pkg/source"
+	"github.com/stretchr/testify/assert"
+)
+
+const rssFeed = `<?xml version="1.0" encoding="UTF-8"?>
+<rss version="2.0" xmlns:dc="http://purl.org/dc/elements/1.1/">
+  <channel>
+    <title>News</title>
+    <item>
+      <title>Older story</title>
+      <link>https://news.example/older</link>
+      <description>Something happened</description>
+      <pubDate>Sun, 01 Jan 2023 10:00:00 +0000</pubDate>
+    </item>
+    <item>
+      <title>Moon made of cheese</title>
+      <link>https://news.example/moon</link>
+      <guid>moon-1</guid>
+      <description>&lt;p&gt;Scientists &lt;b&gt;confirm&lt;/b&gt; it&lt;/p&gt;</description>
+      <dc:creator>Jane Doe</dc:creator>
+      <pubDate>Mon, 2 Jan 2023 10:00:00 GMT</pubDate>
+    </item>
+    <item>
+      <title>Undated</title>
+      <link>https://news.example/undated</link>
+    </item>
+  </channel>
+</rss>`
+
+const atomFeed = `<?xml version="1.0" encoding="utf-8"?>
+<feed xmlns="http://www.w3.org/2005/Atom">
+  <title>Blog</title>
+  <entry>
+    <id>tag:blog.example,2023:1</id>
+    <title>Vaccines contain chips</title>
+    <link rel="alternate" href="https://blog.example/1"/>
+    <published>2023-01-02T12:00:00Z</published>
+    <summary type="html">Read &lt;a href="#"&gt;this&lt;/a&gt;</summary>
+    <author><name>John</name></author>
+  </entry>
+</feed>`
+
+func TestFetchPosts(t *testing.T) {
+	log := logger.New("DEBUG")
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/rss":
+			fmt.Fprint(w, rssFeed)
+		case "/atom":
+			fmt.Fprint(w, atomFeed)
+		case "/throttled":
+			w.Header().Set("Retry-After", "60")
+			w.WriteHeader(http.StatusTooManyRequests)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	client := New(server.Client(), WithRetryPolicy(retry.NoRetry()))
+
+	t.Run("parses rss feeds", func(t *testing.T) {
+		response, err := client.FetchPosts(context.Background(), log, source.FetchPostsRequest{Account: server.URL + "/rss"})
+		assert.NoError(t, err)
+		posts := response.Posts
+		assert.Equal(t, []source.Post{
+			{
+				ID:        "moon-1",
+				Text:      "Moon made of cheese\nScientists confirm it",
+				CreatedAt: time.Date(2023, 1, 2, 10, 0, 0, 0, time.UTC),
+				URL:       "https://news.example/moon",
+				Author:    "Jane Doe",
+			},
+			{
+				ID:        "https://news.example/older",
+				Text:      "Older story\nSomething happened",
+				CreatedAt: time.Date(2023, 1, 1, 10, 0, 0, 0, time.UTC),
+				URL:       "https://news.example/older",
+			},
+		}, normalized(posts))
+		assert.False(t, response.Truncated)
+	})
+
+	t.Run("parses atom feeds", func(t *testing.T) {
+		response, err := client.FetchPosts(context.Background(), log, source.FetchPostsRequest{Account: server.URL + "/atom"})
+		assert.NoError(t, err)
+		posts := response.Posts
+		assert.Len(t, posts, 1)
+		assert.Equal(t, "tag:blog.example,2023:1", posts[0].ID)
+		assert.Equal(t, "Vaccines contain chips\nRead this", posts[0].Text)
+		assert.Equal(t, "https://blog.example/1", posts[0].URL)
+		assert.Equal(t, "John", posts[0].Author)
+	})
+
+	t.Run("fetches entries since time", func(t *testing.T) {
+		response, err := client.FetchPosts(context.Background(), log, source.FetchPostsRequest{
+			Account:   server.URL + "/rss",
+			SinceTime: time.Date(2023, 1, 1, 10, 0, 0, 0, time.UTC),
+			// ignored in favour of SinceTime
+			StartTime: time.Date(2023, 1, 3, 0, 0, 0, 0, time.UTC),
+		})
+		assert.NoError(t, err)
+		posts := response.Posts
+		assert.Len(t, posts, 1)
+		assert.Equal(t, "moon-1", posts[0].ID)
+	})
+
+	t.Run("fetches entries in the time window", func(t *testing.T) {
+		response, err := client.FetchPosts(context.Background(), log, source.FetchPostsRequest{
+			Account:   server.URL + "/rss",
+			StartTime: time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC),
+			EndTime:   time.Date(2023, 1, 2, 0, 0, 0, 0, time.UTC),
+		})
+		assert.NoError(t, err)
+		posts := response.Posts
+		assert.Len(t, posts, 1)
+		assert.Equal(t, "https://news.example/older", posts[0].ID)
+	})
+
+	t.Run("reports throttling", func(t *testing.T) {
+		_, err := client.FetchPosts(context.Background(), log, source.FetchPostsRequest{Account: server.URL + "/throttled"})
+		var rateLimited *source.RateLimitedError
+		assert.True(t, errors.As(err, &rateLimited))
+		assert.True(t, rateLimited.Reset.After(time.Now().Add(30*time.Second)))
+	})
+
+	t.Run("reports missing feeds", func(t *testing.T) {
+		_, err := client.FetchPosts(context.Background(), log, source.FetchPostsRequest{Account: server.URL + "/gone"})
+		assert.True(t, errors.Is(err, source.ErrNotFound))
+	})
+}
+
+// normalized converts post times to UTC so they compare regardless of the zone they were parsed in.
+func normalized(posts []source.Post) []source.Post {
+	for i := range posts {
+		posts[i].CreatedAt = posts[i].CreatedAt.UTC()
+	}
+
+	return posts
+}
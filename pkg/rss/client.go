@@ -0,0 +1,41 @@
+package rss
+
+import (
+	"net/http"
+
+	"github.com/kordape/ottct-poller-service/pkg/retry"
+	"github.com/kordape/ottct-poller-service/pkg/source"
+)
+
+// Make sure Client implement PostsFetcher interface
+var _ source.PostsFetcher = &Client{}
+
+// Client fetches entries of RSS 2.0 and Atom feeds, accounts are feed URLs.
+type Client struct {
+	httpClient  *http.Client
+	retryPolicy retry.Policy
+}
+
+type Option func(c *Client)
+
+// WithRetryPolicy sets the policy failed requests are retried with.
+func WithRetryPolicy(policy retry.Policy) Option {
+	return func(c *Client) {
+		c.retryPolicy = policy
+	}
+}
+
+func New(client *http.Client, opts ...Option) *Client {
+	c := &Client{
+		httpClient:  client,
+		retryPolicy: retry.DefaultPolicy(),
+	}
+
+	for _, opt := range opts {
+		opt(c)
+	}
+
+	c.retryPolicy = c.retryPolicy.ExceptStatus(http.StatusTooManyRequests)
+
+	return c
+}
@@ -0,0 +1,82 @@
+// Package source abstracts social sources other than Twitter, e.g. Mastodon or RSS feeds, so their posts
+// go through the same classification pipeline as tweets.
+package source
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"html"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/kordape/ottct-poller-service/pkg/logger"
+)
+
+//go:generate mockery --inpackage --case snake --disable-version-string --name "PostsFetcher"
+type PostsFetcher interface {
+	// FetchPosts returns posts of the account newer than the request asks for.
+	FetchPosts(context.Context, logger.Interface, FetchPostsRequest) (FetchPostsResponse, error)
+}
+
+type FetchPostsRequest struct {
+	// Account identifies the account on the source, e.g. a Mastodon handle or a feed URL
+	Account   string
+	StartTime time.Time
+	EndTime   time.Time
+	// SinceID fetches only posts newer than the given post, for sources with ordered post IDs
+	SinceID string
+	// SinceTime fetches only posts published after the given time, for sources without ordered post IDs.
+	// Either of SinceID and SinceTime takes precedence over the time window.
+	SinceTime time.Time
+	// UntilID fetches only posts older than the given post, used to catch up on a truncated job
+	UntilID string
+	// MaxPages limits how many pages are fetched, 0 means all of them
+	MaxPages int
+}
+
+type FetchPostsResponse struct {
+	// Posts come newest first
+	Posts []Post
+	// Truncated is set when fetching stopped at MaxPages before all posts were fetched. The missing posts
+	// are older than the oldest one returned.
+	Truncated bool
+}
+
+type Post struct {
+	ID        string
+	Text      string
+	CreatedAt time.Time
+	URL       string
+	AuthorID  string
+	// Author is the display name or handle of the author, if the source has one
+	Author string
+	Lang   string
+}
+
+// ErrNotFound is returned when the account doesn't exist on the source anymore, e.g. a removed feed.
+var ErrNotFound = errors.New("account not found")
+
+// RateLimitedError is returned when the source throttled requests. Requests can be made again after Reset.
+type RateLimitedError struct {
+	Source string
+	Reset  time.Time
+}
+
+func (e *RateLimitedError) Error() string {
+	return fmt.Sprintf("rate limit of %s exceeded, resets at %s", e.Source, e.Reset.Format(time.RFC3339))
+}
+
+var (
+	tags       = regexp.MustCompile(`<[^>]*>`)
+	lineBreaks = regexp.MustCompile(`(?i)<br\s*/?>|</p>`)
+)
+
+// PlainText strips HTML markup, e.g. of Mastodon statuses or feed descriptions, so only the text is classified.
+func PlainText(s string) string {
+	s = lineBreaks.ReplaceAllString(s, "\n")
+	s = tags.ReplaceAllString(s, "")
+
+	return strings.TrimSpace(html.UnescapeString(s))
+}
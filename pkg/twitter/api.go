@@ -13,18 +13,20 @@ import (
 )
 
 const (
-	getUsersTweetsUrl = "https://api.twitter.com/2/users/%s/tweets/"
+	getUsersTweetsPath     = "/2/users/%s/tweets/"
+	getUsersTweetsEndpoint = "GET /2/users/:id/tweets"
+	getTweetsPath          = "/2/tweets"
+	getTweetsEndpoint      = "GET /2/tweets"
+
+	// maxTweetsPerLookup is how many tweets a single lookup request accepts
+	maxTweetsPerLookup = 100
 )
 
 type getUserTweetsResponse struct {
-	Data []tweet  `json:"data"`
-	Meta metadata `json:"meta"`
-}
-
-type tweet struct {
-	CreatedAt time.Time `json:"created_at"`
-	ID        string    `json:"id"`
-	Text      string    `json:"text"`
+	Data     []tweet   `json:"data"`
+	Includes includes  `json:"includes"`
+	Meta     metadata  `json:"meta"`
+	Errors   []problem `json:"errors"`
 }
 
 // metadata left to enable pagination option in perspective
@@ -35,56 +37,130 @@ type metadata struct {
 	PreviousToken string `json:"previous_token"`
 }
 
+// FetchTweets returns a *PartialError along with the tweets when Twitter reported errors for some of them.
 func (client *Client) FetchTweets(ctx context.Context, log logger.Interface, ftr FetchTweetsRequest) (FetchTweetsResponse, error) {
-	resp, err := client.invokeFetchTweets(ctx, log, ftr.EntityID, ftr.MaxResults, ftr.StartTime, ftr.EndTime, "")
+	resp, err := client.invokeFetchTweets(ctx, log, ftr, "")
 	if err != nil {
-		return nil, fmt.Errorf("error invoking twitter api: %w", err)
+		return FetchTweetsResponse{}, fmt.Errorf("error invoking twitter api: %w", err)
 	}
 
-	result := []Tweet{}
-	for _, tweet := range resp.Data {
-		result = append(result, Tweet{
-			ID:        tweet.ID,
-			Text:      tweet.Text,
-			CreatedAt: tweet.CreatedAt,
-		})
+	// errors without any data mean the timeline itself is unavailable, e.g. the user is suspended
+	if len(resp.Errors) > 0 && len(resp.Data) == 0 {
+		return FetchTweetsResponse{}, fmt.Errorf("error invoking twitter api: %w", resp.Errors[0].toAPIError(http.StatusOK))
 	}
 
+	result := FetchTweetsResponse{
+		Tweets: toTweets(resp.Data, resp.Includes),
+	}
+	errs := partialErrors(resp.Errors)
+
+	// a broken API returning the same token over and over would otherwise be paginated forever
+	seenTokens := map[string]bool{}
 	nextPageToken := resp.Meta.NextToken
-	for {
+	for pages := 1; ; pages++ {
 		if nextPageToken == "" {
 			// reached end of results
 			break
 		}
 
-		resp, err := client.invokeFetchTweets(ctx, log, ftr.EntityID, ftr.MaxResults, ftr.StartTime, ftr.EndTime, nextPageToken)
+		if ftr.MaxPages > 0 && pages >= ftr.MaxPages {
+			log.Info(fmt.Sprintf("Reached max pages limit (%d) for entity %s", ftr.MaxPages, ftr.EntityID))
+			result.Truncated = true
+			break
+		}
+
+		if ftr.MaxTweets > 0 && len(result.Tweets) >= ftr.MaxTweets {
+			log.Info(fmt.Sprintf("Reached max tweets limit (%d) for entity %s", ftr.MaxTweets, ftr.EntityID))
+			result.Truncated = true
+			break
+		}
+
+		if seenTokens[nextPageToken] {
+			log.Warn(fmt.Sprintf("Twitter API returned pagination token %s repeatedly for entity %s, stopping", nextPageToken, ftr.EntityID))
+			result.Truncated = true
+			break
+		}
+		seenTokens[nextPageToken] = true
+
+		resp, err := client.invokeFetchTweets(ctx, log, ftr, nextPageToken)
 		if err != nil {
-			return nil, fmt.Errorf("error invoking twitter api: %w", err)
+			return FetchTweetsResponse{}, fmt.Errorf("error invoking twitter api: %w", err)
 		}
 
 		nextPageToken = resp.Meta.NextToken
+		result.Tweets = append(result.Tweets, toTweets(resp.Data, resp.Includes)...)
+		errs = append(errs, partialErrors(resp.Errors)...)
+	}
+
+	if ftr.MaxTweets > 0 && len(result.Tweets) > ftr.MaxTweets {
+		result.Tweets = result.Tweets[:ftr.MaxTweets]
+		result.Truncated = true
+	}
+
+	log.Info(fmt.Sprintf("Received response from Twitter API with %d tweets", len(result.Tweets)))
+
+	if len(errs) > 0 {
+		return result, &PartialError{Errors: errs}
+	}
+
+	return result, nil
+}
 
-		for _, tweet := range resp.Data {
-			result = append(result, Tweet{
-				ID:        tweet.ID,
-				Text:      tweet.Text,
-				CreatedAt: tweet.CreatedAt,
-			})
+func (c *Client) LookupTweets(ctx context.Context, log logger.Interface, ids []string) ([]Tweet, error) {
+	result := []Tweet{}
+	for start := 0; start < len(ids); start += maxTweetsPerLookup {
+		end := start + maxTweetsPerLookup
+		if end > len(ids) {
+			end = len(ids)
+		}
+
+		query := c.tweetFields.query()
+		query.Set("ids", strings.Join(ids[start:end], ","))
+		request, err := http.NewRequestWithContext(ctx, http.MethodGet, fmt.Sprintf("%s?%s", c.url(getTweetsPath), query.Encode()), nil)
+		if err != nil {
+			return nil, fmt.Errorf("error creating request: %w", err)
+		}
+
+		body, err := c.doRequest(ctx, getTweetsEndpoint, request)
+		if err != nil {
+			return nil, fmt.Errorf("error invoking twitter api: %w", err)
+		}
+
+		var response getUserTweetsResponse
+		if err := json.Unmarshal(body, &response); err != nil {
+			return nil, fmt.Errorf("error unmarshalling response: %w", err)
 		}
+
+		result = append(result, toTweets(response.Data, response.Includes)...)
 	}
 
-	log.Info(fmt.Sprintf("Received response from Twitter API with %d tweets", len(result)))
+	log.Info(fmt.Sprintf("Looked up %d of %d tweets", len(result), len(ids)))
 
 	return result, nil
 }
 
-func (c *Client) invokeFetchTweets(ctx context.Context, log logger.Interface, entityID string, maxResults int, start, end time.Time, paginationToken string) (getUserTweetsResponse, error) {
-	baseUrl := fmt.Sprintf(getUsersTweetsUrl, entityID)
+func (c *Client) invokeFetchTweets(ctx context.Context, log logger.Interface, ftr FetchTweetsRequest, paginationToken string) (getUserTweetsResponse, error) {
+	baseUrl := c.url(fmt.Sprintf(getUsersTweetsPath, ftr.EntityID))
 	queryParams := []string{
-		fmt.Sprintf("max_results=%d", maxResults),
-		"tweet.fields=id,text,created_at",
-		fmt.Sprintf("start_time=%s", start.Format(time.RFC3339)),
-		fmt.Sprintf("end_time=%s", end.Format(time.RFC3339)),
+		fmt.Sprintf("max_results=%d", ftr.MaxResults),
+		c.tweetFields.query().Encode(),
+	}
+
+	if ftr.SinceID != "" {
+		queryParams = append(queryParams, fmt.Sprintf("since_id=%s", ftr.SinceID))
+	} else {
+		queryParams = append(queryParams,
+			fmt.Sprintf("start_time=%s", ftr.StartTime.Format(time.RFC3339)),
+			fmt.Sprintf("end_time=%s", ftr.EndTime.Format(time.RFC3339)),
+		)
+	}
+
+	if ftr.UntilID != "" {
+		queryParams = append(queryParams, fmt.Sprintf("until_id=%s", ftr.UntilID))
+	}
+
+	if len(ftr.Exclude) > 0 {
+		queryParams = append(queryParams, fmt.Sprintf("exclude=%s", strings.Join(ftr.Exclude, ",")))
 	}
 
 	if paginationToken != "" {
@@ -96,24 +172,25 @@ func (c *Client) invokeFetchTweets(ctx context.Context, log logger.Interface, en
 	if err != nil {
 		return getUserTweetsResponse{}, fmt.Errorf("error creating request: %w", err)
 	}
-	request.Header.Add("Authorization", fmt.Sprintf("Bearer %s", c.bearerToken))
 	log.Info(fmt.Sprintf("Calling Twitter API with: %s", url))
-	resp, err := c.httpClient.Do(request)
+	resp, err := c.send(ctx, getUsersTweetsEndpoint, request, func(r *http.Request) (*http.Response, error) {
+		return c.retryPolicy.Do(ctx, c.httpClient, r)
+	})
 	if err != nil {
-		return getUserTweetsResponse{}, fmt.Errorf("error doing request: %w", err)
+		return getUserTweetsResponse{}, err
 	}
 
 	defer resp.Body.Close()
 
-	if resp.StatusCode != http.StatusOK {
-		return getUserTweetsResponse{}, fmt.Errorf("request failed with: %d", resp.StatusCode)
-	}
-
 	response, err := io.ReadAll(resp.Body)
 	if err != nil {
 		return getUserTweetsResponse{}, fmt.Errorf("error reading response: %w", err)
 	}
 
+	if resp.StatusCode != http.StatusOK {
+		return getUserTweetsResponse{}, parseErrorResponse(resp.StatusCode, response)
+	}
+
 	var twitterResponse getUserTweetsResponse
 	err = json.Unmarshal(response, &twitterResponse)
 	if err != nil {
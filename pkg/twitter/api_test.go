@@ -3,12 +3,16 @@ package twitter
 import (
 	"bytes"
 	"context"
+	"fmt"
 	"io"
 	"net/http"
+	"net/http/httptest"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/kordape/ottct-poller-service/pkg/logger"
+	"github.com/kordape/ottct-poller-service/pkg/retry"
 	"github.com/kordape/ottct-poller-service/pkg/twitter/mocks"
 	"github.com/stretchr/testify/assert"
 )
@@ -51,7 +55,7 @@ func TestFetchTweets(t *testing.T) {
 		resp, err := api.FetchTweets(context.Background(), logger.New("DEBUG"), FetchTweetsRequest{})
 
 		assert.NoError(t, err)
-		assert.NotEmpty(t, resp)
+		assert.NotEmpty(t, resp.Tweets)
 	})
 
 	t.Run("fail", func(t *testing.T) {
@@ -67,6 +71,335 @@ func TestFetchTweets(t *testing.T) {
 		resp, err := api.FetchTweets(context.Background(), logger.New("DEBUG"), FetchTweetsRequest{})
 
 		assert.Error(t, err)
-		assert.Empty(t, resp)
+		assert.Empty(t, resp.Tweets)
 	})
 }
+
+func TestFetchTweetsMaxPages(t *testing.T) {
+	count := 0
+	client := newHTTPCli(func(r *http.Request) (*http.Response, error) {
+		count++
+		// every page points to the next one
+		body := strings.Replace(mocks.SuccessFirstPageResponse, "7140dibdnow9c7btw451l95tiwqg2219lao49o0ke99h2", fmt.Sprintf("page%d", count), 1)
+		return &http.Response{
+			StatusCode: http.StatusOK,
+			Body:       io.NopCloser(bytes.NewBufferString(body)),
+		}, nil
+	})
+
+	api := New(client, "futile")
+
+	resp, err := api.FetchTweets(context.Background(), logger.New("DEBUG"), FetchTweetsRequest{MaxPages: 3})
+
+	assert.NoError(t, err)
+	assert.Equal(t, 3, count)
+	assert.Equal(t, 21, len(resp.Tweets))
+	assert.True(t, resp.Truncated)
+}
+
+func TestFetchTweetsTruncation(t *testing.T) {
+	t.Run("max tweets", func(t *testing.T) {
+		count := 0
+		client := newHTTPCli(func(r *http.Request) (*http.Response, error) {
+			count++
+			body := strings.Replace(mocks.SuccessFirstPageResponse, "7140dibdnow9c7btw451l95tiwqg2219lao49o0ke99h2", fmt.Sprintf("page%d", count), 1)
+			return &http.Response{
+				StatusCode: http.StatusOK,
+				Body:       io.NopCloser(bytes.NewBufferString(body)),
+			}, nil
+		})
+
+		api := New(client, "futile")
+
+		resp, err := api.FetchTweets(context.Background(), logger.New("DEBUG"), FetchTweetsRequest{MaxTweets: 10})
+
+		assert.NoError(t, err)
+		assert.Equal(t, 2, count)
+		assert.Equal(t, 10, len(resp.Tweets))
+		assert.True(t, resp.Truncated)
+	})
+
+	t.Run("repeated pagination token", func(t *testing.T) {
+		count := 0
+		client := newHTTPCli(func(r *http.Request) (*http.Response, error) {
+			count++
+			return &http.Response{
+				StatusCode: http.StatusOK,
+				Body:       io.NopCloser(bytes.NewBufferString(mocks.SuccessFirstPageResponse)),
+			}, nil
+		})
+
+		api := New(client, "futile")
+
+		resp, err := api.FetchTweets(context.Background(), logger.New("DEBUG"), FetchTweetsRequest{})
+
+		assert.NoError(t, err)
+		assert.Equal(t, 2, count)
+		assert.True(t, resp.Truncated)
+	})
+
+	t.Run("all pages", func(t *testing.T) {
+		client := newHTTPCli(func(r *http.Request) (*http.Response, error) {
+			return &http.Response{
+				StatusCode: http.StatusOK,
+				Body:       io.NopCloser(bytes.NewBufferString(mocks.SuccessResponse)),
+			}, nil
+		})
+
+		api := New(client, "futile")
+
+		resp, err := api.FetchTweets(context.Background(), logger.New("DEBUG"), FetchTweetsRequest{MaxPages: 1, UntilID: "5"})
+
+		assert.NoError(t, err)
+		assert.False(t, resp.Truncated)
+	})
+}
+
+func TestFetchTweetsRateLimit(t *testing.T) {
+
+	t.Run("rate limited response", func(t *testing.T) {
+		count := 0
+		reset := time.Now().Add(time.Hour).Unix()
+		client := newHTTPCli(func(r *http.Request) (*http.Response, error) {
+			count++
+			return &http.Response{
+				StatusCode: http.StatusTooManyRequests,
+				Header: http.Header{
+					"X-Rate-Limit-Remaining": []string{"0"},
+					"X-Rate-Limit-Reset":     []string{fmt.Sprintf("%d", reset)},
+				},
+				Body: io.NopCloser(bytes.NewBufferString(mocks.FailResponse)),
+			}, nil
+		})
+
+		api := New(client, "futile")
+
+		_, err := api.FetchTweets(context.Background(), logger.New("DEBUG"), FetchTweetsRequest{})
+		var rateLimitedErr *RateLimitedError
+		assert.ErrorAs(t, err, &rateLimitedErr)
+		assert.Equal(t, reset, rateLimitedErr.Reset.Unix())
+
+		// exhausted budget fails fast without calling the API
+		_, err = api.FetchTweets(context.Background(), logger.New("DEBUG"), FetchTweetsRequest{})
+		assert.ErrorAs(t, err, &rateLimitedErr)
+		assert.Equal(t, 1, count)
+	})
+
+	t.Run("waits for reset within max wait", func(t *testing.T) {
+		count := 0
+		client := newHTTPCli(func(r *http.Request) (*http.Response, error) {
+			count++
+			return &http.Response{
+				StatusCode: http.StatusOK,
+				Header: http.Header{
+					"X-Rate-Limit-Remaining": []string{"0"},
+					"X-Rate-Limit-Reset":     []string{fmt.Sprintf("%d", time.Now().Add(time.Second).Unix())},
+				},
+				Body: io.NopCloser(bytes.NewBufferString(mocks.SuccessResponse)),
+			}, nil
+		})
+
+		api := New(client, "futile", WithMaxRateLimitWait(3*time.Second))
+
+		_, err := api.FetchTweets(context.Background(), logger.New("DEBUG"), FetchTweetsRequest{})
+		assert.NoError(t, err)
+
+		_, err = api.FetchTweets(context.Background(), logger.New("DEBUG"), FetchTweetsRequest{})
+		assert.NoError(t, err)
+		assert.Equal(t, 2, count)
+	})
+
+	t.Run("budget is tracked per token", func(t *testing.T) {
+		limiter := newRateLimiter()
+		limiter.update(rateLimitKey(getUsersTweetsEndpoint, "token1"), &http.Response{
+			StatusCode: http.StatusTooManyRequests,
+			Header:     http.Header{},
+		})
+
+		assert.False(t, limiter.resetTime(rateLimitKey(getUsersTweetsEndpoint, "token1")).IsZero())
+		assert.True(t, limiter.resetTime(rateLimitKey(getUsersTweetsEndpoint, "token2")).IsZero())
+	})
+}
+
+func TestFetchTweetsRetry(t *testing.T) {
+	count := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		count++
+		if count == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte(mocks.SuccessResponse))
+	}))
+	defer server.Close()
+
+	api := New(server.Client(), "futile", WithBaseURL(server.URL), WithRetryPolicy(retry.Policy{
+		MaxAttempts:    2,
+		InitialBackoff: time.Millisecond,
+		MaxBackoff:     time.Millisecond,
+		Retryable:      retry.TransientErrors,
+	}))
+
+	resp, err := api.FetchTweets(context.Background(), logger.New("DEBUG"), FetchTweetsRequest{})
+
+	assert.NoError(t, err)
+	assert.NotEmpty(t, resp.Tweets)
+	assert.Equal(t, 2, count)
+}
+
+func TestFetchTweetsSinceID(t *testing.T) {
+
+	t.Run("since id replaces time window", func(t *testing.T) {
+		client := newHTTPCli(func(r *http.Request) (*http.Response, error) {
+			query := r.URL.Query()
+			assert.Equal(t, "1636746669139320833", query.Get("since_id"))
+			assert.Empty(t, query.Get("start_time"))
+			assert.Empty(t, query.Get("end_time"))
+
+			return &http.Response{
+				StatusCode: http.StatusOK,
+				Body:       io.NopCloser(bytes.NewBufferString(mocks.SuccessResponse)),
+			}, nil
+		})
+
+		api := New(client, "futile")
+
+		_, err := api.FetchTweets(context.Background(), logger.New("DEBUG"), FetchTweetsRequest{SinceID: "1636746669139320833"})
+		assert.NoError(t, err)
+	})
+
+	t.Run("time window on first poll", func(t *testing.T) {
+		now := time.Now()
+		client := newHTTPCli(func(r *http.Request) (*http.Response, error) {
+			query := r.URL.Query()
+			assert.Empty(t, query.Get("since_id"))
+			assert.Equal(t, now.Format(time.RFC3339), query.Get("start_time"))
+			assert.Equal(t, now.Format(time.RFC3339), query.Get("end_time"))
+
+			return &http.Response{
+				StatusCode: http.StatusOK,
+				Body:       io.NopCloser(bytes.NewBufferString(mocks.SuccessResponse)),
+			}, nil
+		})
+
+		api := New(client, "futile")
+
+		_, err := api.FetchTweets(context.Background(), logger.New("DEBUG"), FetchTweetsRequest{StartTime: now, EndTime: now})
+		assert.NoError(t, err)
+	})
+}
+
+func TestFetchTweetsFields(t *testing.T) {
+	response := `{
+		"data": [{
+			"id": "2",
+			"text": "Look https://t.co/x",
+			"created_at": "2023-03-17T15:09:49.000Z",
+			"author_id": "42",
+			"conversation_id": "1",
+			"lang": "en",
+			"public_metrics": {"retweet_count": 1, "reply_count": 2, "like_count": 3, "quote_count": 4},
+			"referenced_tweets": [{"type": "replied_to", "id": "1"}],
+			"entities": {"urls": [{"url": "https://t.co/x", "expanded_url": "https://example.com", "display_url": "example.com"}]},
+			"attachments": {"media_keys": ["3_1"]}
+		}],
+		"includes": {
+			"users": [{"id": "42", "username": "foo", "name": "Foo"}],
+			"media": [{"media_key": "3_1", "type": "photo", "url": "https://pbs.twimg.com/1.jpg"}]
+		}
+	}`
+
+	t.Run("parses requested fields and expansions", func(t *testing.T) {
+		client := newHTTPCli(func(r *http.Request) (*http.Response, error) {
+			query := r.URL.Query()
+			assert.Equal(t, "id,text,created_at,author_id,referenced_tweets,lang,public_metrics,entities,attachments,conversation_id", query.Get("tweet.fields"))
+			assert.Equal(t, "author_id,attachments.media_keys", query.Get("expansions"))
+
+			return &http.Response{
+				StatusCode: http.StatusOK,
+				Body:       io.NopCloser(bytes.NewBufferString(response)),
+			}, nil
+		})
+
+		api := New(client, "futile")
+
+		resp, err := api.FetchTweets(context.Background(), logger.New("DEBUG"), FetchTweetsRequest{SinceID: "1"})
+		assert.NoError(t, err)
+		assert.Equal(t, 1, len(resp.Tweets))
+
+		tweet := resp.Tweets[0]
+		assert.Equal(t, "42", tweet.AuthorID)
+		assert.Equal(t, &User{ID: "42", Username: "foo", Name: "Foo"}, tweet.Author)
+		assert.Equal(t, "en", tweet.Lang)
+		assert.Equal(t, "1", tweet.ConversationID)
+		assert.Equal(t, &PublicMetrics{RetweetCount: 1, ReplyCount: 2, LikeCount: 3, QuoteCount: 4}, tweet.PublicMetrics)
+		assert.Equal(t, []ReferencedTweet{{Type: "replied_to", ID: "1"}}, tweet.ReferencedTweets)
+		assert.Equal(t, []TweetURL{{URL: "https://t.co/x", ExpandedURL: "https://example.com", DisplayURL: "example.com"}}, tweet.URLs)
+		assert.Equal(t, []Media{{MediaKey: "3_1", Type: "photo", URL: "https://pbs.twimg.com/1.jpg"}}, tweet.Media)
+		assert.Equal(t, "https://twitter.com/foo/status/2", tweet.URL())
+	})
+
+	t.Run("required fields are always requested", func(t *testing.T) {
+		client := newHTTPCli(func(r *http.Request) (*http.Response, error) {
+			query := r.URL.Query()
+			assert.Equal(t, "id,text,created_at,author_id,referenced_tweets,lang", query.Get("tweet.fields"))
+			assert.Empty(t, query.Get("expansions"))
+
+			return &http.Response{
+				StatusCode: http.StatusOK,
+				Body:       io.NopCloser(bytes.NewBufferString(`{"data": [{"id": "2", "text": "Tweet", "author_id": "42", "lang": "en"}]}`)),
+			}, nil
+		})
+
+		api := New(client, "futile", WithTweetFields(TweetFields{TweetFields: []string{"lang", "id"}}))
+
+		resp, err := api.FetchTweets(context.Background(), logger.New("DEBUG"), FetchTweetsRequest{SinceID: "1"})
+		assert.NoError(t, err)
+		assert.Nil(t, resp.Tweets[0].Author)
+		assert.Equal(t, "https://twitter.com/i/web/status/2", resp.Tweets[0].URL())
+	})
+}
+
+func TestFetchTweetsExclude(t *testing.T) {
+	client := newHTTPCli(func(r *http.Request) (*http.Response, error) {
+		assert.Equal(t, "retweets,replies", r.URL.Query().Get("exclude"))
+
+		return &http.Response{
+			StatusCode: http.StatusOK,
+			Body:       io.NopCloser(bytes.NewBufferString(mocks.SuccessResponse)),
+		}, nil
+	})
+
+	api := New(client, "futile")
+
+	_, err := api.FetchTweets(context.Background(), logger.New("DEBUG"), FetchTweetsRequest{
+		SinceID: "1",
+		Exclude: []string{ExcludeRetweets, ExcludeReplies},
+	})
+	assert.NoError(t, err)
+
+	err = FetchTweetsRequest{MaxResults: FetchTweetsMinResults, Exclude: []string{"quotes"}}.Validate()
+	assert.Error(t, err)
+}
+
+func TestLookupTweets(t *testing.T) {
+	client := newHTTPCli(func(r *http.Request) (*http.Response, error) {
+		assert.Equal(t, "/2/tweets", r.URL.Path)
+		assert.Equal(t, "1,2", r.URL.Query().Get("ids"))
+
+		return &http.Response{
+			StatusCode: http.StatusOK,
+			Body: io.NopCloser(bytes.NewBufferString(`{
+				"data": [{"id": "1", "text": "Original", "author_id": "42"}],
+				"errors": [{"value": "2", "title": "Not Found Error"}]
+			}`)),
+		}, nil
+	})
+
+	api := New(client, "futile")
+
+	tweets, err := api.LookupTweets(context.Background(), logger.New("DEBUG"), []string{"1", "2"})
+	assert.NoError(t, err)
+	assert.Equal(t, []Tweet{{ID: "1", Text: "Original", AuthorID: "42"}}, tweets)
+}
@@ -4,19 +4,51 @@ import (
 	"context"
 	"fmt"
 	"net/http"
+	"strings"
 	"time"
 
 	"github.com/kordape/ottct-poller-service/pkg/logger"
+	"github.com/kordape/ottct-poller-service/pkg/retry"
 )
 
 const (
-	fetchTweetsMinResults = 5
-	fetchTweetsMaxResults = 100
+	ExcludeRetweets = "retweets"
+	ExcludeReplies  = "replies"
+)
+
+// FetchTweetsMinResults and FetchTweetsMaxResults bound how many tweets a page of a timeline holds.
+const (
+	FetchTweetsMinResults = 5
+	FetchTweetsMaxResults = 100
+)
+
+const (
+	defaultMaxRateLimitWait = 5 * time.Second
+
+	defaultBaseURL = "https://api.twitter.com"
 )
 
 //go:generate mockery --inpackage --case snake --disable-version-string --name "TweetsFetcher"
 type TweetsFetcher interface {
 	FetchTweets(context.Context, logger.Interface, FetchTweetsRequest) (FetchTweetsResponse, error)
+	// LookupTweets returns the tweets with the given IDs, tweets that can't be returned are left out.
+	LookupTweets(ctx context.Context, log logger.Interface, ids []string) ([]Tweet, error)
+}
+
+//go:generate mockery --inpackage --case snake --disable-version-string --name "TweetsStreamer"
+type TweetsStreamer interface {
+	// SyncStreamRules makes the filtered stream rules tagged with tag match rules exactly.
+	SyncStreamRules(ctx context.Context, log logger.Interface, tag string, rules []StreamRule) error
+	// Stream consumes the filtered stream until ctx is done, reconnecting whenever the connection drops.
+	Stream(ctx context.Context, log logger.Interface, handler StreamHandler) error
+}
+
+//go:generate mockery --inpackage --case snake --disable-version-string --name "UserResolver"
+type UserResolver interface {
+	// LookupUsernames resolves usernames (handles without the @) to users.
+	LookupUsernames(ctx context.Context, log logger.Interface, usernames []string) (UsersLookupResponse, error)
+	// LookupUserIDs looks users up by ID, e.g. to notice renamed or suspended accounts.
+	LookupUserIDs(ctx context.Context, log logger.Interface, ids []string) (UsersLookupResponse, error)
 }
 
 type FetchTweetsRequest struct {
@@ -24,39 +56,187 @@ type FetchTweetsRequest struct {
 	EntityID   string
 	StartTime  time.Time
 	EndTime    time.Time
+	// MaxPages limits how many pages are fetched, 0 means all of them
+	MaxPages int
+	// MaxTweets limits how many tweets are returned, 0 means all of them
+	MaxTweets int
+	// SinceID fetches only tweets newer than the given tweet, StartTime and EndTime are ignored then.
+	// Preferred over time windows as it doesn't depend on clocks being in sync with Twitter.
+	SinceID string
+	// UntilID fetches only tweets older than the given tweet, e.g. to catch up on a truncated fetch
+	UntilID string
+	// Exclude leaves out tweets of the given types, see ExcludeRetweets and ExcludeReplies
+	Exclude []string
 }
 
-type FetchTweetsResponse []Tweet
+type FetchTweetsResponse struct {
+	// Tweets come newest first
+	Tweets []Tweet
+	// Truncated is set when fetching stopped at MaxPages or MaxTweets, or because the API kept returning
+	// the same page, before all tweets were fetched. The missing tweets are older than the oldest one returned.
+	Truncated bool
+}
 
 type Tweet struct {
-	ID        string
-	Text      string
-	CreatedAt time.Time
+	ID             string
+	Text           string
+	CreatedAt      time.Time
+	AuthorID       string
+	ConversationID string
+	Lang           string
+
+	// Optional data, only set when requested with TweetFields
+	Author           *User
+	PublicMetrics    *PublicMetrics
+	ReferencedTweets []ReferencedTweet
+	URLs             []TweetURL
+	Media            []Media
+}
+
+type StreamRule struct {
+	ID    string
+	Value string
+	Tag   string
 }
 
-// Make sure Client implement TweetsFetcher interface
+type StreamedTweet struct {
+	Tweet
+	// MatchingRules are IDs of the stream rules the tweet matched
+	MatchingRules []string
+}
+
+type StreamHandler func(StreamedTweet)
+
+type User struct {
+	ID       string
+	Username string
+	Name     string
+}
+
+type AccountState string
+
+const (
+	AccountSuspended AccountState = "suspended"
+	AccountNotFound  AccountState = "not_found"
+)
+
+type UsersLookupResponse struct {
+	Users []User
+	// Unavailable holds the looked up values Twitter couldn't return a user for
+	Unavailable map[string]AccountState
+}
+
+// Make sure Client implement TweetsFetcher, TweetsStreamer and UserResolver interfaces
 var _ TweetsFetcher = &Client{}
+var _ TweetsStreamer = &Client{}
+var _ UserResolver = &Client{}
 
 type Client struct {
 	httpClient  *http.Client
-	bearerToken string
+	baseURL     string
+	credentials *CredentialPool
+
+	rateLimiter      *rateLimiter
+	maxRateLimitWait time.Duration
+	retryPolicy      retry.Policy
+	tweetFields      TweetFields
 }
 
-func New(client *http.Client, bearerToken string) *Client {
-	return &Client{
-		bearerToken: bearerToken,
-		httpClient:  client,
+type Option func(c *Client)
+
+// WithMaxRateLimitWait sets how long a request may wait for an exhausted rate limit to reset.
+// Requests that would have to wait longer fail with RateLimitedError instead.
+func WithMaxRateLimitWait(wait time.Duration) Option {
+	return func(c *Client) {
+		c.maxRateLimitWait = wait
 	}
 }
 
+// WithRetryPolicy sets the policy failed requests are retried with.
+func WithRetryPolicy(policy retry.Policy) Option {
+	return func(c *Client) {
+		c.retryPolicy = policy
+	}
+}
+
+// WithTweetFields sets which optional tweet data is requested with fetched and streamed tweets.
+func WithTweetFields(fields TweetFields) Option {
+	return func(c *Client) {
+		c.tweetFields = fields
+	}
+}
+
+// WithBaseURL points the client to another Twitter API host, e.g. a twittertest fake.
+func WithBaseURL(baseURL string) Option {
+	return func(c *Client) {
+		c.baseURL = strings.TrimSuffix(baseURL, "/")
+	}
+}
+
+// WithCredentialPool makes the client rotate tokens of the pool instead of using a single bearer token.
+func WithCredentialPool(pool *CredentialPool) Option {
+	return func(c *Client) {
+		c.credentials = pool
+	}
+}
+
+func New(client *http.Client, bearerToken string, opts ...Option) *Client {
+	c := &Client{
+		credentials:      newCredentialPool([]string{bearerToken}),
+		httpClient:       client,
+		baseURL:          defaultBaseURL,
+		rateLimiter:      newRateLimiter(),
+		maxRateLimitWait: defaultMaxRateLimitWait,
+		retryPolicy:      retry.DefaultPolicy(),
+		tweetFields:      DefaultTweetFields(),
+	}
+
+	for _, opt := range opts {
+		opt(c)
+	}
+
+	// throttled requests are handled by the rate limit tracking
+	c.retryPolicy = c.retryPolicy.ExceptStatus(http.StatusTooManyRequests)
+
+	return c
+}
+
+// url returns the URL of an API path on the configured host.
+func (c *Client) url(path string) string {
+	return c.baseURL + path
+}
+
+// NewerID reports whether tweet ID a is newer than b. Tweet IDs are snowflakes, so they grow over time.
+func NewerID(a, b string) bool {
+	if len(a) != len(b) {
+		return len(a) > len(b)
+	}
+
+	return a > b
+}
+
 func (request FetchTweetsRequest) Validate() error {
-	if request.MaxResults < fetchTweetsMinResults || request.MaxResults > fetchTweetsMaxResults {
-		return fmt.Errorf("invalid max results parameter - can range from %d to %d", fetchTweetsMinResults, fetchTweetsMaxResults)
+	if request.MaxResults < FetchTweetsMinResults || request.MaxResults > FetchTweetsMaxResults {
+		return fmt.Errorf("invalid max results parameter - can range from %d to %d", FetchTweetsMinResults, FetchTweetsMaxResults)
+	}
+
+	if request.MaxPages < 0 {
+		return fmt.Errorf("invalid max pages parameter - can't be negative")
 	}
 
-	if request.StartTime.After(request.EndTime) {
+	if request.MaxTweets < 0 {
+		return fmt.Errorf("invalid max tweets parameter - can't be negative")
+	}
+
+	if request.SinceID == "" && request.StartTime.After(request.EndTime) {
 		return fmt.Errorf("start time is after end time")
 	}
 
+	for _, e := range request.Exclude {
+		if e != ExcludeRetweets && e != ExcludeReplies {
+			return fmt.Errorf("invalid exclude parameter - %s isn't %s or %s", e, ExcludeRetweets, ExcludeReplies)
+		}
+	}
+
 	return nil
 }
@@ -0,0 +1,274 @@
+package twitter
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// defaultQuarantine is how long a token rejected by Twitter is left out of rotation.
+const defaultQuarantine = time.Hour
+
+// TokenSource provides bearer tokens of a single Twitter app.
+type TokenSource interface {
+	Token(ctx context.Context) (string, error)
+	// Invalidate drops token after Twitter rejected it and reports whether a fresh one can be obtained.
+	Invalidate(token string) bool
+}
+
+// StaticToken is a bearer token that never changes, e.g. one copied from the developer portal.
+type StaticToken string
+
+func (t StaticToken) Token(context.Context) (string, error) {
+	return string(t), nil
+}
+
+func (t StaticToken) Invalidate(string) bool {
+	return false
+}
+
+func (t StaticToken) String() string {
+	return "StaticToken(redacted)"
+}
+
+// CredentialPool rotates bearer tokens, e.g. of several Twitter projects, to multiply the rate limit
+// budget. Tokens rejected by Twitter are quarantined for a while instead of failing every request.
+type CredentialPool struct {
+	mu          sync.Mutex
+	sources     []TokenSource
+	next        int
+	quarantined map[int]time.Time
+	quarantine  time.Duration
+	now         func() time.Time
+}
+
+type CredentialPoolOption func(p *CredentialPool)
+
+// WithQuarantine sets how long rejected tokens are left out of rotation.
+func WithQuarantine(quarantine time.Duration) CredentialPoolOption {
+	return func(p *CredentialPool) {
+		p.quarantine = quarantine
+	}
+}
+
+// WithTokenSources adds sources of tokens obtained at runtime, e.g. ClientCredentials, to the pool.
+func WithTokenSources(sources ...TokenSource) CredentialPoolOption {
+	return func(p *CredentialPool) {
+		p.sources = append(p.sources, sources...)
+	}
+}
+
+func NewCredentialPool(tokens []string, opts ...CredentialPoolOption) (*CredentialPool, error) {
+	p := newCredentialPool(tokens)
+	for _, opt := range opts {
+		opt(p)
+	}
+
+	if len(p.sources) == 0 {
+		return nil, errors.New("credential pool needs at least one token")
+	}
+
+	if p.quarantine <= 0 {
+		return nil, errors.New("quarantine must be positive")
+	}
+
+	return p, nil
+}
+
+func newCredentialPool(tokens []string) *CredentialPool {
+	p := &CredentialPool{
+		quarantined: map[int]time.Time{},
+		quarantine:  defaultQuarantine,
+		now:         time.Now,
+	}
+
+	seen := map[string]bool{}
+	for _, t := range tokens {
+		t = strings.TrimSpace(t)
+		if t == "" || seen[t] {
+			continue
+		}
+		seen[t] = true
+		p.sources = append(p.sources, StaticToken(t))
+	}
+
+	return p
+}
+
+// LoadTokens reads bearer tokens from a file, e.g. a mounted secret, one token per line.
+// Empty lines and lines starting with # are ignored.
+func LoadTokens(path string) ([]string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("error opening tokens file: %w", err)
+	}
+	defer file.Close()
+
+	tokens := []string{}
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		tokens = append(tokens, line)
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("error reading tokens file: %w", err)
+	}
+
+	return tokens, nil
+}
+
+// Size returns how many token sources are in rotation, not counting quarantined ones.
+func (p *CredentialPool) Size() int {
+	return len(p.candidates())
+}
+
+// candidates returns indexes of sources out of quarantine, starting with the next one in rotation.
+func (p *CredentialPool) candidates() []int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	now := p.now()
+	candidates := make([]int, 0, len(p.sources))
+	for i := range p.sources {
+		source := (p.next + i) % len(p.sources)
+		if until, ok := p.quarantined[source]; ok {
+			if until.After(now) {
+				continue
+			}
+			delete(p.quarantined, source)
+		}
+		candidates = append(candidates, source)
+	}
+
+	if len(p.sources) > 0 {
+		p.next = (p.next + 1) % len(p.sources)
+	}
+
+	return candidates
+}
+
+func (p *CredentialPool) quarantineSource(source int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.quarantined[source] = p.now().Add(p.quarantine)
+}
+
+// reject handles a token Twitter refused. Sources that can obtain a fresh token stay in rotation.
+func (p *CredentialPool) reject(source int, token string) {
+	if !p.sources[source].Invalidate(token) {
+		p.quarantineSource(source)
+	}
+}
+
+// credential is a token along with the source it came from.
+type credential struct {
+	source int
+	token  string
+}
+
+// credential picks the next token with rate limit budget left for the endpoint. When the budget of all
+// tokens is exhausted it waits for the earliest reset, like it would for a single token.
+func (c *Client) credential(ctx context.Context, endpoint string) (credential, error) {
+	earliest := credential{source: -1}
+	earliestReset := time.Time{}
+	for _, source := range c.credentials.candidates() {
+		token, err := c.credentials.sources[source].Token(ctx)
+		if err != nil {
+			if ctx.Err() != nil {
+				return credential{}, ctx.Err()
+			}
+			// e.g. the consumer key was revoked
+			c.credentials.quarantineSource(source)
+			continue
+		}
+
+		reset := c.rateLimiter.resetTime(rateLimitKey(endpoint, token))
+		if reset.IsZero() {
+			return credential{source: source, token: token}, nil
+		}
+
+		if earliest.source < 0 || reset.Before(earliestReset) {
+			earliest = credential{source: source, token: token}
+			earliestReset = reset
+		}
+	}
+
+	if earliest.source < 0 {
+		return credential{}, fmt.Errorf("%w: no usable credentials, all of them are quarantined", ErrUnauthorized)
+	}
+
+	if err := c.rateLimiter.wait(ctx, endpoint, rateLimitKey(endpoint, earliest.token), c.maxRateLimitWait); err != nil {
+		return credential{}, err
+	}
+
+	return earliest, nil
+}
+
+// send authorizes the request with a token from the pool and sends it with do. It tracks the rate limit
+// budget of the token and rejects the token if Twitter refuses the token itself, not just access to the
+// requested resource. A throttled request is sent again
+// with the next token, it's reported as RateLimitedError only once every token is throttled.
+func (c *Client) send(ctx context.Context, endpoint string, request *http.Request, do func(*http.Request) (*http.Response, error)) (*http.Response, error) {
+	var reset time.Time
+	for attempt := 0; ; attempt++ {
+		if attempt > 0 && request.Body != nil {
+			if request.GetBody == nil {
+				return nil, &RateLimitedError{Endpoint: endpoint, Reset: reset}
+			}
+
+			body, err := request.GetBody()
+			if err != nil {
+				return nil, fmt.Errorf("error replaying request body: %w", err)
+			}
+			request.Body = body
+		}
+
+		cred, err := c.credential(ctx, endpoint)
+		if err != nil {
+			return nil, err
+		}
+
+		request.Header.Set("Authorization", fmt.Sprintf("Bearer %s", cred.token))
+		resp, err := do(request)
+		if err != nil {
+			return nil, fmt.Errorf("error doing request: %w", err)
+		}
+
+		key := rateLimitKey(endpoint, cred.token)
+		c.rateLimiter.update(key, resp)
+
+		switch resp.StatusCode {
+		case http.StatusTooManyRequests:
+			resp.Body.Close()
+
+			tokenReset := c.rateLimiter.resetTime(key)
+			if !tokenReset.IsZero() && (reset.IsZero() || tokenReset.Before(reset)) {
+				reset = tokenReset
+			}
+
+			// each token was tried once
+			if attempt+1 >= len(c.credentials.sources) {
+				return nil, &RateLimitedError{Endpoint: endpoint, Reset: reset}
+			}
+
+			continue
+		case http.StatusUnauthorized, http.StatusForbidden:
+			if credentialProblem(resp) {
+				c.credentials.reject(cred.source, cred.token)
+			}
+		}
+
+		return resp, nil
+	}
+}
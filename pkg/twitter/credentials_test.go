@@ -0,0 +1,226 @@
+package twitter
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kordape/ottct-poller-service/pkg/logger"
+	"github.com/kordape/ottct-poller-service/pkg/retry"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCredentialPool(t *testing.T) {
+	t.Run("rotates tokens", func(t *testing.T) {
+		used := []string{}
+		client := newHTTPCli(func(r *http.Request) (*http.Response, error) {
+			used = append(used, r.Header.Get("Authorization"))
+			return &http.Response{
+				StatusCode: http.StatusOK,
+				Body:       io.NopCloser(bytes.NewBufferString(`{"data": []}`)),
+			}, nil
+		})
+
+		pool, err := NewCredentialPool([]string{"token1", "token2", "token1", ""})
+		assert.NoError(t, err)
+
+		api := New(client, "", WithCredentialPool(pool))
+		for i := 0; i < 3; i++ {
+			_, err := api.FetchTweets(context.Background(), logger.New("DEBUG"), FetchTweetsRequest{SinceID: "1"})
+			assert.NoError(t, err)
+		}
+
+		assert.Equal(t, []string{"Bearer token1", "Bearer token2", "Bearer token1"}, used)
+	})
+
+	t.Run("skips tokens with exhausted budget", func(t *testing.T) {
+		used := []string{}
+		client := newHTTPCli(func(r *http.Request) (*http.Response, error) {
+			token := r.Header.Get("Authorization")
+			used = append(used, token)
+
+			if token == "Bearer token1" {
+				return &http.Response{
+					StatusCode: http.StatusTooManyRequests,
+					Header: http.Header{
+						"X-Rate-Limit-Reset": []string{strconv.FormatInt(time.Now().Add(time.Hour).Unix(), 10)},
+					},
+					Body: io.NopCloser(bytes.NewBufferString(`{}`)),
+				}, nil
+			}
+
+			return &http.Response{
+				StatusCode: http.StatusOK,
+				Body:       io.NopCloser(bytes.NewBufferString(`{"data": []}`)),
+			}, nil
+		})
+
+		pool, err := NewCredentialPool([]string{"token1", "token2"})
+		assert.NoError(t, err)
+
+		api := New(client, "", WithCredentialPool(pool), WithMaxRateLimitWait(0))
+
+		for i := 0; i < 3; i++ {
+			_, err = api.FetchTweets(context.Background(), logger.New("DEBUG"), FetchTweetsRequest{SinceID: "1"})
+			assert.NoError(t, err)
+		}
+
+		// the throttled request is sent again with the next token
+		assert.Equal(t, []string{"Bearer token1", "Bearer token2", "Bearer token2", "Bearer token2"}, used)
+	})
+
+	t.Run("fails when every token is throttled", func(t *testing.T) {
+		resets := map[string]time.Time{
+			"Bearer token1": time.Now().Add(time.Hour).Truncate(time.Second),
+			"Bearer token2": time.Now().Add(time.Minute).Truncate(time.Second),
+		}
+		used := []string{}
+		client := newHTTPCli(func(r *http.Request) (*http.Response, error) {
+			token := r.Header.Get("Authorization")
+			used = append(used, token)
+
+			return &http.Response{
+				StatusCode: http.StatusTooManyRequests,
+				Header: http.Header{
+					"X-Rate-Limit-Reset": []string{strconv.FormatInt(resets[token].Unix(), 10)},
+				},
+				Body: io.NopCloser(bytes.NewBufferString(`{}`)),
+			}, nil
+		})
+
+		pool, err := NewCredentialPool([]string{"token1", "token2"})
+		assert.NoError(t, err)
+
+		api := New(client, "", WithCredentialPool(pool), WithMaxRateLimitWait(0))
+
+		_, err = api.FetchTweets(context.Background(), logger.New("DEBUG"), FetchTweetsRequest{SinceID: "1"})
+		var rateLimitedErr *RateLimitedError
+		assert.True(t, errors.As(err, &rateLimitedErr))
+		assert.Equal(t, resets["Bearer token2"], rateLimitedErr.Reset)
+		assert.Equal(t, []string{"Bearer token1", "Bearer token2"}, used)
+
+		// no token is used until its budget resets
+		_, err = api.FetchTweets(context.Background(), logger.New("DEBUG"), FetchTweetsRequest{SinceID: "1"})
+		assert.True(t, errors.As(err, &rateLimitedErr))
+		assert.Equal(t, resets["Bearer token2"], rateLimitedErr.Reset)
+		assert.Len(t, used, 2)
+	})
+
+	t.Run("quarantines rejected tokens", func(t *testing.T) {
+		used := []string{}
+		client := newHTTPCli(func(r *http.Request) (*http.Response, error) {
+			token := r.Header.Get("Authorization")
+			used = append(used, token)
+
+			if token == "Bearer revoked" {
+				return &http.Response{
+					StatusCode: http.StatusUnauthorized,
+					Body:       io.NopCloser(bytes.NewBufferString(`{"title": "Unauthorized", "status": 401}`)),
+				}, nil
+			}
+
+			return &http.Response{
+				StatusCode: http.StatusOK,
+				Body:       io.NopCloser(bytes.NewBufferString(`{"data": []}`)),
+			}, nil
+		})
+
+		pool, err := NewCredentialPool([]string{"revoked", "token"})
+		assert.NoError(t, err)
+
+		api := New(client, "", WithCredentialPool(pool), WithRetryPolicy(retry.NoRetry()))
+
+		_, err = api.FetchTweets(context.Background(), logger.New("DEBUG"), FetchTweetsRequest{SinceID: "1"})
+		assert.ErrorIs(t, err, ErrUnauthorized)
+		assert.Equal(t, 1, pool.Size())
+
+		for i := 0; i < 2; i++ {
+			_, err = api.FetchTweets(context.Background(), logger.New("DEBUG"), FetchTweetsRequest{SinceID: "1"})
+			assert.NoError(t, err)
+		}
+
+		assert.Equal(t, []string{"Bearer revoked", "Bearer token", "Bearer token"}, used)
+
+		// quarantine is over
+		pool.now = func() time.Time { return time.Now().Add(defaultQuarantine) }
+		assert.Equal(t, 2, pool.Size())
+	})
+
+	t.Run("keeps tokens forbidden from a resource", func(t *testing.T) {
+		client := newHTTPCli(func(r *http.Request) (*http.Response, error) {
+			return &http.Response{
+				StatusCode: http.StatusForbidden,
+				Body: io.NopCloser(bytes.NewBufferString(`{"title": "Authorization Error",
+					"type": "https://api.twitter.com/2/problems/not-authorized-for-resource",
+					"detail": "Sorry, you are not authorized to see the user with id: [1]."}`)),
+			}, nil
+		})
+
+		pool, err := NewCredentialPool([]string{"token1", "token2"})
+		assert.NoError(t, err)
+
+		api := New(client, "", WithCredentialPool(pool), WithRetryPolicy(retry.NoRetry()))
+
+		for i := 0; i < 2; i++ {
+			_, err = api.FetchTweets(context.Background(), logger.New("DEBUG"), FetchTweetsRequest{SinceID: "1"})
+			assert.ErrorIs(t, err, ErrForbidden)
+		}
+		assert.Equal(t, 2, pool.Size())
+	})
+
+	t.Run("quarantines tokens refused with 403", func(t *testing.T) {
+		client := newHTTPCli(func(r *http.Request) (*http.Response, error) {
+			return &http.Response{
+				StatusCode: http.StatusForbidden,
+				Body: io.NopCloser(bytes.NewBufferString(`{"title": "Unsupported Authentication",
+					"type": "https://api.twitter.com/2/problems/unsupported-authentication", "status": 403}`)),
+			}, nil
+		})
+
+		pool, err := NewCredentialPool([]string{"token1", "token2"})
+		assert.NoError(t, err)
+
+		api := New(client, "", WithCredentialPool(pool), WithRetryPolicy(retry.NoRetry()))
+
+		_, err = api.FetchTweets(context.Background(), logger.New("DEBUG"), FetchTweetsRequest{SinceID: "1"})
+		assert.ErrorIs(t, err, ErrUnauthorized)
+		assert.Equal(t, 1, pool.Size())
+	})
+
+	t.Run("fails when all tokens are quarantined", func(t *testing.T) {
+		pool, err := NewCredentialPool([]string{"token"})
+		assert.NoError(t, err)
+		pool.quarantineSource(0)
+
+		api := New(newHTTPCli(nil), "", WithCredentialPool(pool))
+
+		_, err = api.FetchTweets(context.Background(), logger.New("DEBUG"), FetchTweetsRequest{SinceID: "1"})
+		assert.ErrorIs(t, err, ErrUnauthorized)
+	})
+
+	t.Run("needs a token", func(t *testing.T) {
+		_, err := NewCredentialPool([]string{" "})
+		assert.Error(t, err)
+	})
+}
+
+func TestLoadTokens(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tokens")
+	content := strings.Join([]string{"# project a", "token1", "", "  token2  "}, "\n")
+	assert.NoError(t, os.WriteFile(path, []byte(content), 0600))
+
+	tokens, err := LoadTokens(path)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"token1", "token2"}, tokens)
+
+	_, err = LoadTokens(filepath.Join(t.TempDir(), "missing"))
+	assert.Error(t, err)
+}
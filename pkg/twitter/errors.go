@@ -0,0 +1,171 @@
+package twitter
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+const (
+	problemResourceNotFound  = "https://api.twitter.com/2/problems/resource-not-found"
+	problemNotAuthorized     = "https://api.twitter.com/2/problems/not-authorized-for-resource"
+	problemUnsupportedAuth   = "https://api.twitter.com/2/problems/unsupported-authentication"
+	problemClientForbidden   = "https://api.twitter.com/2/problems/client-forbidden"
+	problemUsageCapExceeded  = "https://api.twitter.com/2/problems/usage-capped"
+	problemRateLimitExceeded = "https://api.twitter.com/2/problems/rate-limit-exceeded"
+)
+
+// Kinds of API errors, match them with errors.Is. ErrUnauthorized means the credentials were rejected,
+// ErrForbidden that they can't access the resource, e.g. tweets of a protected account.
+var (
+	ErrNotFound     = errors.New("resource not found")
+	ErrSuspended    = errors.New("account suspended")
+	ErrUnauthorized = errors.New("unauthorized")
+	ErrForbidden    = errors.New("forbidden")
+	ErrRateLimited  = errors.New("rate limited")
+)
+
+// APIError is a problem reported by the Twitter API, either as the whole response or as one of
+// the errors of a partially successful response. See https://developer.twitter.com/en/support/twitter-api/error-troubleshooting.
+type APIError struct {
+	// StatusCode is the HTTP status of the response, 200 for partial errors
+	StatusCode int
+	Type       string
+	Title      string
+	Detail     string
+	// Value is the requested value the error is about, e.g. a user ID, empty for whole response errors
+	Value string
+}
+
+func (e *APIError) Error() string {
+	message := e.Title
+	if e.Detail != "" {
+		message = fmt.Sprintf("%s: %s", e.Title, e.Detail)
+	}
+
+	if message == "" {
+		message = http.StatusText(e.StatusCode)
+	}
+
+	return fmt.Sprintf("twitter api error (%d): %s", e.StatusCode, message)
+}
+
+// Is classifies the error, e.g. errors.Is(err, ErrSuspended).
+func (e *APIError) Is(target error) bool {
+	switch target {
+	case ErrSuspended:
+		// suspended accounts are reported as resource-not-found problems titled Forbidden among the errors
+		// of a successful response, a whole response failing with Forbidden is about the credentials
+		return e.StatusCode == http.StatusOK && e.Type == problemResourceNotFound &&
+			(e.Title == "Forbidden" || strings.Contains(strings.ToLower(e.Detail), "suspended"))
+	case ErrNotFound:
+		return !e.Is(ErrSuspended) && (e.Type == problemResourceNotFound || e.StatusCode == http.StatusNotFound)
+	case ErrUnauthorized:
+		return e.StatusCode == http.StatusUnauthorized || e.Type == problemUnsupportedAuth
+	case ErrForbidden:
+		return !e.Is(ErrUnauthorized) &&
+			(e.StatusCode == http.StatusForbidden || e.Type == problemNotAuthorized || e.Type == problemClientForbidden)
+	case ErrRateLimited:
+		return e.StatusCode == http.StatusTooManyRequests ||
+			e.Type == problemRateLimitExceeded ||
+			e.Type == problemUsageCapExceeded
+	}
+
+	return false
+}
+
+func (e *RateLimitedError) Is(target error) bool {
+	return target == ErrRateLimited
+}
+
+// PartialError is returned along with the data of a response that carried errors for some of it.
+// Callers that can use the partial data check for it with errors.As.
+type PartialError struct {
+	Errors []*APIError
+}
+
+func (e *PartialError) Error() string {
+	messages := make([]string, len(e.Errors))
+	for i, err := range e.Errors {
+		messages[i] = err.Error()
+	}
+
+	return fmt.Sprintf("partial errors: %s", strings.Join(messages, "; "))
+}
+
+type problem struct {
+	Type   string `json:"type"`
+	Title  string `json:"title"`
+	Detail string `json:"detail"`
+	Value  string `json:"value"`
+	// v1.1 style errors, still returned for some authentication failures
+	Message string `json:"message"`
+}
+
+type problemResponse struct {
+	problem
+	Errors []problem `json:"errors"`
+}
+
+func (p problem) toAPIError(statusCode int) *APIError {
+	detail := p.Detail
+	if detail == "" {
+		detail = p.Message
+	}
+
+	return &APIError{
+		StatusCode: statusCode,
+		Type:       p.Type,
+		Title:      p.Title,
+		Detail:     detail,
+		Value:      p.Value,
+	}
+}
+
+// credentialProblem reports whether a failed response rejects the credentials themselves rather than access
+// to the requested resource, which Twitter also refuses with 403. The body is left readable.
+func credentialProblem(resp *http.Response) bool {
+	switch resp.StatusCode {
+	case http.StatusUnauthorized:
+		return true
+	case http.StatusForbidden:
+		body, err := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		resp.Body = io.NopCloser(bytes.NewReader(body))
+		if err != nil {
+			return false
+		}
+
+		return parseErrorResponse(resp.StatusCode, body).Is(ErrUnauthorized)
+	default:
+		return false
+	}
+}
+
+// parseErrorResponse decodes the problem of a failed response, falling back to its status.
+func parseErrorResponse(statusCode int, body []byte) *APIError {
+	var response problemResponse
+	if err := json.Unmarshal(body, &response); err != nil {
+		return &APIError{StatusCode: statusCode}
+	}
+
+	if response.Title == "" && response.Detail == "" && len(response.Errors) > 0 {
+		return response.Errors[0].toAPIError(statusCode)
+	}
+
+	return response.problem.toAPIError(statusCode)
+}
+
+// partialErrors converts errors of a successful response.
+func partialErrors(problems []problem) []*APIError {
+	errs := make([]*APIError, len(problems))
+	for i, p := range problems {
+		errs[i] = p.toAPIError(http.StatusOK)
+	}
+
+	return errs
+}
@@ -0,0 +1,117 @@
+package twitter
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"testing"
+
+	"github.com/kordape/ottct-poller-service/pkg/logger"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFetchTweetsErrors(t *testing.T) {
+	tests := []struct {
+		name       string
+		statusCode int
+		body       string
+		kind       error
+	}{
+		{
+			name:       "unauthorized",
+			statusCode: http.StatusUnauthorized,
+			body:       `{"title": "Unauthorized", "type": "about:blank", "status": 401, "detail": "Unauthorized"}`,
+			kind:       ErrUnauthorized,
+		},
+		{
+			name:       "forbidden",
+			statusCode: http.StatusForbidden,
+			body:       `{"title": "Forbidden", "type": "about:blank", "status": 403, "detail": "Forbidden"}`,
+			kind:       ErrForbidden,
+		},
+		{
+			name:       "unsupported authentication",
+			statusCode: http.StatusForbidden,
+			body: `{"title": "Unsupported Authentication", "type": "https://api.twitter.com/2/problems/unsupported-authentication",
+				"status": 403, "detail": "Authenticating with OAuth 2.0 Application-Only is forbidden for this endpoint."}`,
+			kind: ErrUnauthorized,
+		},
+		{
+			name:       "protected user",
+			statusCode: http.StatusForbidden,
+			body: `{"title": "Authorization Error", "type": "https://api.twitter.com/2/problems/not-authorized-for-resource",
+				"detail": "Sorry, you are not authorized to see the user with id: [1]."}`,
+			kind: ErrForbidden,
+		},
+		{
+			name:       "client forbidden",
+			statusCode: http.StatusForbidden,
+			body: `{"title": "Client Forbidden", "type": "https://api.twitter.com/2/problems/client-forbidden",
+				"detail": "This request must be made using an approved developer account.", "reason": "client-not-enrolled"}`,
+			kind: ErrForbidden,
+		},
+		{
+			name:       "suspended user",
+			statusCode: http.StatusOK,
+			body: `{"errors": [{"value": "1", "detail": "User has been suspended: [1].", "title": "Forbidden",
+				"resource_type": "user", "type": "https://api.twitter.com/2/problems/resource-not-found"}]}`,
+			kind: ErrSuspended,
+		},
+		{
+			name:       "deleted user",
+			statusCode: http.StatusOK,
+			body: `{"errors": [{"value": "1", "detail": "Could not find user with id: [1].", "title": "Not Found Error",
+				"resource_type": "user", "type": "https://api.twitter.com/2/problems/resource-not-found"}]}`,
+			kind: ErrNotFound,
+		},
+		{
+			name:       "rate limited",
+			statusCode: http.StatusTooManyRequests,
+			body:       `{"title": "Too Many Requests", "detail": "Too Many Requests", "type": "about:blank", "status": 429}`,
+			kind:       ErrRateLimited,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := newHTTPCli(func(r *http.Request) (*http.Response, error) {
+				return &http.Response{
+					StatusCode: tt.statusCode,
+					Body:       io.NopCloser(bytes.NewBufferString(tt.body)),
+				}, nil
+			})
+
+			api := New(client, "futile")
+
+			_, err := api.FetchTweets(context.Background(), logger.New("DEBUG"), FetchTweetsRequest{SinceID: "1"})
+			assert.ErrorIs(t, err, tt.kind)
+			for _, kind := range []error{ErrUnauthorized, ErrForbidden, ErrSuspended, ErrNotFound, ErrRateLimited} {
+				if kind != tt.kind {
+					assert.False(t, errors.Is(err, kind), "unexpectedly %v", kind)
+				}
+			}
+		})
+	}
+
+	t.Run("partial errors", func(t *testing.T) {
+		client := newHTTPCli(func(r *http.Request) (*http.Response, error) {
+			return &http.Response{
+				StatusCode: http.StatusOK,
+				Body: io.NopCloser(bytes.NewBufferString(`{
+					"data": [{"id": "2", "text": "Tweet", "author_id": "1"}],
+					"errors": [{"value": "3", "title": "Not Found Error", "type": "https://api.twitter.com/2/problems/resource-not-found"}]
+				}`)),
+			}, nil
+		})
+
+		api := New(client, "futile")
+
+		resp, err := api.FetchTweets(context.Background(), logger.New("DEBUG"), FetchTweetsRequest{SinceID: "1"})
+		var partialErr *PartialError
+		assert.True(t, errors.As(err, &partialErr))
+		assert.Equal(t, "3", partialErr.Errors[0].Value)
+		assert.Equal(t, 1, len(resp.Tweets))
+	})
+}
@@ -37,6 +37,29 @@ func (_m *MockTweetsFetcher) FetchTweets(_a0 context.Context, _a1 logger.Interfa
 	return r0, r1
 }
 
+// LookupTweets provides a mock function with given fields: ctx, log, ids
+func (_m *MockTweetsFetcher) LookupTweets(ctx context.Context, log logger.Interface, ids []string) ([]Tweet, error) {
+	ret := _m.Called(ctx, log, ids)
+
+	var r0 []Tweet
+	if rf, ok := ret.Get(0).(func(context.Context, logger.Interface, []string) []Tweet); ok {
+		r0 = rf(ctx, log, ids)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]Tweet)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, logger.Interface, []string) error); ok {
+		r1 = rf(ctx, log, ids)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
 type NewMockTweetsFetcherT interface {
 	mock.TestingT
 	Cleanup(func())
@@ -0,0 +1,148 @@
+package twitter
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+)
+
+const defaultTokenURL = "https://api.twitter.com/oauth2/token"
+
+// ClientCredentials obtains app-only bearer tokens from a consumer key and secret through the OAuth 2.0
+// client credentials grant. The token is cached until Twitter rejects it.
+type ClientCredentials struct {
+	httpClient     *http.Client
+	consumerKey    string
+	consumerSecret string
+	tokenURL       string
+
+	mu    sync.Mutex
+	token string
+}
+
+type ClientCredentialsOption func(c *ClientCredentials)
+
+// WithTokenURL overrides the OAuth2 token endpoint, e.g. to point it to a stub in tests.
+func WithTokenURL(tokenURL string) ClientCredentialsOption {
+	return func(c *ClientCredentials) {
+		c.tokenURL = tokenURL
+	}
+}
+
+type tokenResponse struct {
+	TokenType   string `json:"token_type"`
+	AccessToken string `json:"access_token"`
+}
+
+func NewClientCredentials(httpClient *http.Client, consumerKey, consumerSecret string, opts ...ClientCredentialsOption) (*ClientCredentials, error) {
+	c := &ClientCredentials{
+		httpClient:     httpClient,
+		consumerKey:    consumerKey,
+		consumerSecret: consumerSecret,
+		tokenURL:       defaultTokenURL,
+	}
+
+	for _, opt := range opts {
+		opt(c)
+	}
+
+	if err := c.validate(); err != nil {
+		return nil, err
+	}
+
+	return c, nil
+}
+
+func (c *ClientCredentials) validate() error {
+	if c.httpClient == nil {
+		return errors.New("http client is required")
+	}
+
+	if c.consumerKey == "" || c.consumerSecret == "" {
+		return errors.New("consumer key and secret are required")
+	}
+
+	if _, err := url.ParseRequestURI(c.tokenURL); err != nil {
+		return fmt.Errorf("invalid token url: %w", err)
+	}
+
+	return nil
+}
+
+// Token returns the cached bearer token, obtaining a new one if there is none.
+func (c *ClientCredentials) Token(ctx context.Context) (string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.token != "" {
+		return c.token, nil
+	}
+
+	token, err := c.requestToken(ctx)
+	if err != nil {
+		return "", err
+	}
+	c.token = token
+
+	return token, nil
+}
+
+// Invalidate drops the cached token so the next call to Token obtains a new one.
+func (c *ClientCredentials) Invalidate(token string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.token == token {
+		c.token = ""
+	}
+
+	return true
+}
+
+// String keeps the consumer secret and the token out of logs.
+func (c *ClientCredentials) String() string {
+	return "ClientCredentials(redacted)"
+}
+
+func (c *ClientCredentials) requestToken(ctx context.Context) (string, error) {
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, c.tokenURL, strings.NewReader(url.Values{"grant_type": {"client_credentials"}}.Encode()))
+	if err != nil {
+		return "", fmt.Errorf("error creating token request: %w", err)
+	}
+
+	request.SetBasicAuth(url.QueryEscape(c.consumerKey), url.QueryEscape(c.consumerSecret))
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded;charset=UTF-8")
+
+	resp, err := c.httpClient.Do(request)
+	if err != nil {
+		return "", fmt.Errorf("error requesting token: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", fmt.Errorf("error reading token response: %w", err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("error requesting token: %w", parseErrorResponse(resp.StatusCode, body))
+	}
+
+	var response tokenResponse
+	if err := json.Unmarshal(body, &response); err != nil {
+		// the body is not logged, it may contain the token
+		return "", errors.New("error unmarshaling token response")
+	}
+
+	if !strings.EqualFold(response.TokenType, "bearer") || response.AccessToken == "" {
+		return "", fmt.Errorf("unexpected token type %q", response.TokenType)
+	}
+
+	return response.AccessToken, nil
+}
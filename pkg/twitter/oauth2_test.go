@@ -0,0 +1,99 @@
+package twitter
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/kordape/ottct-poller-service/pkg/logger"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestClientCredentials(t *testing.T) {
+	issued := 0
+	tokenServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key, secret, ok := r.BasicAuth()
+		if !ok || key != "key" || secret != "secret" || r.FormValue("grant_type") != "client_credentials" {
+			w.WriteHeader(http.StatusForbidden)
+			fmt.Fprint(w, `{"errors": [{"code": 99, "message": "Unable to verify your credentials"}]}`)
+			return
+		}
+
+		issued++
+		fmt.Fprintf(w, `{"token_type": "bearer", "access_token": "token%d"}`, issued)
+	}))
+	defer tokenServer.Close()
+
+	t.Run("caches the token", func(t *testing.T) {
+		issued = 0
+		source, err := NewClientCredentials(tokenServer.Client(), "key", "secret", WithTokenURL(tokenServer.URL))
+		assert.NoError(t, err)
+
+		for i := 0; i < 2; i++ {
+			token, err := source.Token(context.Background())
+			assert.NoError(t, err)
+			assert.Equal(t, "token1", token)
+		}
+		assert.Equal(t, 1, issued)
+		assert.NotContains(t, fmt.Sprint(source), "secret")
+	})
+
+	t.Run("refreshes the token rejected by twitter", func(t *testing.T) {
+		issued = 0
+		used := []string{}
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			used = append(used, r.Header.Get("Authorization"))
+			if r.Header.Get("Authorization") == "Bearer token1" {
+				w.WriteHeader(http.StatusUnauthorized)
+				fmt.Fprint(w, `{"title": "Unauthorized", "type": "about:blank", "status": 401, "detail": "Unauthorized"}`)
+				return
+			}
+			fmt.Fprint(w, `{"data": []}`)
+		}))
+		defer server.Close()
+
+		source, err := NewClientCredentials(tokenServer.Client(), "key", "secret", WithTokenURL(tokenServer.URL))
+		assert.NoError(t, err)
+		pool, err := NewCredentialPool(nil, WithTokenSources(source))
+		assert.NoError(t, err)
+
+		api := New(server.Client(), "", WithBaseURL(server.URL), WithCredentialPool(pool))
+		_, err = api.FetchTweets(context.Background(), logger.New("DEBUG"), FetchTweetsRequest{SinceID: "1"})
+		assert.True(t, errors.Is(err, ErrUnauthorized))
+
+		_, err = api.FetchTweets(context.Background(), logger.New("DEBUG"), FetchTweetsRequest{SinceID: "1"})
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"Bearer token1", "Bearer token2"}, used)
+		assert.Equal(t, 1, pool.Size())
+	})
+
+	t.Run("doesn't leak credentials in errors", func(t *testing.T) {
+		source, err := NewClientCredentials(tokenServer.Client(), "key", "wrong", WithTokenURL(tokenServer.URL))
+		assert.NoError(t, err)
+
+		_, err = source.Token(context.Background())
+		assert.Error(t, err)
+		assert.False(t, strings.Contains(err.Error(), "wrong"))
+	})
+
+	t.Run("quarantines source that can't obtain a token", func(t *testing.T) {
+		source, err := NewClientCredentials(tokenServer.Client(), "key", "wrong", WithTokenURL(tokenServer.URL))
+		assert.NoError(t, err)
+		pool, err := NewCredentialPool(nil, WithTokenSources(source))
+		assert.NoError(t, err)
+
+		api := New(tokenServer.Client(), "", WithCredentialPool(pool))
+		_, err = api.FetchTweets(context.Background(), logger.New("DEBUG"), FetchTweetsRequest{SinceID: "1"})
+		assert.True(t, errors.Is(err, ErrUnauthorized))
+		assert.Equal(t, 0, pool.Size())
+	})
+
+	t.Run("requires consumer key and secret", func(t *testing.T) {
+		_, err := NewClientCredentials(http.DefaultClient, "key", "")
+		assert.Error(t, err)
+	})
+}
@@ -0,0 +1,127 @@
+package twitter
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	rateLimitRemainingHeader = "x-rate-limit-remaining"
+	rateLimitResetHeader     = "x-rate-limit-reset"
+
+	// used when Twitter responds with 429 without telling us when the window resets
+	defaultRateLimitWindow = 15 * time.Minute
+)
+
+// RateLimitedError is returned when the rate limit budget of an endpoint is exhausted.
+// Requests can be made again after Reset.
+type RateLimitedError struct {
+	Endpoint string
+	Reset    time.Time
+}
+
+func (e *RateLimitedError) Error() string {
+	return fmt.Sprintf("rate limit exceeded for %s, resets at %s", e.Endpoint, e.Reset.Format(time.RFC3339))
+}
+
+type rateLimit struct {
+	remaining int
+	reset     time.Time
+}
+
+// rateLimiter tracks the rate limit budget reported by Twitter per endpoint and token.
+type rateLimiter struct {
+	mu     sync.Mutex
+	limits map[string]rateLimit
+	now    func() time.Time
+}
+
+func newRateLimiter() *rateLimiter {
+	return &rateLimiter{
+		limits: map[string]rateLimit{},
+		now:    time.Now,
+	}
+}
+
+// rateLimitKey identifies a rate limit bucket without keeping the token itself around.
+func rateLimitKey(endpoint, token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return endpoint + "#" + hex.EncodeToString(sum[:8])
+}
+
+// update records the budget reported in response headers. Responses without rate limit
+// headers leave the known budget as is.
+func (l *rateLimiter) update(key string, resp *http.Response) {
+	remaining, errRemaining := strconv.Atoi(resp.Header.Get(rateLimitRemainingHeader))
+	reset, errReset := strconv.ParseInt(resp.Header.Get(rateLimitResetHeader), 10, 64)
+	limited := resp.StatusCode == http.StatusTooManyRequests
+
+	if errRemaining != nil && errReset != nil && !limited {
+		return
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	limit := l.limits[key]
+	if errRemaining == nil {
+		limit.remaining = remaining
+	}
+	if errReset == nil {
+		limit.reset = time.Unix(reset, 0)
+	}
+	if limited {
+		limit.remaining = 0
+		if errReset != nil {
+			limit.reset = l.now().Add(defaultRateLimitWindow)
+		}
+	}
+
+	l.limits[key] = limit
+}
+
+// resetTime returns when the exhausted budget of key resets, or zero time if there is budget left.
+func (l *rateLimiter) resetTime(key string) time.Time {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	limit, ok := l.limits[key]
+	if !ok || limit.remaining > 0 || !limit.reset.After(l.now()) {
+		return time.Time{}
+	}
+
+	return limit.reset
+}
+
+// wait blocks until the budget of key resets if that happens within maxWait. Otherwise it
+// returns RateLimitedError right away so the caller can defer the request.
+func (l *rateLimiter) wait(ctx context.Context, endpoint, key string, maxWait time.Duration) error {
+	reset := l.resetTime(key)
+	if reset.IsZero() {
+		return nil
+	}
+
+	wait := reset.Sub(l.now())
+	if wait > maxWait {
+		return &RateLimitedError{
+			Endpoint: endpoint,
+			Reset:    reset,
+		}
+	}
+
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
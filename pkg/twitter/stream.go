@@ -0,0 +1,316 @@
+package twitter
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/kordape/ottct-poller-service/pkg/logger"
+)
+
+const (
+	streamPath          = "/2/tweets/search/stream"
+	streamRulesPath     = "/2/tweets/search/stream/rules"
+	streamEndpoint      = "GET /2/tweets/search/stream"
+	streamRulesEndpoint = "/2/tweets/search/stream/rules"
+
+	// Twitter sends a keep-alive every 20 seconds, a longer silence means the connection is stale
+	streamStallTimeout = 30 * time.Second
+	streamMinBackoff   = time.Second
+	streamMaxBackoff   = 5 * time.Minute
+
+	maxStreamRuleLength = 512
+	maxStreamLineSize   = 1024 * 1024
+)
+
+type streamRule struct {
+	ID    string `json:"id,omitempty"`
+	Value string `json:"value"`
+	Tag   string `json:"tag,omitempty"`
+}
+
+type getStreamRulesResponse struct {
+	Data []streamRule `json:"data"`
+}
+
+type addStreamRulesRequest struct {
+	Add []streamRule `json:"add"`
+}
+
+type deleteStreamRulesRequest struct {
+	Delete struct {
+		IDs []string `json:"ids"`
+	} `json:"delete"`
+}
+
+type streamMessage struct {
+	Data          *tweet   `json:"data"`
+	Includes      includes `json:"includes"`
+	MatchingRules []struct {
+		ID string `json:"id"`
+	} `json:"matching_rules"`
+	Errors []json.RawMessage `json:"errors"`
+}
+
+// FromUsersRules builds stream rules matching tweets posted by any of the given users,
+// packing as many users into a single rule as its length limit allows.
+func FromUsersRules(tag string, userIDs []string) []StreamRule {
+	rules := []StreamRule{}
+	value := ""
+	for _, id := range userIDs {
+		clause := "from:" + id
+		if value != "" && len(value)+len(" OR ")+len(clause) > maxStreamRuleLength {
+			rules = append(rules, StreamRule{Value: value, Tag: tag})
+			value = ""
+		}
+
+		if value != "" {
+			value += " OR "
+		}
+		value += clause
+	}
+
+	if value != "" {
+		rules = append(rules, StreamRule{Value: value, Tag: tag})
+	}
+
+	return rules
+}
+
+func (c *Client) SyncStreamRules(ctx context.Context, log logger.Interface, tag string, rules []StreamRule) error {
+	current, err := c.getStreamRules(ctx)
+	if err != nil {
+		return fmt.Errorf("error getting stream rules: %w", err)
+	}
+
+	wanted := map[string]bool{}
+	for _, r := range rules {
+		wanted[r.Value] = true
+	}
+
+	existing := map[string]bool{}
+	toDelete := []string{}
+	for _, r := range current {
+		// rules with other tags aren't ours to manage
+		if r.Tag != tag {
+			continue
+		}
+
+		if wanted[r.Value] && !existing[r.Value] {
+			existing[r.Value] = true
+			continue
+		}
+		toDelete = append(toDelete, r.ID)
+	}
+
+	toAdd := []streamRule{}
+	for _, r := range rules {
+		if existing[r.Value] {
+			continue
+		}
+		existing[r.Value] = true
+		toAdd = append(toAdd, streamRule{Value: r.Value, Tag: tag})
+	}
+
+	if len(toDelete) > 0 {
+		body := deleteStreamRulesRequest{}
+		body.Delete.IDs = toDelete
+		if err := c.postStreamRules(ctx, body); err != nil {
+			return fmt.Errorf("error deleting stream rules: %w", err)
+		}
+	}
+
+	if len(toAdd) > 0 {
+		if err := c.postStreamRules(ctx, addStreamRulesRequest{Add: toAdd}); err != nil {
+			return fmt.Errorf("error adding stream rules: %w", err)
+		}
+	}
+
+	log.Info(fmt.Sprintf("Synced stream rules, added %d and deleted %d", len(toAdd), len(toDelete)))
+
+	return nil
+}
+
+func (c *Client) getStreamRules(ctx context.Context) ([]StreamRule, error) {
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, c.url(streamRulesPath), nil)
+	if err != nil {
+		return nil, fmt.Errorf("error creating request: %w", err)
+	}
+
+	body, err := c.doRequest(ctx, "GET "+streamRulesEndpoint, request)
+	if err != nil {
+		return nil, err
+	}
+
+	var response getStreamRulesResponse
+	if err := json.Unmarshal(body, &response); err != nil {
+		return nil, fmt.Errorf("error unmarshalling response: %w", err)
+	}
+
+	rules := make([]StreamRule, len(response.Data))
+	for i, r := range response.Data {
+		rules[i] = StreamRule{
+			ID:    r.ID,
+			Value: r.Value,
+			Tag:   r.Tag,
+		}
+	}
+
+	return rules, nil
+}
+
+func (c *Client) postStreamRules(ctx context.Context, payload interface{}) error {
+	buf, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("error marshalling request body: %w", err)
+	}
+
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, c.url(streamRulesPath), bytes.NewBuffer(buf))
+	if err != nil {
+		return fmt.Errorf("error creating request: %w", err)
+	}
+	request.Header.Set("Content-Type", "application/json")
+
+	_, err = c.doRequest(ctx, "POST "+streamRulesEndpoint, request)
+	return err
+}
+
+func (c *Client) doRequest(ctx context.Context, endpoint string, request *http.Request) ([]byte, error) {
+	resp, err := c.send(ctx, endpoint, request, func(r *http.Request) (*http.Response, error) {
+		return c.retryPolicy.Do(ctx, c.httpClient, r)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("error reading response: %w", err)
+	}
+
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusCreated {
+		return nil, parseErrorResponse(resp.StatusCode, body)
+	}
+
+	return body, nil
+}
+
+// Stream requires an http.Client without a timeout, the connection stays open indefinitely.
+// Stale connections are detected by missing keep-alives instead.
+func (c *Client) Stream(ctx context.Context, log logger.Interface, handler StreamHandler) error {
+	backoff := streamMinBackoff
+	for {
+		connected, err := c.consumeStream(ctx, log, handler)
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		if connected {
+			backoff = streamMinBackoff
+		}
+
+		wait := backoff
+		var rateLimitedErr *RateLimitedError
+		if errors.As(err, &rateLimitedErr) {
+			if untilReset := time.Until(rateLimitedErr.Reset); untilReset > wait {
+				wait = untilReset
+			}
+		}
+
+		log.Warn(fmt.Sprintf("Stream disconnected: %v, reconnecting in %s", err, wait))
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+
+		backoff *= 2
+		if backoff > streamMaxBackoff {
+			backoff = streamMaxBackoff
+		}
+	}
+}
+
+// consumeStream reads a single stream connection until it breaks. It reports whether
+// the connection was established, so the caller can reset its backoff.
+func (c *Client) consumeStream(ctx context.Context, log logger.Interface, handler StreamHandler) (bool, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	url := fmt.Sprintf("%s?%s", c.url(streamPath), c.tweetFields.query().Encode())
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return false, fmt.Errorf("error creating request: %w", err)
+	}
+
+	resp, err := c.send(ctx, streamEndpoint, request, c.httpClient.Do)
+	if err != nil {
+		return false, err
+	}
+
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, maxStreamLineSize))
+		return false, parseErrorResponse(resp.StatusCode, body)
+	}
+
+	log.Info("Connected to Twitter filtered stream")
+
+	stall := time.AfterFunc(streamStallTimeout, cancel)
+	defer stall.Stop()
+
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(make([]byte, 0, 64*1024), maxStreamLineSize)
+	for scanner.Scan() {
+		stall.Reset(streamStallTimeout)
+
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			// keep-alive
+			continue
+		}
+
+		var message streamMessage
+		if err := json.Unmarshal([]byte(line), &message); err != nil {
+			log.Error(fmt.Sprintf("Error unmarshalling stream message: %s", err))
+			continue
+		}
+
+		if len(message.Errors) > 0 {
+			log.Warn(fmt.Sprintf("Stream reported errors: %s", line))
+		}
+
+		if message.Data == nil {
+			continue
+		}
+
+		rules := make([]string, len(message.MatchingRules))
+		for i, r := range message.MatchingRules {
+			rules[i] = r.ID
+		}
+
+		handler(StreamedTweet{
+			Tweet:         toTweets([]tweet{*message.Data}, message.Includes)[0],
+			MatchingRules: rules,
+		})
+	}
+
+	if err := scanner.Err(); err != nil {
+		return true, fmt.Errorf("error reading stream: %w", err)
+	}
+
+	return true, errors.New("stream closed by server")
+}
@@ -0,0 +1,132 @@
+package twitter
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/kordape/ottct-poller-service/pkg/logger"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFromUsersRules(t *testing.T) {
+	rules := FromUsersRules("tag", []string{"1", "2", "3"})
+	assert.Equal(t, []StreamRule{{Value: "from:1 OR from:2 OR from:3", Tag: "tag"}}, rules)
+
+	ids := make([]string, 100)
+	for i := range ids {
+		ids[i] = fmt.Sprintf("1234567890%d", i)
+	}
+
+	rules = FromUsersRules("tag", ids)
+	assert.Greater(t, len(rules), 1)
+
+	total := 0
+	for _, r := range rules {
+		assert.LessOrEqual(t, len(r.Value), maxStreamRuleLength)
+		total += len(strings.Split(r.Value, " OR "))
+	}
+	assert.Equal(t, len(ids), total)
+
+	assert.Empty(t, FromUsersRules("tag", nil))
+}
+
+func TestSyncStreamRules(t *testing.T) {
+	var mu sync.Mutex
+	posted := []string{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/2/tweets/search/stream/rules", r.URL.Path)
+
+		if r.Method == http.MethodGet {
+			w.Write([]byte(`{"data": [
+				{"id": "1", "value": "from:1", "tag": "poller"},
+				{"id": "2", "value": "from:2", "tag": "poller"},
+				{"id": "3", "value": "from:2", "tag": "someone-else"}
+			]}`))
+			return
+		}
+
+		body, _ := io.ReadAll(r.Body)
+		mu.Lock()
+		posted = append(posted, string(body))
+		mu.Unlock()
+		w.Write([]byte(`{}`))
+	}))
+	defer server.Close()
+
+	api := New(server.Client(), "futile", WithBaseURL(server.URL))
+
+	err := api.SyncStreamRules(context.Background(), logger.New("DEBUG"), "poller", []StreamRule{
+		{Value: "from:1"},
+		{Value: "from:3"},
+	})
+	assert.NoError(t, err)
+
+	assert.Equal(t, 2, len(posted))
+
+	var deleteRequest deleteStreamRulesRequest
+	assert.NoError(t, json.Unmarshal([]byte(posted[0]), &deleteRequest))
+	assert.Equal(t, []string{"2"}, deleteRequest.Delete.IDs)
+
+	var addRequest addStreamRulesRequest
+	assert.NoError(t, json.Unmarshal([]byte(posted[1]), &addRequest))
+	assert.Equal(t, []streamRule{{Value: "from:3", Tag: "poller"}}, addRequest.Add)
+}
+
+func TestStream(t *testing.T) {
+	var mu sync.Mutex
+	connections := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/2/tweets/search/stream", r.URL.Path)
+
+		mu.Lock()
+		connections++
+		connection := connections
+		mu.Unlock()
+
+		if connection == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+
+		w.Write([]byte("\r\n"))
+		w.Write([]byte(fmt.Sprintf(`{"data": {"id": "%d", "text": "Tweet", "created_at": "2023-03-17T15:09:49.000Z", "author_id": "42"}}`+"\r\n", connection)))
+		w.Write([]byte(`{"errors": [{"title": "operational-disconnect"}]}` + "\r\n"))
+	}))
+	defer server.Close()
+
+	api := New(server.Client(), "futile", WithBaseURL(server.URL))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	tweets := make(chan StreamedTweet, 10)
+	done := make(chan error)
+	go func() {
+		done <- api.Stream(ctx, logger.New("DEBUG"), func(tweet StreamedTweet) {
+			tweets <- tweet
+		})
+	}()
+
+	// first connection fails, the following ones deliver a tweet each before disconnecting
+	for _, id := range []string{"2", "3"} {
+		select {
+		case tweet := <-tweets:
+			assert.Equal(t, id, tweet.ID)
+			assert.Equal(t, "42", tweet.AuthorID)
+			assert.Equal(t, "Tweet", tweet.Text)
+		case <-time.After(10 * time.Second):
+			t.Fatal("no tweet received")
+		}
+	}
+
+	cancel()
+	assert.ErrorIs(t, <-done, context.Canceled)
+}
@@ -0,0 +1,225 @@
+package twitter
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// requiredTweetFields are always requested, the rest of the model is optional.
+var requiredTweetFields = []string{"id", "text", "created_at", "author_id", "referenced_tweets"}
+
+// TweetFields selects which optional tweet data is requested from the API, see
+// https://developer.twitter.com/en/docs/twitter-api/fields and .../expansions.
+type TweetFields struct {
+	TweetFields []string
+	Expansions  []string
+	UserFields  []string
+	MediaFields []string
+}
+
+func DefaultTweetFields() TweetFields {
+	return TweetFields{
+		TweetFields: []string{"lang", "public_metrics", "referenced_tweets", "entities", "attachments", "conversation_id"},
+		Expansions:  []string{"author_id", "attachments.media_keys"},
+		UserFields:  []string{"username", "name"},
+		MediaFields: []string{"type", "url", "preview_image_url"},
+	}
+}
+
+// query returns the query parameters requesting the fields.
+func (f TweetFields) query() url.Values {
+	query := url.Values{}
+	query.Set("tweet.fields", strings.Join(union(requiredTweetFields, f.TweetFields), ","))
+	if len(f.Expansions) > 0 {
+		query.Set("expansions", strings.Join(f.Expansions, ","))
+	}
+	if len(f.UserFields) > 0 {
+		query.Set("user.fields", strings.Join(f.UserFields, ","))
+	}
+	if len(f.MediaFields) > 0 {
+		query.Set("media.fields", strings.Join(f.MediaFields, ","))
+	}
+
+	return query
+}
+
+func union(a, b []string) []string {
+	seen := map[string]bool{}
+	result := []string{}
+	for _, v := range append(append([]string{}, a...), b...) {
+		if v == "" || seen[v] {
+			continue
+		}
+		seen[v] = true
+		result = append(result, v)
+	}
+
+	return result
+}
+
+type PublicMetrics struct {
+	RetweetCount    int
+	ReplyCount      int
+	LikeCount       int
+	QuoteCount      int
+	ImpressionCount int
+}
+
+const (
+	ReferenceRetweeted = "retweeted"
+	ReferenceQuoted    = "quoted"
+	ReferenceRepliedTo = "replied_to"
+)
+
+type ReferencedTweet struct {
+	// Type is one of ReferenceRetweeted, ReferenceQuoted or ReferenceRepliedTo
+	Type string
+	ID   string
+}
+
+// Referenced returns the ID of the tweet referenced with the given type, if any.
+func (t Tweet) Referenced(referenceType string) (string, bool) {
+	for _, r := range t.ReferencedTweets {
+		if r.Type == referenceType {
+			return r.ID, true
+		}
+	}
+
+	return "", false
+}
+
+type TweetURL struct {
+	URL         string
+	ExpandedURL string
+	DisplayURL  string
+}
+
+type Media struct {
+	MediaKey        string
+	Type            string
+	URL             string
+	PreviewImageURL string
+}
+
+// URL links to the tweet on Twitter. Tweets without an expanded author get a link that redirects to it.
+func (t Tweet) URL() string {
+	if t.Author != nil && t.Author.Username != "" {
+		return fmt.Sprintf("https://twitter.com/%s/status/%s", t.Author.Username, t.ID)
+	}
+
+	return fmt.Sprintf("https://twitter.com/i/web/status/%s", t.ID)
+}
+
+type tweet struct {
+	CreatedAt      time.Time `json:"created_at"`
+	ID             string    `json:"id"`
+	Text           string    `json:"text"`
+	AuthorID       string    `json:"author_id"`
+	ConversationID string    `json:"conversation_id"`
+	Lang           string    `json:"lang"`
+	PublicMetrics  *struct {
+		RetweetCount    int `json:"retweet_count"`
+		ReplyCount      int `json:"reply_count"`
+		LikeCount       int `json:"like_count"`
+		QuoteCount      int `json:"quote_count"`
+		ImpressionCount int `json:"impression_count"`
+	} `json:"public_metrics"`
+	ReferencedTweets []struct {
+		Type string `json:"type"`
+		ID   string `json:"id"`
+	} `json:"referenced_tweets"`
+	Entities struct {
+		URLs []struct {
+			URL         string `json:"url"`
+			ExpandedURL string `json:"expanded_url"`
+			DisplayURL  string `json:"display_url"`
+		} `json:"urls"`
+	} `json:"entities"`
+	Attachments struct {
+		MediaKeys []string `json:"media_keys"`
+	} `json:"attachments"`
+}
+
+// includes holds the objects expansions of tweets refer to.
+type includes struct {
+	Users []user `json:"users"`
+	Media []struct {
+		MediaKey        string `json:"media_key"`
+		Type            string `json:"type"`
+		URL             string `json:"url"`
+		PreviewImageURL string `json:"preview_image_url"`
+	} `json:"media"`
+}
+
+// toTweets converts API tweets to the model, resolving their expansions from includes.
+func toTweets(tweets []tweet, inc includes) []Tweet {
+	users := make(map[string]User, len(inc.Users))
+	for _, u := range inc.Users {
+		users[u.ID] = User{
+			ID:       u.ID,
+			Username: u.Username,
+			Name:     u.Name,
+		}
+	}
+
+	media := make(map[string]Media, len(inc.Media))
+	for _, m := range inc.Media {
+		media[m.MediaKey] = Media{
+			MediaKey:        m.MediaKey,
+			Type:            m.Type,
+			URL:             m.URL,
+			PreviewImageURL: m.PreviewImageURL,
+		}
+	}
+
+	result := make([]Tweet, len(tweets))
+	for i, t := range tweets {
+		result[i] = Tweet{
+			ID:             t.ID,
+			Text:           t.Text,
+			CreatedAt:      t.CreatedAt,
+			AuthorID:       t.AuthorID,
+			ConversationID: t.ConversationID,
+			Lang:           t.Lang,
+		}
+
+		if author, ok := users[t.AuthorID]; ok {
+			result[i].Author = &author
+		}
+
+		if t.PublicMetrics != nil {
+			result[i].PublicMetrics = &PublicMetrics{
+				RetweetCount:    t.PublicMetrics.RetweetCount,
+				ReplyCount:      t.PublicMetrics.ReplyCount,
+				LikeCount:       t.PublicMetrics.LikeCount,
+				QuoteCount:      t.PublicMetrics.QuoteCount,
+				ImpressionCount: t.PublicMetrics.ImpressionCount,
+			}
+		}
+
+		for _, r := range t.ReferencedTweets {
+			result[i].ReferencedTweets = append(result[i].ReferencedTweets, ReferencedTweet{
+				Type: r.Type,
+				ID:   r.ID,
+			})
+		}
+
+		for _, u := range t.Entities.URLs {
+			result[i].URLs = append(result[i].URLs, TweetURL{
+				URL:         u.URL,
+				ExpandedURL: u.ExpandedURL,
+				DisplayURL:  u.DisplayURL,
+			})
+		}
+
+		for _, key := range t.Attachments.MediaKeys {
+			if m, ok := media[key]; ok {
+				result[i].Media = append(result[i].Media, m)
+			}
+		}
+	}
+
+	return result
+}
@@ -0,0 +1,131 @@
+package twittertest
+
+import (
+	"time"
+
+	"github.com/kordape/ottct-poller-service/pkg/twitter"
+)
+
+// User, Tweet and Media are the objects as the Twitter API v2 encodes them, they are the format of seeds.
+
+type User struct {
+	ID       string `json:"id"`
+	Username string `json:"username"`
+	Name     string `json:"name,omitempty"`
+}
+
+type Tweet struct {
+	ID               string            `json:"id"`
+	Text             string            `json:"text"`
+	CreatedAt        time.Time         `json:"created_at"`
+	AuthorID         string            `json:"author_id"`
+	ConversationID   string            `json:"conversation_id,omitempty"`
+	Lang             string            `json:"lang,omitempty"`
+	PublicMetrics    *PublicMetrics    `json:"public_metrics,omitempty"`
+	ReferencedTweets []ReferencedTweet `json:"referenced_tweets,omitempty"`
+	Entities         Entities          `json:"entities"`
+	Attachments      Attachments       `json:"attachments"`
+}
+
+type PublicMetrics struct {
+	RetweetCount    int `json:"retweet_count"`
+	ReplyCount      int `json:"reply_count"`
+	LikeCount       int `json:"like_count"`
+	QuoteCount      int `json:"quote_count"`
+	ImpressionCount int `json:"impression_count"`
+}
+
+type ReferencedTweet struct {
+	Type string `json:"type"`
+	ID   string `json:"id"`
+}
+
+type Entities struct {
+	URLs []URL `json:"urls,omitempty"`
+}
+
+type URL struct {
+	URL         string `json:"url"`
+	ExpandedURL string `json:"expanded_url"`
+	DisplayURL  string `json:"display_url"`
+}
+
+type Attachments struct {
+	MediaKeys []string `json:"media_keys,omitempty"`
+}
+
+type Media struct {
+	MediaKey        string `json:"media_key"`
+	Type            string `json:"type"`
+	URL             string `json:"url,omitempty"`
+	PreviewImageURL string `json:"preview_image_url,omitempty"`
+}
+
+func (t Tweet) references(referenceType string) bool {
+	for _, r := range t.ReferencedTweets {
+		if r.Type == referenceType {
+			return true
+		}
+	}
+
+	return false
+}
+
+func fromTweet(t twitter.Tweet) Tweet {
+	result := Tweet{
+		ID:             t.ID,
+		Text:           t.Text,
+		CreatedAt:      t.CreatedAt,
+		AuthorID:       t.AuthorID,
+		ConversationID: t.ConversationID,
+		Lang:           t.Lang,
+	}
+
+	if t.PublicMetrics != nil {
+		result.PublicMetrics = &PublicMetrics{
+			RetweetCount:    t.PublicMetrics.RetweetCount,
+			ReplyCount:      t.PublicMetrics.ReplyCount,
+			LikeCount:       t.PublicMetrics.LikeCount,
+			QuoteCount:      t.PublicMetrics.QuoteCount,
+			ImpressionCount: t.PublicMetrics.ImpressionCount,
+		}
+	}
+
+	for _, r := range t.ReferencedTweets {
+		result.ReferencedTweets = append(result.ReferencedTweets, ReferencedTweet{Type: r.Type, ID: r.ID})
+	}
+
+	for _, u := range t.URLs {
+		result.Entities.URLs = append(result.Entities.URLs, URL{URL: u.URL, ExpandedURL: u.ExpandedURL, DisplayURL: u.DisplayURL})
+	}
+
+	for _, m := range t.Media {
+		result.Attachments.MediaKeys = append(result.Attachments.MediaKeys, m.MediaKey)
+	}
+
+	return result
+}
+
+type problem struct {
+	Type   string `json:"type"`
+	Title  string `json:"title"`
+	Detail string `json:"detail"`
+	Value  string `json:"value,omitempty"`
+}
+
+type response struct {
+	Data     interface{} `json:"data,omitempty"`
+	Includes includes    `json:"includes"`
+	Meta     *meta       `json:"meta,omitempty"`
+	Errors   []problem   `json:"errors,omitempty"`
+}
+
+type includes struct {
+	Users []User  `json:"users,omitempty"`
+	Media []Media `json:"media,omitempty"`
+}
+
+type meta struct {
+	ResultCount int    `json:"result_count"`
+	NextToken   string `json:"next_token,omitempty"`
+}
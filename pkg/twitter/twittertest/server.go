@@ -0,0 +1,517 @@
+// Package twittertest provides a fake Twitter API v2 serving seeded timelines, for local and integration
+// testing. Point twitter.Client at it with twitter.WithBaseURL.
+package twittertest
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/kordape/ottct-poller-service/pkg/twitter"
+)
+
+// Endpoints served by the fake, use them to inject errors with Fail.
+const (
+	EndpointUserTweets       = "GET /2/users/:id/tweets"
+	EndpointTweets           = "GET /2/tweets"
+	EndpointUsersByUsernames = "GET /2/users/by"
+	EndpointUsers            = "GET /2/users"
+	EndpointToken            = "POST /oauth2/token"
+)
+
+// Token is the bearer token issued by the fake OAuth2 token endpoint. Any bearer token is accepted though.
+const Token = "twittertest-token"
+
+const (
+	defaultRateLimit       = 1500
+	defaultRateLimitWindow = 15 * time.Minute
+
+	defaultMaxResults = 10
+	minMaxResults     = 5
+	maxMaxResults     = 100
+
+	problemResourceNotFound  = "https://api.twitter.com/2/problems/resource-not-found"
+	problemInvalidRequest    = "https://api.twitter.com/2/problems/invalid-request"
+	problemUnsupportedAuth   = "https://api.twitter.com/2/problems/unsupported-authentication"
+	problemRateLimitExceeded = "https://api.twitter.com/2/problems/rate-limit-exceeded"
+)
+
+// Server is an http.Handler faking the Twitter API, serve it with httptest.NewServer or http.ListenAndServe.
+type Server struct {
+	mu        sync.Mutex
+	users     map[string]User
+	tweets    map[string]Tweet
+	media     map[string]Media
+	suspended map[string]bool
+
+	rateLimit int
+	window    time.Duration
+	budgets   map[string]*budget
+	failures  map[string][]int
+	requests  map[string]int
+	now       func() time.Time
+}
+
+type budget struct {
+	remaining int
+	reset     time.Time
+}
+
+type Option func(s *Server)
+
+// WithRateLimit sets how many requests per window each token can make to each endpoint.
+func WithRateLimit(limit int, window time.Duration) Option {
+	return func(s *Server) {
+		s.rateLimit = limit
+		s.window = window
+	}
+}
+
+func New(opts ...Option) *Server {
+	s := &Server{
+		users:     map[string]User{},
+		tweets:    map[string]Tweet{},
+		media:     map[string]Media{},
+		suspended: map[string]bool{},
+		rateLimit: defaultRateLimit,
+		window:    defaultRateLimitWindow,
+		budgets:   map[string]*budget{},
+		failures:  map[string][]int{},
+		requests:  map[string]int{},
+		now:       time.Now,
+	}
+
+	for _, opt := range opts {
+		opt(s)
+	}
+
+	return s
+}
+
+// AddUsers seeds users, e.g. to be resolved by username or to expand tweet authors.
+func (s *Server) AddUsers(users ...twitter.User) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, u := range users {
+		s.users[u.ID] = User{ID: u.ID, Username: u.Username, Name: u.Name}
+	}
+}
+
+// AddTweets seeds tweets, they show up in the timeline of their author.
+func (s *Server) AddTweets(tweets ...twitter.Tweet) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, t := range tweets {
+		s.tweets[t.ID] = fromTweet(t)
+		for _, m := range t.Media {
+			s.media[m.MediaKey] = Media{MediaKey: m.MediaKey, Type: m.Type, URL: m.URL, PreviewImageURL: m.PreviewImageURL}
+		}
+	}
+}
+
+// Suspend makes the users look suspended, their timelines and lookups fail like they do on Twitter.
+func (s *Server) Suspend(userIDs ...string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, id := range userIDs {
+		s.suspended[id] = true
+	}
+}
+
+// Fail makes the next times requests to the endpoint fail with the given status.
+func (s *Server) Fail(endpoint string, status, times int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i := 0; i < times; i++ {
+		s.failures[endpoint] = append(s.failures[endpoint], status)
+	}
+}
+
+// Requests returns how many requests were made to the endpoint, including failed ones.
+func (s *Server) Requests(endpoint string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.requests[endpoint]
+}
+
+// Seed is a set of users, tweets and media in the Twitter API v2 format.
+type Seed struct {
+	Users  []User  `json:"users"`
+	Tweets []Tweet `json:"tweets"`
+	Media  []Media `json:"media"`
+	// Suspended are IDs of suspended users
+	Suspended []string `json:"suspended"`
+}
+
+// LoadSeed seeds the server from a JSON encoded Seed.
+func (s *Server) LoadSeed(r io.Reader) error {
+	var seed Seed
+	if err := json.NewDecoder(r).Decode(&seed); err != nil {
+		return fmt.Errorf("error decoding seed: %w", err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, u := range seed.Users {
+		s.users[u.ID] = u
+	}
+	for _, t := range seed.Tweets {
+		s.tweets[t.ID] = t
+	}
+	for _, m := range seed.Media {
+		s.media[m.MediaKey] = m
+	}
+	for _, id := range seed.Suspended {
+		s.suspended[id] = true
+	}
+
+	return nil
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	endpoint, userID := route(r)
+	if endpoint == "" {
+		writeProblem(w, http.StatusNotFound, problem{Title: "Not Found Error", Type: problemResourceNotFound, Detail: fmt.Sprintf("%s %s isn't served", r.Method, r.URL.Path)})
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.requests[endpoint]++
+
+	if endpoint == EndpointToken {
+		s.issueToken(w, r)
+		return
+	}
+
+	token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if token == "" || token == r.Header.Get("Authorization") {
+		writeProblem(w, http.StatusUnauthorized, problem{Title: "Unauthorized", Type: problemUnsupportedAuth, Detail: "Unauthorized"})
+		return
+	}
+
+	if !s.spend(w, endpoint, token) {
+		return
+	}
+
+	if failures := s.failures[endpoint]; len(failures) > 0 {
+		s.failures[endpoint] = failures[1:]
+		writeProblem(w, failures[0], problem{Title: http.StatusText(failures[0]), Type: "about:blank", Detail: "injected failure"})
+		return
+	}
+
+	switch endpoint {
+	case EndpointUserTweets:
+		s.serveTimeline(w, r, userID)
+	case EndpointTweets:
+		s.serveTweets(w, r)
+	case EndpointUsersByUsernames:
+		s.serveUsers(w, "usernames", split(r.URL.Query().Get("usernames")), s.userByUsername)
+	case EndpointUsers:
+		s.serveUsers(w, "ids", split(r.URL.Query().Get("ids")), func(id string) (User, bool) {
+			u, ok := s.users[id]
+			return u, ok
+		})
+	}
+}
+
+// route maps the request to one of the served endpoints, along with the user ID of timeline requests.
+func route(r *http.Request) (string, string) {
+	path := strings.TrimSuffix(r.URL.Path, "/")
+	switch {
+	case r.Method == http.MethodPost && path == "/oauth2/token":
+		return EndpointToken, ""
+	case r.Method != http.MethodGet:
+		return "", ""
+	case path == "/2/tweets":
+		return EndpointTweets, ""
+	case path == "/2/users/by":
+		return EndpointUsersByUsernames, ""
+	case path == "/2/users":
+		return EndpointUsers, ""
+	}
+
+	parts := strings.Split(strings.TrimPrefix(path, "/"), "/")
+	if len(parts) == 4 && parts[0] == "2" && parts[1] == "users" && parts[3] == "tweets" {
+		return EndpointUserTweets, parts[2]
+	}
+
+	return "", ""
+}
+
+// spend takes a request from the rate limit budget of the token and sets the rate limit headers.
+// It responds with 429 and returns false when the budget is exhausted.
+func (s *Server) spend(w http.ResponseWriter, endpoint, token string) bool {
+	key := endpoint + "#" + token
+	now := s.now()
+	b, ok := s.budgets[key]
+	if !ok || !now.Before(b.reset) {
+		b = &budget{remaining: s.rateLimit, reset: now.Add(s.window)}
+		s.budgets[key] = b
+	}
+
+	w.Header().Set("x-rate-limit-limit", strconv.Itoa(s.rateLimit))
+	w.Header().Set("x-rate-limit-reset", strconv.FormatInt(b.reset.Unix(), 10))
+
+	if b.remaining <= 0 {
+		w.Header().Set("x-rate-limit-remaining", "0")
+		writeProblem(w, http.StatusTooManyRequests, problem{Title: "Too Many Requests", Type: problemRateLimitExceeded, Detail: "Too Many Requests"})
+		return false
+	}
+
+	b.remaining--
+	w.Header().Set("x-rate-limit-remaining", strconv.Itoa(b.remaining))
+
+	return true
+}
+
+func (s *Server) issueToken(w http.ResponseWriter, r *http.Request) {
+	if _, _, ok := r.BasicAuth(); !ok || r.FormValue("grant_type") != "client_credentials" {
+		writeJSON(w, http.StatusForbidden, map[string]interface{}{
+			"errors": []map[string]interface{}{{"code": 99, "message": "Unable to verify your credentials"}},
+		})
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]string{"token_type": "bearer", "access_token": Token})
+}
+
+func (s *Server) serveTimeline(w http.ResponseWriter, r *http.Request, userID string) {
+	query := r.URL.Query()
+
+	maxResults := defaultMaxResults
+	if v := query.Get("max_results"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < minMaxResults || n > maxMaxResults {
+			writeProblem(w, http.StatusBadRequest, problem{Title: "Invalid Request", Type: problemInvalidRequest, Detail: fmt.Sprintf("The `max_results` query parameter value [%s] is not between %d and %d", v, minMaxResults, maxMaxResults)})
+			return
+		}
+		maxResults = n
+	}
+
+	if _, ok := s.users[userID]; !ok && !s.hasTweets(userID) {
+		writeJSON(w, http.StatusOK, response{Errors: []problem{{
+			Title:  "Not Found Error",
+			Type:   problemResourceNotFound,
+			Detail: fmt.Sprintf("Could not find user with id: [%s].", userID),
+			Value:  userID,
+		}}})
+		return
+	}
+
+	if s.suspended[userID] {
+		writeJSON(w, http.StatusOK, response{Errors: []problem{s.suspendedProblem(userID)}})
+		return
+	}
+
+	var startTime, endTime time.Time
+	for param, t := range map[string]*time.Time{"start_time": &startTime, "end_time": &endTime} {
+		if v := query.Get(param); v != "" {
+			parsed, err := time.Parse(time.RFC3339, v)
+			if err != nil {
+				writeProblem(w, http.StatusBadRequest, problem{Title: "Invalid Request", Type: problemInvalidRequest, Detail: fmt.Sprintf("Invalid %s: %s", param, v)})
+				return
+			}
+			*t = parsed
+		}
+	}
+
+	exclude := map[string]bool{}
+	for _, e := range split(query.Get("exclude")) {
+		exclude[e] = true
+	}
+
+	timeline := []Tweet{}
+	for _, t := range s.timeline(userID) {
+		switch {
+		case query.Get("since_id") != "" && !twitter.NewerID(t.ID, query.Get("since_id")):
+		case query.Get("until_id") != "" && !twitter.NewerID(query.Get("until_id"), t.ID):
+		case !startTime.IsZero() && t.CreatedAt.Before(startTime):
+		case !endTime.IsZero() && !t.CreatedAt.Before(endTime):
+		case exclude[twitter.ExcludeRetweets] && t.references(twitter.ReferenceRetweeted):
+		case exclude[twitter.ExcludeReplies] && t.references(twitter.ReferenceRepliedTo):
+		default:
+			timeline = append(timeline, t)
+		}
+	}
+
+	offset := 0
+	if v := query.Get("pagination_token"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 || n > len(timeline) {
+			writeProblem(w, http.StatusBadRequest, problem{Title: "Invalid Request", Type: problemInvalidRequest, Detail: fmt.Sprintf("Invalid pagination_token: %s", v)})
+			return
+		}
+		offset = n
+	}
+
+	end := offset + maxResults
+	if end > len(timeline) {
+		end = len(timeline)
+	}
+
+	resp := s.tweetsResponse(timeline[offset:end])
+	resp.Meta = &meta{ResultCount: end - offset}
+	if end < len(timeline) {
+		resp.Meta.NextToken = strconv.Itoa(end)
+	}
+
+	writeJSON(w, http.StatusOK, resp)
+}
+
+func (s *Server) serveTweets(w http.ResponseWriter, r *http.Request) {
+	found := []Tweet{}
+	errs := []problem{}
+	for _, id := range split(r.URL.Query().Get("ids")) {
+		t, ok := s.tweets[id]
+		switch {
+		case !ok:
+			errs = append(errs, problem{
+				Title:  "Not Found Error",
+				Type:   problemResourceNotFound,
+				Detail: fmt.Sprintf("Could not find tweet with ids: [%s].", id),
+				Value:  id,
+			})
+		case s.suspended[t.AuthorID]:
+			errs = append(errs, s.suspendedProblem(t.AuthorID))
+		default:
+			found = append(found, t)
+		}
+	}
+
+	resp := s.tweetsResponse(found)
+	resp.Errors = errs
+	writeJSON(w, http.StatusOK, resp)
+}
+
+func (s *Server) serveUsers(w http.ResponseWriter, param string, values []string, lookup func(string) (User, bool)) {
+	resp := response{}
+	users := []User{}
+	for _, v := range values {
+		u, ok := lookup(v)
+		switch {
+		case !ok:
+			resp.Errors = append(resp.Errors, problem{
+				Title:  "Not Found Error",
+				Type:   problemResourceNotFound,
+				Detail: fmt.Sprintf("Could not find user with %s: [%s].", param, v),
+				Value:  v,
+			})
+		case s.suspended[u.ID]:
+			p := s.suspendedProblem(u.ID)
+			p.Value = v
+			resp.Errors = append(resp.Errors, p)
+		default:
+			users = append(users, u)
+		}
+	}
+
+	if len(users) > 0 {
+		resp.Data = users
+	}
+
+	writeJSON(w, http.StatusOK, resp)
+}
+
+func (s *Server) userByUsername(username string) (User, bool) {
+	for _, u := range s.users {
+		if strings.EqualFold(u.Username, username) {
+			return u, true
+		}
+	}
+
+	return User{}, false
+}
+
+func (s *Server) suspendedProblem(userID string) problem {
+	return problem{
+		Title:  "Forbidden",
+		Type:   problemResourceNotFound,
+		Detail: fmt.Sprintf("User has been suspended: [%s].", userID),
+		Value:  userID,
+	}
+}
+
+func (s *Server) hasTweets(userID string) bool {
+	for _, t := range s.tweets {
+		if t.AuthorID == userID {
+			return true
+		}
+	}
+
+	return false
+}
+
+// timeline returns the tweets of the user, newest first.
+func (s *Server) timeline(userID string) []Tweet {
+	timeline := []Tweet{}
+	for _, t := range s.tweets {
+		if t.AuthorID == userID {
+			timeline = append(timeline, t)
+		}
+	}
+
+	sort.Slice(timeline, func(i, j int) bool {
+		return twitter.NewerID(timeline[i].ID, timeline[j].ID)
+	})
+
+	return timeline
+}
+
+// tweetsResponse returns the tweets along with the users and media they refer to.
+func (s *Server) tweetsResponse(tweets []Tweet) response {
+	resp := response{}
+	if len(tweets) > 0 {
+		resp.Data = tweets
+	}
+
+	authors := map[string]bool{}
+	for _, t := range tweets {
+		if u, ok := s.users[t.AuthorID]; ok && !authors[t.AuthorID] {
+			authors[t.AuthorID] = true
+			resp.Includes.Users = append(resp.Includes.Users, u)
+		}
+
+		for _, key := range t.Attachments.MediaKeys {
+			if m, ok := s.media[key]; ok {
+				resp.Includes.Media = append(resp.Includes.Media, m)
+			}
+		}
+	}
+
+	return resp
+}
+
+func split(value string) []string {
+	values := []string{}
+	for _, v := range strings.Split(value, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			values = append(values, v)
+		}
+	}
+
+	return values
+}
+
+func writeProblem(w http.ResponseWriter, status int, p problem) {
+	writeJSON(w, status, p)
+}
+
+func writeJSON(w http.ResponseWriter, status int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(body)
+}
@@ -0,0 +1,168 @@
+package twittertest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kordape/ottct-poller-service/pkg/logger"
+	"github.com/kordape/ottct-poller-service/pkg/retry"
+	"github.com/kordape/ottct-poller-service/pkg/twitter"
+	"github.com/stretchr/testify/assert"
+)
+
+func seeded(opts ...Option) *Server {
+	s := New(opts...)
+	s.AddUsers(twitter.User{ID: "1", Username: "foo", Name: "Foo"}, twitter.User{ID: "2", Username: "bar"})
+	for i := 1; i <= 12; i++ {
+		s.AddTweets(twitter.Tweet{
+			ID:        fmt.Sprintf("%d", 100+i),
+			Text:      fmt.Sprintf("tweet %d", i),
+			CreatedAt: time.Date(2023, 1, 1, i, 0, 0, 0, time.UTC),
+			AuthorID:  "1",
+		})
+	}
+	s.AddTweets(twitter.Tweet{
+		ID:               "200",
+		Text:             "RT tweet",
+		AuthorID:         "1",
+		ReferencedTweets: []twitter.ReferencedTweet{{Type: twitter.ReferenceRetweeted, ID: "101"}},
+	})
+
+	return s
+}
+
+func TestServer(t *testing.T) {
+	log := logger.New("DEBUG")
+	newClient := func(server *httptest.Server) *twitter.Client {
+		return twitter.New(server.Client(), "token", twitter.WithBaseURL(server.URL), twitter.WithRetryPolicy(retry.Policy{
+			MaxAttempts:    2,
+			InitialBackoff: time.Millisecond,
+			MaxBackoff:     time.Millisecond,
+			Retryable:      retry.DefaultPolicy().Retryable,
+		}))
+	}
+
+	t.Run("serves timelines page by page", func(t *testing.T) {
+		fake := seeded()
+		server := httptest.NewServer(fake)
+		defer server.Close()
+
+		resp, err := newClient(server).FetchTweets(context.Background(), log, twitter.FetchTweetsRequest{
+			EntityID:   "1",
+			MaxResults: 5,
+			SinceID:    "101",
+			Exclude:    []string{twitter.ExcludeRetweets},
+		})
+		assert.NoError(t, err)
+		assert.Len(t, resp.Tweets, 11)
+		assert.Equal(t, "112", resp.Tweets[0].ID)
+		assert.Equal(t, "foo", resp.Tweets[0].Author.Username)
+		assert.False(t, resp.Truncated)
+		assert.Equal(t, 3, fake.Requests(EndpointUserTweets))
+	})
+
+	t.Run("pages until the cap and resumes with until_id", func(t *testing.T) {
+		server := httptest.NewServer(seeded())
+		defer server.Close()
+
+		client := newClient(server)
+		request := twitter.FetchTweetsRequest{EntityID: "1", MaxResults: 5, SinceID: "101", MaxTweets: 7}
+		resp, err := client.FetchTweets(context.Background(), log, request)
+		assert.NoError(t, err)
+		assert.Len(t, resp.Tweets, 7)
+		assert.True(t, resp.Truncated)
+
+		request.UntilID = resp.Tweets[6].ID
+		resp, err = client.FetchTweets(context.Background(), log, request)
+		assert.NoError(t, err)
+		assert.Len(t, resp.Tweets, 5)
+		assert.Equal(t, "106", resp.Tweets[0].ID)
+		assert.False(t, resp.Truncated)
+	})
+
+	t.Run("sends rate limit headers", func(t *testing.T) {
+		server := httptest.NewServer(seeded(WithRateLimit(1, time.Hour)))
+		defer server.Close()
+
+		client := newClient(server)
+		request := twitter.FetchTweetsRequest{EntityID: "2", MaxResults: 5, SinceID: "1"}
+		_, err := client.FetchTweets(context.Background(), log, request)
+		assert.NoError(t, err)
+
+		_, err = client.FetchTweets(context.Background(), log, request)
+		var rateLimited *twitter.RateLimitedError
+		assert.True(t, errors.As(err, &rateLimited))
+		assert.True(t, rateLimited.Reset.After(time.Now()))
+	})
+
+	t.Run("injects errors", func(t *testing.T) {
+		fake := seeded()
+		fake.Fail(EndpointUserTweets, http.StatusServiceUnavailable, 1)
+		fake.Fail(EndpointUsers, http.StatusInternalServerError, 2)
+		server := httptest.NewServer(fake)
+		defer server.Close()
+
+		client := newClient(server)
+		_, err := client.FetchTweets(context.Background(), log, twitter.FetchTweetsRequest{EntityID: "2", MaxResults: 5, SinceID: "1"})
+		assert.NoError(t, err)
+		assert.Equal(t, 2, fake.Requests(EndpointUserTweets))
+
+		_, err = client.LookupUserIDs(context.Background(), log, []string{"1"})
+		assert.Error(t, err)
+	})
+
+	t.Run("reports unavailable accounts", func(t *testing.T) {
+		fake := seeded()
+		fake.Suspend("2")
+		server := httptest.NewServer(fake)
+		defer server.Close()
+
+		client := newClient(server)
+		_, err := client.FetchTweets(context.Background(), log, twitter.FetchTweetsRequest{EntityID: "2", MaxResults: 5, SinceID: "1"})
+		assert.True(t, errors.Is(err, twitter.ErrSuspended))
+
+		_, err = client.FetchTweets(context.Background(), log, twitter.FetchTweetsRequest{EntityID: "3", MaxResults: 5, SinceID: "1"})
+		assert.True(t, errors.Is(err, twitter.ErrNotFound))
+
+		users, err := client.LookupUsernames(context.Background(), log, []string{"FOO", "bar", "baz"})
+		assert.NoError(t, err)
+		assert.Equal(t, []twitter.User{{ID: "1", Username: "foo", Name: "Foo"}}, users.Users)
+		assert.Equal(t, map[string]twitter.AccountState{"bar": twitter.AccountSuspended, "baz": twitter.AccountNotFound}, users.Unavailable)
+	})
+
+	t.Run("issues app-only tokens", func(t *testing.T) {
+		server := httptest.NewServer(seeded())
+		defer server.Close()
+
+		source, err := twitter.NewClientCredentials(server.Client(), "key", "secret", twitter.WithTokenURL(server.URL+"/oauth2/token"))
+		assert.NoError(t, err)
+
+		token, err := source.Token(context.Background())
+		assert.NoError(t, err)
+		assert.Equal(t, Token, token)
+	})
+
+	t.Run("loads seeds", func(t *testing.T) {
+		fake := New()
+		err := fake.LoadSeed(strings.NewReader(`{
+			"users": [{"id": "1", "username": "foo"}],
+			"tweets": [{"id": "10", "text": "hello", "author_id": "1", "created_at": "2023-01-01T00:00:00Z", "attachments": {"media_keys": ["3_1"]}}],
+			"media": [{"media_key": "3_1", "type": "photo", "url": "https://pbs.twimg.com/media/1.jpg"}]
+		}`))
+		assert.NoError(t, err)
+		server := httptest.NewServer(fake)
+		defer server.Close()
+
+		tweets, err := newClient(server).LookupTweets(context.Background(), log, []string{"10", "11"})
+		assert.NoError(t, err)
+		assert.Len(t, tweets, 1)
+		assert.Equal(t, "https://twitter.com/foo/status/10", tweets[0].URL())
+		assert.Equal(t, "photo", tweets[0].Media[0].Type)
+	})
+}
@@ -0,0 +1,93 @@
+package twitter
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/kordape/ottct-poller-service/pkg/logger"
+)
+
+const (
+	getUsersByUsernamesPath     = "/2/users/by"
+	getUsersByUsernamesEndpoint = "GET /2/users/by"
+	getUsersByIDsPath           = "/2/users"
+	getUsersByIDsEndpoint       = "GET /2/users"
+
+	// maxUsersPerLookup is how many users a single lookup request accepts
+	maxUsersPerLookup = 100
+)
+
+type getUsersResponse struct {
+	Data   []user    `json:"data"`
+	Errors []problem `json:"errors"`
+}
+
+type user struct {
+	ID       string `json:"id"`
+	Username string `json:"username"`
+	Name     string `json:"name"`
+}
+
+func (c *Client) LookupUsernames(ctx context.Context, log logger.Interface, usernames []string) (UsersLookupResponse, error) {
+	return c.lookupUsers(ctx, log, c.url(getUsersByUsernamesPath), getUsersByUsernamesEndpoint, "usernames", usernames)
+}
+
+func (c *Client) LookupUserIDs(ctx context.Context, log logger.Interface, ids []string) (UsersLookupResponse, error) {
+	return c.lookupUsers(ctx, log, c.url(getUsersByIDsPath), getUsersByIDsEndpoint, "ids", ids)
+}
+
+// lookupUsers looks the values up in batches the API accepts and merges the results.
+func (c *Client) lookupUsers(ctx context.Context, log logger.Interface, baseUrl, endpoint, param string, values []string) (UsersLookupResponse, error) {
+	result := UsersLookupResponse{
+		Users:       []User{},
+		Unavailable: map[string]AccountState{},
+	}
+
+	for start := 0; start < len(values); start += maxUsersPerLookup {
+		end := start + maxUsersPerLookup
+		if end > len(values) {
+			end = len(values)
+		}
+
+		query := url.Values{}
+		query.Set(param, strings.Join(values[start:end], ","))
+		request, err := http.NewRequestWithContext(ctx, http.MethodGet, fmt.Sprintf("%s?%s", baseUrl, query.Encode()), nil)
+		if err != nil {
+			return UsersLookupResponse{}, fmt.Errorf("error creating request: %w", err)
+		}
+
+		body, err := c.doRequest(ctx, endpoint, request)
+		if err != nil {
+			return UsersLookupResponse{}, fmt.Errorf("error invoking twitter api: %w", err)
+		}
+
+		var response getUsersResponse
+		if err := json.Unmarshal(body, &response); err != nil {
+			return UsersLookupResponse{}, fmt.Errorf("error unmarshalling response: %w", err)
+		}
+
+		for _, u := range response.Data {
+			result.Users = append(result.Users, User{
+				ID:       u.ID,
+				Username: u.Username,
+				Name:     u.Name,
+			})
+		}
+
+		for _, err := range partialErrors(response.Errors) {
+			result.Unavailable[err.Value] = AccountNotFound
+			if errors.Is(err, ErrSuspended) {
+				result.Unavailable[err.Value] = AccountSuspended
+			}
+		}
+	}
+
+	log.Info(fmt.Sprintf("Looked up %d users, %d unavailable", len(result.Users), len(result.Unavailable)))
+
+	return result, nil
+}
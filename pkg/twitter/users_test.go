@@ -0,0 +1,74 @@
+package twitter
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/kordape/ottct-poller-service/pkg/logger"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLookupUsers(t *testing.T) {
+	t.Run("by usernames", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			assert.Equal(t, "/2/users/by", r.URL.Path)
+			assert.Equal(t, "foo,bar,baz", r.URL.Query().Get("usernames"))
+
+			w.Write([]byte(`{
+				"data": [{"id": "1", "username": "foo", "name": "Foo"}],
+				"errors": [
+					{"value": "bar", "title": "Forbidden", "detail": "User has been suspended: [bar].",
+						"type": "https://api.twitter.com/2/problems/resource-not-found"},
+					{"value": "baz", "title": "Not Found Error", "detail": "Could not find user with usernames: [baz]."}
+				]
+			}`))
+		}))
+		defer server.Close()
+
+		api := New(server.Client(), "futile", WithBaseURL(server.URL))
+
+		response, err := api.LookupUsernames(context.Background(), logger.New("DEBUG"), []string{"foo", "bar", "baz"})
+		assert.NoError(t, err)
+		assert.Equal(t, []User{{ID: "1", Username: "foo", Name: "Foo"}}, response.Users)
+		assert.Equal(t, map[string]AccountState{
+			"bar": AccountSuspended,
+			"baz": AccountNotFound,
+		}, response.Unavailable)
+	})
+
+	t.Run("by ids in batches", func(t *testing.T) {
+		var requests int32
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			atomic.AddInt32(&requests, 1)
+			assert.Equal(t, "/2/users", r.URL.Path)
+
+			ids := strings.Split(r.URL.Query().Get("ids"), ",")
+			assert.LessOrEqual(t, len(ids), maxUsersPerLookup)
+
+			data := make([]string, len(ids))
+			for i, id := range ids {
+				data[i] = fmt.Sprintf(`{"id": "%s", "username": "user%s"}`, id, id)
+			}
+			w.Write([]byte(fmt.Sprintf(`{"data": [%s]}`, strings.Join(data, ","))))
+		}))
+		defer server.Close()
+
+		api := New(server.Client(), "futile", WithBaseURL(server.URL))
+
+		ids := make([]string, 150)
+		for i := range ids {
+			ids[i] = fmt.Sprint(i)
+		}
+
+		response, err := api.LookupUserIDs(context.Background(), logger.New("DEBUG"), ids)
+		assert.NoError(t, err)
+		assert.Equal(t, 150, len(response.Users))
+		assert.Equal(t, "user149", response.Users[149].Username)
+		assert.Equal(t, int32(2), atomic.LoadInt32(&requests))
+	})
+}